@@ -1,17 +1,26 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
+	"github.com/mauzec/tdsoft/gui/internal/accounts"
 	"github.com/mauzec/tdsoft/gui/internal/client"
 	"github.com/mauzec/tdsoft/gui/internal/config"
 	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"github.com/mauzec/tdsoft/gui/internal/jobs"
+	"github.com/mauzec/tdsoft/gui/internal/preferences"
+	"github.com/mauzec/tdsoft/gui/internal/store"
 	"github.com/mauzec/tdsoft/gui/internal/ui"
+	"github.com/mauzec/tdsoft/gui/internal/vault"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -48,45 +57,195 @@ func main() {
 	}
 	logger, _ := loggerConfig.Build()
 
-	cl, clientErr := client.NewClient(logger, appCfg, a)
-	if clientErr != nil {
-		if errors.Is(clientErr, apperrors.ErrNeedAuth) {
-			logger.Info("unable to load API config, need auth", zap.Error(clientErr))
+	var (
+		mu sync.Mutex
+		cl *client.Client
+		jm *jobs.Manager
+		v  *vault.Vault
+		st *store.Store
+	)
+
+	// ingests stop on shutdown
+	storeCtx, stopStore := context.WithCancel(context.Background())
+	if appCfg.StorePath != "" {
+		s, err := store.Open(appCfg.StorePath)
+		if err != nil {
+			logger.Error("failed to open store, results are not stored", zap.Error(err))
 		} else {
-			logger.Fatal("failed to create client", zap.Error(clientErr))
+			st = s
+			r.PutService(st)
 		}
 	}
-	r.PutService(a)
-	r.PutService(cl)
-	r.PutService(w)
-	w.SetOnClosed(func() {
-		err := cl.StopCreatorServer()
+
+	// start creates the client with store and shows the first screen.
+	start := func(store preferences.SettingsStore) {
+		c, clientErr := client.NewClient(logger, appCfg, store)
+		if clientErr != nil {
+			if errors.Is(clientErr, apperrors.ErrNeedAuth) {
+				logger.Info("unable to load API config, need auth", zap.Error(clientErr))
+			} else {
+				logger.Fatal("failed to create client", zap.Error(clientErr))
+			}
+		}
+		m, err := jobs.NewManager(c, appCfg.JobsPerSession, logger)
 		if err != nil {
-			cl.ExtLog.Error("failed to stop creator server", zap.Error(err))
+			logger.Fatal("failed to create job manager", zap.Error(err))
+		}
+		var history []client.JournalEntry
+		if appCfg.JournalPath != "" {
+			history, err = client.ReadJournal(appCfg.JournalPath)
+			if err != nil {
+				logger.Warn("failed to read requests journal", zap.Error(err))
+			}
+			m.Restore(history)
+		}
+		if st != nil {
+			followJobs(storeCtx, st, m, history, logger)
+		}
+
+		mu.Lock()
+		cl, jm = c, m
+		mu.Unlock()
+		r.PutService(c)
+		r.PutService(m)
+
+		if clientErr != nil {
+			r.Show(ui.ScreenLogin)
+		} else {
+			r.Show(ui.ScreenMain)
+		}
+	}
+
+	shutdown := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if jm != nil {
+			jm.CancelAll()
+		}
+		stopStore()
+		if st != nil {
+			if err := st.Close(); err != nil {
+				logger.Error("failed to close store", zap.Error(err))
+			}
+			st = nil
+		}
+		if cl != nil {
+			err := cl.StopCreatorServer()
+			if err != nil {
+				cl.ExtLog.Error("failed to stop creator server", zap.Error(err))
+			}
+			cl.StopWorker()
+		}
+		if v != nil {
+			if err := v.Close(); err != nil {
+				logger.Error("failed to close vault", zap.Error(err))
+			}
 		}
 
 		_ = logger.Sync()
-	})
+	}
+
+	r.PutService(a)
+	r.PutService(w)
+	w.SetOnClosed(shutdown)
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-sigCh
-
-		err := cl.StopCreatorServer()
-		if err != nil {
-			cl.ExtLog.Error("failed to stop creator server", zap.Error(err))
-		}
-
-		_ = logger.Sync()
+		shutdown()
 		os.Exit(0)
 	}()
 
-	if clientErr != nil {
-		r.Show(ui.ScreenLogin)
+	if appCfg.VaultPath == "" {
+		start(preferences.NewFyneStore(a.Preferences()))
 	} else {
-		r.Show(ui.ScreenMain)
+		v = vault.New(appCfg.VaultPath, appCfg.Session)
+		r.PutService(v)
+		r.ShowWith(ui.ScreenUnlock, func() {
+			migrateToVault(v, appCfg, preferences.NewFyneStore(a.Preferences()), logger)
+			start(v)
+		})
 	}
 
 	w.ShowAndRun()
 }
+
+// followJobs ingests the outputs of done jobs into st: jobs of history
+// missing in st, and every job of m when it is done.
+func followJobs(ctx context.Context, st *store.Store, m *jobs.Manager, history []client.JournalEntry, logger *zap.Logger) {
+	m.Subscribe(func(j *jobs.Job) {
+		if j.Status() != jobs.StatusDone {
+			return
+		}
+		snap := j.Snapshot()
+		go func() {
+			_, err := st.Ingest(ctx, store.Job{
+				ID: snap.ID, Account: snap.Account, Request: snap.Request, FinishedAt: snap.EndedAt,
+			})
+			if err != nil {
+				logger.Error("failed to store job results", zap.String("id", snap.ID), zap.Error(err))
+			}
+		}()
+	})
+	go func() {
+		n, err := st.IngestJournal(ctx, history)
+		if err != nil {
+			logger.Warn("failed to store results of journaled jobs", zap.Error(err))
+		}
+		if n > 0 {
+			logger.Info("stored results of journaled jobs", zap.Int("jobs", n))
+		}
+	}()
+}
+
+// migrateToVault moves plaintext credentials, accounts and the session
+// files of the accounts into the vault. The plaintext copies are removed
+// once they are stored.
+func migrateToVault(v *vault.Vault, appCfg *config.AppConfig, prefs preferences.SettingsStore, logger *zap.Logger) {
+	// sessions of accounts only known to prefs are moved too
+	var plain []accounts.Account
+	if raw := prefs.String(preferences.KeyTGAccounts); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &plain); err != nil {
+			logger.Warn("failed to parse plaintext accounts", zap.Error(err))
+		}
+	}
+
+	err := v.ImportSettings(prefs,
+		preferences.KeyTGAPIID, preferences.KeyTGAPIHash, preferences.KeyTGPhone,
+		preferences.KeyTGAccounts, preferences.KeyTGCurrentAccount,
+	)
+	if err != nil {
+		logger.Error("failed to move credentials into vault", zap.Error(err))
+		return
+	}
+
+	reg, err := accounts.Load(v, appCfg.Session)
+	if err != nil {
+		logger.Error("failed to load accounts from vault", zap.Error(err))
+		return
+	}
+	sessions := []string{appCfg.Session}
+	for _, a := range append(plain, reg.List()...) {
+		if !slices.Contains(sessions, a.Session) {
+			sessions = append(sessions, a.Session)
+		}
+	}
+	for _, session := range sessions {
+		sessionFile := session + ".session"
+		if _, err := os.Stat(sessionFile); err != nil {
+			continue
+		}
+		if err := v.ImportSession(session, sessionFile); errors.Is(err, apperrors.ErrSessionConflict) {
+			logger.Warn("vault has another session, plaintext session is kept",
+				zap.String("session", sessionFile))
+			continue
+		} else if err != nil {
+			logger.Error("failed to move session into vault",
+				zap.String("session", sessionFile), zap.Error(err))
+			continue
+		}
+		logger.Info("moved plaintext session into vault", zap.String("session", sessionFile))
+	}
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/accounts"
+	"github.com/mauzec/tdsoft/gui/internal/auth"
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"github.com/mauzec/tdsoft/gui/internal/members"
+	"github.com/mauzec/tdsoft/gui/internal/output"
+	"github.com/mauzec/tdsoft/gui/internal/store"
+	"github.com/skip2/go-qrcode"
+	"go.uber.org/zap"
+)
+
+func runMembers(ctx context.Context, app *cliApp, args []string) int {
+	req := &client.GetMembersRequest{}
+	fs := flag.NewFlagSet("members", flag.ContinueOnError)
+	fs.StringVar(&req.ChatID, "chat", "", "chat username, id or link (required)")
+	fs.IntVar(&req.Limit, "limit", 1000, "maximum number of members, up to 50000")
+	setOutput := outputFlags(fs, "members", &req.Output, &req.Format)
+	fs.BoolVar(&req.ParseFromMessages, "parse-from-messages", false, "also parse users from messages")
+	fs.IntVar(&req.MessagesLimit, "messages-limit", 0, "number of messages to parse, up to 5000")
+	fs.BoolVar(&req.ParseBio, "parse-bio", false, "parse users' bio (slow)")
+	fs.BoolVar(&req.AddAdditionalInfo, "add-info", false, "add additional info about users")
+	resume := fs.Bool("resume", false, resumeUsage)
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+	setOutput()
+	return app.runResumable(ctx, req, *resume)
+}
+
+func runStats(ctx context.Context, app *cliApp, args []string) int {
+	req := &client.GetChatStatsRequest{}
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.StringVar(&req.ChatID, "chat", "", "chat username, id or link (required)")
+	fs.IntVar(&req.MessagesLimit, "messages-limit", 0, "number of messages to parse, 0 means all")
+	setOutput := outputFlags(fs, "stats", &req.Output, &req.Format)
+	resume := fs.Bool("resume", false, resumeUsage)
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+	setOutput()
+	return app.runResumable(ctx, req, *resume)
+}
+
+func runSearch(ctx context.Context, app *cliApp, args []string) int {
+	req := &client.SearchMessagesRequest{}
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.StringVar(&req.ChatID, "chat", "", "chat username, id or link (required)")
+	fs.StringVar(&req.Username, "username", "", "username of the author (required)")
+	fs.StringVar(&req.FromDate, "from", "", "start date, MM/DD/YYYY (required)")
+	fs.StringVar(&req.ToDate, "to", "", "end date, MM/DD/YYYY (required)")
+	setOutput := outputFlags(fs, "search", &req.Output, &req.Format)
+	resume := fs.Bool("resume", false, resumeUsage)
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+	setOutput()
+	return app.runResumable(ctx, req, *resume)
+}
+
+const resumeUsage = "continue from the checkpoint of -output, appending to it"
+
+// runResumable runs req, or with resume its rest from the checkpoint
+// left next to the output by an unfinished run.
+func (app *cliApp) runResumable(ctx context.Context, req client.Request, resume bool) int {
+	if resume {
+		r, err := client.ResumeRequest(req)
+		if err != nil {
+			fmt.Fprintln(app.stderr, "can't resume:", err)
+			return exitUsage
+		}
+		req = r
+	}
+	return app.runRequest(ctx, req)
+}
+
+func runDialogs(ctx context.Context, app *cliApp, args []string) int {
+	req := &client.PrintDialogsRequest{}
+	fs := flag.NewFlagSet("dialogs", flag.ContinueOnError)
+	fs.IntVar(&req.Limit, "limit", 100, "maximum number of dialogs")
+	setOutput := outputFlags(fs, "dialogs", &req.Output, &req.Format)
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+	setOutput()
+	return app.runRequest(ctx, req)
+}
+
+// runIngest stores the outputs of done jobs from the journal that are
+// not in the database yet, e.g. of jobs run before the store was set up.
+func runIngest(ctx context.Context, app *cliApp, args []string) int {
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	path := fs.String("store", app.cfg.StorePath, "SQLite database to store to")
+	journal := fs.String("journal", app.cfg.JournalPath, "requests journal to read jobs from")
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+	if *path == "" || *journal == "" {
+		fmt.Fprintln(app.stderr, "no store or journal, set store_path and journal_path in app.toml")
+		return exitUsage
+	}
+
+	entries, err := client.ReadJournal(*journal)
+	if err != nil {
+		fmt.Fprintln(app.stderr, "failed to read journal:", err)
+		return exitFailure
+	}
+	st, err := store.Open(*path)
+	if err != nil {
+		fmt.Fprintln(app.stderr, "failed to open store:", err)
+		return exitFailure
+	}
+	defer st.Close()
+
+	n, err := st.IngestJournal(ctx, entries)
+	fmt.Fprintf(app.stdout, "ingested %d jobs\n", n)
+	if err != nil {
+		return app.exitCode(err)
+	}
+	return exitOK
+}
+
+// runDiff compares two member lists, outputs of members jobs or members
+// stored by jobs, and prints or exports who joined, left or changed.
+func runDiff(ctx context.Context, app *cliApp, args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	oldPath := fs.String("old", "", "older members output")
+	newPath := fs.String("new", "", "newer members output")
+	oldJob := fs.String("old-job", "", "ID of the older members job in the store, instead of -old")
+	newJob := fs.String("new-job", "", "ID of the newer members job in the store, instead of -new")
+	out := fs.String("output", "", "file to export the diff to, printed if empty")
+	var format output.Format
+	fs.Func("output-format", "export format: csv, ndjson, sqlite or xlsx (default by -output extension)", func(s string) error {
+		f, err := output.ParseFormat(s)
+		if err != nil {
+			return err
+		}
+		format = f
+		return nil
+	})
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+	if (*oldPath == "") == (*oldJob == "") || (*newPath == "") == (*newJob == "") {
+		fmt.Fprintln(app.stderr, "set one of -old and -old-job, and one of -new and -new-job")
+		return exitUsage
+	}
+
+	var st *store.Store
+	if *oldJob != "" || *newJob != "" {
+		if app.cfg.StorePath == "" {
+			fmt.Fprintln(app.stderr, "no store, set store_path in app.toml")
+			return exitUsage
+		}
+		var err error
+		if st, err = store.Open(app.cfg.StorePath); err != nil {
+			fmt.Fprintln(app.stderr, "failed to open store:", err)
+			return exitFailure
+		}
+		defer st.Close()
+	}
+	load := func(path, job string) ([]members.Member, error) {
+		if job != "" {
+			return st.MemberSnapshot(ctx, job)
+		}
+		return members.ReadFile(path)
+	}
+	before, err := load(*oldPath, *oldJob)
+	if err != nil {
+		fmt.Fprintln(app.stderr, "failed to read old members:", err)
+		return exitFailure
+	}
+	after, err := load(*newPath, *newJob)
+	if err != nil {
+		fmt.Fprintln(app.stderr, "failed to read new members:", err)
+		return exitFailure
+	}
+
+	d := members.Compare(before, after)
+	if *out != "" {
+		if format == "" {
+			format = output.FormatOf(*out)
+		}
+		if err := d.Export(format, *out); err != nil {
+			fmt.Fprintln(app.stderr, "failed to export diff:", err)
+			return exitFailure
+		}
+	} else {
+		marks := map[members.ChangeType]string{members.Joined: "+", members.Left: "-", members.Changed: "~"}
+		for _, c := range d.Changes {
+			m := c.Member
+			line := fmt.Sprintf("%s %d", marks[c.Type], m.UserID)
+			if m.Username != "" {
+				line += " @" + m.Username
+			}
+			if name := strings.TrimSpace(m.FirstName + " " + m.LastName); name != "" {
+				line += " " + name
+			}
+			if len(c.Fields) > 0 {
+				line += " (" + c.FieldsText() + ")"
+			}
+			fmt.Fprintln(app.stdout, line)
+		}
+	}
+	fmt.Fprintf(app.stderr, "%d joined, %d left, %d changed (%d -> %d members)\n",
+		d.Count(members.Joined), d.Count(members.Left), d.Count(members.Changed), d.Old, d.New)
+	return exitOK
+}
+
+// qrPollInterval is how often login -qr checks whether the code was scanned.
+const qrPollInterval = 2 * time.Second
+
+// runLogin creates a session the same way the auth screens do,
+// reading answers from stdin. With -account, the account is created
+// if needed and becomes current. With -qr, a QR code is printed to be
+// scanned in a logged in telegram app instead of asking the phone.
+func runLogin(ctx context.Context, app *cliApp, args []string) int {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	withQR := fs.Bool("qr", false, "log in by scanning a QR code")
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+
+	cl := app.cl
+	if name := app.gf.account; name != "" {
+		if _, ok := findAccount(cl, name); !ok {
+			if _, err := cl.AddAccount(name); err != nil {
+				fmt.Fprintln(app.stderr, "failed to add account:", err)
+				return exitUsage
+			}
+		}
+		if err := cl.SwitchAccount(name); err != nil && !errors.Is(err, apperrors.ErrNeedAuth) {
+			fmt.Fprintln(app.stderr, "failed to switch account:", err)
+			return exitFailure
+		}
+	}
+	ask := func(prompt string) (string, error) {
+		fmt.Fprint(app.stderr, prompt)
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	if err := cl.StartCreatorServer(); err != nil {
+		cl.ExtLog.Error("failed to start creator server", zap.Error(err))
+		fmt.Fprintln(app.stderr, "failed to start creator server:", err)
+		return exitFailure
+	}
+	defer func() {
+		if err := cl.StopCreatorServer(); err != nil {
+			cl.ExtLog.Warn("failed to stop creator server", zap.Error(err))
+		}
+	}()
+
+	// a failed step is asked again, e.g. a wrong code
+	flow := auth.NewFlow(auth.NewClientBackend(cl))
+	shownQR := ""
+	steps := func() error {
+		for {
+			var err error
+			switch flow.State() {
+			case auth.StateDone:
+				return nil
+			case auth.StateAPIData:
+				var id, hash string
+				if id, err = ask("API ID: "); err != nil {
+					return err
+				}
+				if hash, err = ask("API Hash: "); err != nil {
+					return err
+				}
+				err = flow.SubmitAPIData(id, hash)
+			case auth.StatePhone:
+				if *withQR {
+					if err = flow.StartQR(); err != nil {
+						return err
+					}
+					continue
+				}
+				var phone string
+				if phone, err = ask("Phone: "); err != nil {
+					return err
+				}
+				err = flow.SubmitPhone(phone)
+			case auth.StateCode:
+				var code string
+				if code, err = ask("Code (empty to resend): "); err != nil {
+					return err
+				}
+				if code != "" {
+					err = flow.SubmitCode(code)
+					break
+				}
+				if wait := flow.ResendIn(); wait > 0 {
+					fmt.Fprintf(app.stderr, "The code can be resent in %d seconds\n", int(wait.Seconds())+1)
+					continue
+				}
+				if err = flow.ResendCode(); err == nil {
+					fmt.Fprintln(app.stderr, "Code resent:", strings.ToLower(flow.SentCode().Type))
+				}
+			case auth.StatePassword:
+				prompt := "Password: "
+				if hint := flow.PasswordHint(); hint != "" {
+					prompt = fmt.Sprintf("Password (hint: %s): ", hint)
+				}
+				var password string
+				if password, err = ask(prompt); err != nil {
+					return err
+				}
+				err = flow.SubmitPassword(password)
+			case auth.StateQR:
+				if qr := flow.QRToken(); qr.Token != shownQR {
+					shownQR = qr.Token
+					code, err := qrcode.New(qr.URL(), qrcode.Low)
+					if err != nil {
+						return err
+					}
+					fmt.Fprint(app.stderr, code.ToSmallString(false))
+					fmt.Fprintln(app.stderr, "Scan it in telegram: Settings > Devices > Link Desktop Device")
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(qrPollInterval):
+				}
+				err = flow.PollQR()
+			}
+
+			if err == nil {
+				continue
+			}
+			var ae *auth.Error
+			if !errors.As(err, &ae) || flow.SignedIn() ||
+				errors.Is(err, apperrors.ErrCreatorNotRunning) || errors.Is(err, apperrors.ErrCreatorCrashed) {
+				return err
+			}
+			cl.ExtLog.Warn("login step failed", zap.Stringer("state", flow.State()), zap.Error(err))
+			fmt.Fprintln(app.stderr, ae.Message)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- steps() }()
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(app.stderr, "\ninterrupted")
+		return exitInterrupted
+	case err := <-done:
+		if err != nil {
+			cl.ExtLog.Error("login failed", zap.Error(err))
+			fmt.Fprintln(app.stderr, "login failed:", err)
+			return exitFailure
+		}
+	}
+	fmt.Fprintln(app.stdout, "Logged in, account "+cl.CurrentAccount().Name)
+	return exitOK
+}
+
+// runLogout logs out the session on telegram and deletes it,
+// with -local it is only deleted.
+func runLogout(ctx context.Context, app *cliApp, args []string) int {
+	fs := flag.NewFlagSet("logout", flag.ContinueOnError)
+	local := fs.Bool("local", false, "only delete the session here, it stays active on telegram")
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+	var err error
+	if *local {
+		err = app.cl.Logout(app.gf.account)
+	} else {
+		err = app.cl.SignOut(ctx, app.gf.account)
+	}
+	if err != nil {
+		fmt.Fprintln(app.stderr, "logout failed:", err)
+		if !*local {
+			fmt.Fprintln(app.stderr, "to delete the session here anyway, run: tdscli logout -local")
+		}
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runSessions lists the active sessions of the account, or terminates
+// one of them or all but the current one.
+func runSessions(ctx context.Context, app *cliApp, args []string) int {
+	fs := flag.NewFlagSet("sessions", flag.ContinueOnError)
+	terminate := fs.Int64("terminate", 0, "hash of the session to terminate")
+	others := fs.Bool("terminate-others", false, "terminate all sessions but the current one")
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+	if err := app.cl.CheckAccount(app.gf.account); err != nil {
+		if errors.Is(err, apperrors.ErrNeedAuth) {
+			fmt.Fprintln(app.stderr, "not logged in, run: tdscli login")
+			return exitNeedAuth
+		}
+		fmt.Fprintln(app.stderr, err)
+		return exitUsage
+	}
+
+	opt := client.WithAccount(app.gf.account)
+	switch {
+	case *terminate != 0:
+		return app.exitCode(app.cl.TerminateAuthorization(ctx, *terminate, opt))
+	case *others:
+		return app.exitCode(app.cl.TerminateOtherAuthorizations(ctx, opt))
+	}
+
+	auths, err := app.cl.Authorizations(ctx, opt)
+	if err != nil {
+		return app.exitCode(err)
+	}
+	for _, a := range auths {
+		mark := " "
+		if a.Current {
+			mark = "*"
+		}
+		fmt.Fprintf(app.stdout, "%s %-20d %-24s %-28s %-16s %s %s\n", mark, a.Hash,
+			a.DeviceModel, strings.TrimSpace(a.AppName+" "+a.AppVersion), a.IP, a.Country,
+			a.Active.Local().Format(time.DateTime))
+	}
+	return exitOK
+}
+
+func runAccounts(ctx context.Context, app *cliApp, args []string) int {
+	fs := flag.NewFlagSet("accounts", flag.ContinueOnError)
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+
+	current := app.cl.CurrentAccount().Name
+	now := time.Now()
+	for _, a := range app.cl.Accounts() {
+		mark := " "
+		if a.Name == current {
+			mark = "*"
+		}
+		state := "logged in"
+		if err := app.cl.CheckAccount(a.Name); err != nil {
+			state = "needs login"
+		}
+		if a.CoolingDown(now) {
+			state += ", flood wait until " + a.CooldownUntil.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(app.stdout, "%s %-16s %-16s %s\n", mark, a.Name, a.Phone, state)
+	}
+	return exitOK
+}
+
+func findAccount(cl *client.Client, name string) (accounts.Account, bool) {
+	for _, a := range cl.Accounts() {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return accounts.Account{}, false
+}
+
+// runStatus checks the session of the account. A revoked session is
+// logged out and exits with exitNeedAuth.
+func runStatus(ctx context.Context, app *cliApp, args []string) int {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	if !parseCommandFlags(fs, args) {
+		return exitUsage
+	}
+	if err := app.cl.CheckAccount(app.gf.account); err != nil {
+		if errors.Is(err, apperrors.ErrNeedAuth) {
+			fmt.Fprintln(app.stderr, "not logged in, run: tdscli login")
+			return exitNeedAuth
+		}
+		fmt.Fprintln(app.stderr, err)
+		return exitUsage
+	}
+
+	h, err := app.cl.CheckConnection(ctx, client.WithAccount(app.gf.account))
+	if errors.Is(err, apperrors.ErrSessionRevoked) {
+		fmt.Fprintln(app.stderr, "the session was revoked, run: tdscli login")
+		return exitNeedAuth
+	}
+	if err != nil {
+		return app.exitCode(err)
+	}
+	fmt.Fprintf(app.stdout, "%s: logged in as %s (id %d), latency %d ms\n",
+		h.Account, h.Name(), h.UserID, h.Latency.Milliseconds())
+	return exitOK
+}
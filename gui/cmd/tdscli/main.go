@@ -0,0 +1,423 @@
+// Command tdscli runs tdsoft scripts without the GUI, e.g. from cron or over SSH.
+//
+//	tdscli [global flags] <command> [command flags]
+//
+// Commands: members, stats, search, dialogs, ingest, diff, login, logout, sessions, accounts, status.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	"github.com/mauzec/tdsoft/gui/internal/config"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"github.com/mauzec/tdsoft/gui/internal/jobs"
+	"github.com/mauzec/tdsoft/gui/internal/output"
+	"github.com/mauzec/tdsoft/gui/internal/preferences"
+	"github.com/mauzec/tdsoft/gui/internal/store"
+	"github.com/mauzec/tdsoft/gui/internal/vault"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/term"
+)
+
+// Exit codes.
+const (
+	exitOK          = 0
+	exitScriptError = 1
+	exitUsage       = 2
+	exitFailure     = 3
+	exitNeedAuth    = 4
+	exitInterrupted = 130
+)
+
+// stdin is shared by all prompts, so buffered input is not lost between them.
+var stdin = bufio.NewReader(os.Stdin)
+
+type globalFlags struct {
+	configDir string
+	format    string
+	account   string
+
+	// settings is a JSON/TOML file with API credentials, see preferences.FileStore.
+	// Not used if the vault is configured.
+	settings string
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, app *cliApp, args []string) int
+	vault vaultUse
+}
+
+// vaultUse is how a command uses the vault, if it is configured.
+type vaultUse int
+
+const (
+	vaultNone   vaultUse = iota // the vault is not opened
+	vaultRead                   // the vault is opened if it exists
+	vaultCreate                 // the vault is opened or created
+)
+
+var commands = []command{
+	{"members", "parse members of a group/channel", runMembers, vaultCreate},
+	{"stats", "get chat statistics", runStats, vaultCreate},
+	{"search", "search messages of a user in a chat", runSearch, vaultCreate},
+	{"dialogs", "print dialogs to find chat ids", runDialogs, vaultCreate},
+	{"ingest", "store outputs of journaled jobs in the database", runIngest, vaultNone},
+	{"diff", "compare two member lists: joined, left and changed", runDiff, vaultNone},
+	{"login", "log in to telegram interactively", runLogin, vaultCreate},
+	{"logout", "log out on telegram and delete the session", runLogout, vaultCreate},
+	{"sessions", "list or terminate sessions of the account", runSessions, vaultCreate},
+	{"accounts", "list accounts", runAccounts, vaultRead},
+	{"status", "check that the session works", runStatus, vaultCreate},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	var gf globalFlags
+	fs := flag.NewFlagSet("tdscli", flag.ContinueOnError)
+	fs.StringVar(&gf.configDir, "config-dir", "config", "directory with app.toml")
+	fs.StringVar(&gf.format, "format", "text", "events output format: text or json")
+	fs.StringVar(&gf.account, "account", "", "account to run with, the current one if empty")
+	fs.StringVar(&gf.settings, "settings", "", "JSON or TOML file to keep API credentials in (not kept if empty)")
+	fs.Usage = func() { usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if gf.format != "text" && gf.format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", gf.format)
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		usage(fs)
+		return exitUsage
+	}
+
+	name := fs.Arg(0)
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		usage(fs)
+		return exitUsage
+	}
+
+	app, err := newCLIApp(gf, cmd.vault)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	defer app.close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return cmd.run(ctx, app, fs.Args()[1:])
+}
+
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintln(out, "usage: tdscli [global flags] <command> [command flags]")
+	fmt.Fprintln(out, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(out, "\nglobal flags:")
+	fs.PrintDefaults()
+}
+
+type cliApp struct {
+	gf     globalFlags
+	cfg    *config.AppConfig
+	logger *zap.Logger
+	cl     *client.Client
+	vault  *vault.Vault
+
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// newCLIApp loads the config and creates the client. The vault is
+// opened as use allows, the accounts and credentials are kept in it.
+func newCLIApp(gf globalFlags, use vaultUse) (*cliApp, error) {
+	cfg, err := config.LoadConfig[config.AppConfig]("app", "toml", gf.configDir, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load app config: %w", err)
+	}
+
+	loggerConfig := zap.Config{
+		Level:       zap.NewAtomicLevelAt(zapcore.DebugLevel),
+		Development: false,
+		Encoding:    "console",
+		EncoderConfig: zapcore.EncoderConfig{
+			TimeKey:      "T",
+			LevelKey:     "L",
+			MessageKey:   "M",
+			CallerKey:    "C",
+			EncodeTime:   zapcore.ISO8601TimeEncoder,
+			EncodeLevel:  zapcore.CapitalLevelEncoder,
+			EncodeCaller: zapcore.ShortCallerEncoder,
+			LineEnding:   zapcore.DefaultLineEnding,
+		},
+		OutputPaths:      []string{cfg.LogPath + "/cli.log"},
+		ErrorOutputPaths: []string{"stderr", cfg.LogPath + "/cli.log"},
+	}
+	logger, err := loggerConfig.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build logger: %w", err)
+	}
+
+	app := &cliApp{
+		gf:     gf,
+		cfg:    cfg,
+		logger: logger,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+
+	var store preferences.SettingsStore
+	if cfg.VaultPath != "" {
+		if use == vaultNone || use == vaultRead && !vault.New(cfg.VaultPath, cfg.Session).Exists() {
+			return app.newClient(nil)
+		}
+		v, err := openVault(cfg, app.stderr)
+		if err != nil {
+			_ = logger.Sync()
+			return nil, err
+		}
+		app.vault, store = v, v
+	} else if gf.settings != "" {
+		fileStore, err := preferences.NewFileStore(gf.settings)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+	return app.newClient(store)
+}
+
+// newClient creates the client of app with the settings store.
+func (app *cliApp) newClient(store preferences.SettingsStore) (*cliApp, error) {
+	cl, err := client.NewClient(app.logger, app.cfg, store)
+	if err != nil && !errors.Is(err, apperrors.ErrNeedAuth) {
+		app.close()
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	app.cl = cl
+
+	if app.gf.format == "json" {
+		// events are printed by the observer
+		cl.SetUserLogger(func(string) {})
+	} else {
+		cl.SetUserLogger(func(s string) { fmt.Fprintln(app.stdout, s) })
+	}
+	return app, nil
+}
+
+func (app *cliApp) close() {
+	if app.cl != nil {
+		app.cl.StopWorker()
+	}
+	if app.vault != nil {
+		if err := app.vault.Close(); err != nil {
+			app.logger.Error("failed to close vault", zap.Error(err))
+		}
+	}
+	_ = app.logger.Sync()
+}
+
+// openVault unlocks the vault with TDS_VAULT_PASSPHRASE or a passphrase
+// read from stdin, and moves a plaintext session into it. A new vault
+// asks for the passphrase twice.
+func openVault(cfg *config.AppConfig, stderr io.Writer) (*vault.Vault, error) {
+	v := vault.New(cfg.VaultPath, cfg.Session)
+
+	passphrase, ok := os.LookupEnv("TDS_VAULT_PASSPHRASE")
+	if !ok {
+		prompt := "Vault passphrase: "
+		if !v.Exists() {
+			prompt = "New vault passphrase: "
+		}
+		var err error
+		if passphrase, err = readPassphrase(prompt, stderr); err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if !v.Exists() {
+			repeated, err := readPassphrase("Repeat passphrase: ", stderr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read passphrase: %w", err)
+			}
+			if repeated != passphrase {
+				return nil, errors.New("passphrases don't match")
+			}
+		}
+	}
+	if err := v.Unlock(passphrase); err != nil {
+		return nil, fmt.Errorf("failed to unlock vault: %w", err)
+	}
+
+	sessionFile := cfg.Session + ".session"
+	if _, err := os.Stat(sessionFile); err == nil {
+		err := v.ImportSession(cfg.Session, sessionFile)
+		if errors.Is(err, apperrors.ErrSessionConflict) {
+			fmt.Fprintf(stderr, "warning: vault has another session, %s is kept\n", sessionFile)
+		} else if err != nil {
+			_ = v.Close()
+			return nil, fmt.Errorf("failed to move session into vault: %w", err)
+		}
+	}
+	return v, nil
+}
+
+// readPassphrase prints prompt and reads a line from stdin,
+// without echo if stdin is a terminal.
+func readPassphrase(prompt string, stderr io.Writer) (string, error) {
+	fmt.Fprint(stderr, prompt)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(stderr)
+		return string(b), err
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// jsonEvent is a single line of json output format.
+type jsonEvent struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Code    string         `json:"code"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// runRequest runs req and prints its events. Returns the exit code.
+func (app *cliApp) runRequest(ctx context.Context, req client.Request) int {
+	if err := app.cl.CheckAccount(app.gf.account); err != nil {
+		if errors.Is(err, apperrors.ErrNeedAuth) {
+			fmt.Fprintln(app.stderr, "not logged in, run: tdscli login")
+			return exitNeedAuth
+		}
+		fmt.Fprintln(app.stderr, err)
+		return exitUsage
+	}
+
+	id := jobs.NewID()
+	opts := []client.RunOption{client.WithAccount(app.gf.account), client.WithJobID(id)}
+	if app.gf.format == "json" {
+		enc := json.NewEncoder(app.stdout)
+		opts = append(opts, client.WithObserver(func(level string, pm *client.PyMsg) {
+			_ = enc.Encode(jsonEvent{
+				Time: time.Now(), Level: level, Code: pm.Code, Details: pm.Details,
+			})
+		}))
+	} else {
+		opts = append(opts, client.WithProgress(func(p client.Progress) {
+			if p.Total > 0 {
+				fmt.Fprintf(app.stderr, "%s: %d/%d\n", p.Phase, p.Current, p.Total)
+			} else {
+				fmt.Fprintf(app.stderr, "%s: %d\n", p.Phase, p.Current)
+			}
+		}))
+	}
+
+	err := app.cl.Run(ctx, req, opts...)
+	if err == nil {
+		app.ingest(ctx, store.Job{
+			ID: id, Account: app.cl.Account(opts...), Request: req, FinishedAt: time.Now(),
+		})
+	}
+	return app.exitCode(err)
+}
+
+// ingest stores the output of a done job if the store is configured.
+// A failed ingest is reported, the job itself is done.
+func (app *cliApp) ingest(ctx context.Context, job store.Job) {
+	if app.cfg.StorePath == "" {
+		return
+	}
+	st, err := store.Open(app.cfg.StorePath)
+	if err == nil {
+		_, err = st.Ingest(ctx, job)
+		err = errors.Join(err, st.Close())
+	}
+	if err != nil {
+		app.logger.Error("failed to store job results", zap.String("id", job.ID), zap.Error(err))
+		fmt.Fprintln(app.stderr, "failed to store results:", err)
+	}
+}
+
+func (app *cliApp) exitCode(err error) int {
+	var se *apperrors.ScriptError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintln(app.stderr, "interrupted")
+		return exitInterrupted
+	case errors.As(err, &se):
+		fmt.Fprintln(app.stderr, se.Error())
+		return exitScriptError
+	default:
+		fmt.Fprintln(app.stderr, err)
+		return exitFailure
+	}
+}
+
+func defaultOutput(prefix string, format output.Format) string {
+	return prefix + "-" + time.Now().Format("20060102-150405") + format.Ext()
+}
+
+// outputFlags defines -output and -output-format of a job command.
+// Call the returned func after parsing, it names an unset output
+// by prefix with the extension of the format.
+func outputFlags(fs *flag.FlagSet, prefix string, path *string, format *output.Format) func() {
+	fs.StringVar(path, "output", "", "output file (default "+prefix+"-<time>.<format>)")
+	fs.Func("output-format", "output format: csv, ndjson, sqlite or xlsx (default csv)", func(s string) error {
+		f, err := output.ParseFormat(s)
+		if err != nil {
+			return err
+		}
+		*format = f
+		return nil
+	})
+	return func() {
+		if *path == "" {
+			*path = defaultOutput(prefix, *format)
+		}
+	}
+}
+
+// parseCommandFlags parses args, returns false on usage error.
+func parseCommandFlags(fs *flag.FlagSet, args []string) bool {
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %v\n", fs.Args())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+// Package accounts keeps the list of telegram accounts, each with
+// its own session, API credentials and phone.
+//
+// The list is stored in a preferences.SettingsStore as JSON, so with
+// the vault it is encrypted together with the sessions.
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/preferences"
+)
+
+var (
+	ErrAccountNotFound = errors.New("account not found")
+	ErrAccountExists   = errors.New("account already exists")
+	ErrInvalidName     = errors.New("invalid account name, use letters, digits, '-' and '_'")
+	ErrLastAccount     = errors.New("can't remove the last account")
+)
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+type Account struct {
+	Name string `json:"name"`
+
+	// Session is the session name, e.g. config/first.
+	// The session file is Session + ".session".
+	Session string `json:"session"`
+
+	Phone   string `json:"phone,omitempty"`
+	APIID   string `json:"api_id,omitempty"`
+	APIHash string `json:"api_hash,omitempty"`
+
+	// CooldownUntil is the end of the last flood wait of the account.
+	CooldownUntil time.Time `json:"cooldown_until,omitzero"`
+}
+
+func (a Account) HasCredentials() bool {
+	return strings.TrimSpace(a.APIID) != "" && strings.TrimSpace(a.APIHash) != ""
+}
+
+// CoolingDown reports whether the flood wait of the account is not over at now.
+func (a Account) CoolingDown(now time.Time) bool {
+	return now.Before(a.CooldownUntil)
+}
+
+// Registry is the list of accounts and the current one.
+// It is safe for concurrent use.
+type Registry struct {
+	store      preferences.SettingsStore
+	sessionDir string
+
+	mu       sync.RWMutex
+	accounts []Account
+	current  string
+}
+
+// Load reads the registry from store. If there are no accounts yet, the
+// default account is created with defaultSession and the credentials
+// saved by older versions under the tg.* keys.
+func Load(store preferences.SettingsStore, defaultSession string) (*Registry, error) {
+	reg := &Registry{
+		store:      store,
+		sessionDir: filepath.Dir(defaultSession),
+	}
+
+	if raw := store.String(preferences.KeyTGAccounts); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &reg.accounts); err != nil {
+			return nil, fmt.Errorf("failed to parse accounts: %w", err)
+		}
+	}
+	if len(reg.accounts) == 0 {
+		reg.accounts = []Account{{
+			Name:    filepath.Base(defaultSession),
+			Session: defaultSession,
+			Phone:   store.String(preferences.KeyTGPhone),
+			APIID:   store.String(preferences.KeyTGAPIID),
+			APIHash: store.String(preferences.KeyTGAPIHash),
+		}}
+		if err := reg.save(); err != nil {
+			return nil, err
+		}
+		store.RemoveValue(preferences.KeyTGAPIID)
+		store.RemoveValue(preferences.KeyTGAPIHash)
+		store.RemoveValue(preferences.KeyTGPhone)
+	}
+
+	reg.current = store.String(preferences.KeyTGCurrentAccount)
+	if _, ok := reg.find(reg.current); !ok {
+		reg.current = reg.accounts[0].Name
+	}
+	return reg, nil
+}
+
+// List returns all accounts in the order they were added.
+func (reg *Registry) List() []Account {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make([]Account, len(reg.accounts))
+	copy(out, reg.accounts)
+	return out
+}
+
+func (reg *Registry) Names() []string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make([]string, len(reg.accounts))
+	for i, a := range reg.accounts {
+		out[i] = a.Name
+	}
+	return out
+}
+
+func (reg *Registry) Get(name string) (Account, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	i, ok := reg.find(name)
+	if !ok {
+		return Account{}, false
+	}
+	return reg.accounts[i], true
+}
+
+func (reg *Registry) Current() Account {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	i, _ := reg.find(reg.current)
+	return reg.accounts[i]
+}
+
+func (reg *Registry) SetCurrent(name string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, ok := reg.find(name); !ok {
+		return ErrAccountNotFound
+	}
+	reg.current = name
+	reg.store.SetString(preferences.KeyTGCurrentAccount, name)
+	return storeErr(reg.store)
+}
+
+// Add creates an account with a session next to the default one.
+func (reg *Registry) Add(name string) (Account, error) {
+	if !nameRe.MatchString(name) {
+		return Account{}, ErrInvalidName
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, ok := reg.find(name); ok {
+		return Account{}, ErrAccountExists
+	}
+	a := Account{Name: name, Session: filepath.Join(reg.sessionDir, name)}
+	reg.accounts = append(reg.accounts, a)
+	if err := reg.save(); err != nil {
+		reg.accounts = reg.accounts[:len(reg.accounts)-1]
+		return Account{}, err
+	}
+	return a, nil
+}
+
+// Update replaces the account with the same name.
+func (reg *Registry) Update(a Account) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	i, ok := reg.find(a.Name)
+	if !ok {
+		return ErrAccountNotFound
+	}
+	old := reg.accounts[i]
+	reg.accounts[i] = a
+	if err := reg.save(); err != nil {
+		reg.accounts[i] = old
+		return err
+	}
+	return nil
+}
+
+// SetCooldown sets the end of the flood wait of the account.
+// An earlier end than the saved one is ignored.
+func (reg *Registry) SetCooldown(name string, until time.Time) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	i, ok := reg.find(name)
+	if !ok {
+		return ErrAccountNotFound
+	}
+	old := reg.accounts[i].CooldownUntil
+	if !until.After(old) {
+		return nil
+	}
+	reg.accounts[i].CooldownUntil = until
+	if err := reg.save(); err != nil {
+		reg.accounts[i].CooldownUntil = old
+		return err
+	}
+	return nil
+}
+
+// Remove deletes the account from the list. The session is not touched.
+func (reg *Registry) Remove(name string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	i, ok := reg.find(name)
+	if !ok {
+		return ErrAccountNotFound
+	}
+	if len(reg.accounts) == 1 {
+		return ErrLastAccount
+	}
+	reg.accounts = append(reg.accounts[:i:i], reg.accounts[i+1:]...)
+	if reg.current == name {
+		reg.current = reg.accounts[0].Name
+		reg.store.SetString(preferences.KeyTGCurrentAccount, reg.current)
+	}
+	return reg.save()
+}
+
+// find must be called with mu held.
+func (reg *Registry) find(name string) (int, bool) {
+	for i, a := range reg.accounts {
+		if a.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// save must be called with mu held.
+func (reg *Registry) save() error {
+	data, err := json.Marshal(reg.accounts)
+	if err != nil {
+		return err
+	}
+	reg.store.SetString(preferences.KeyTGAccounts, string(data))
+	return storeErr(reg.store)
+}
+
+// storeErr returns the last write error of stores reporting it,
+// like preferences.FileStore and vault.Vault.
+func storeErr(store preferences.SettingsStore) error {
+	if s, ok := store.(interface{ Err() error }); ok {
+		return s.Err()
+	}
+	return nil
+}
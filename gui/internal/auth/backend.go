@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	"github.com/mauzec/tdsoft/gui/internal/creator"
+)
+
+// clientBackend logs in the current account of a client
+// through its creator server.
+type clientBackend struct {
+	cl *client.Client
+}
+
+// NewClientBackend returns a backend logging in the current account of cl,
+// the creator server must be started. Save saves the API credentials.
+func NewClientBackend(cl *client.Client) Backend {
+	return clientBackend{cl: cl}
+}
+
+func (b clientBackend) SendAPIData(apiID, apiHash string) error {
+	b.cl.APIID, b.cl.APIHash = apiID, apiHash
+	return b.cl.SendAPIData()
+}
+
+func (b clientBackend) SendCode(phone string) (*creator.SendCodeResponse, error) {
+	return b.cl.SendPhone(phone)
+}
+
+func (b clientBackend) ResendCode(string) (*creator.SendCodeResponse, error) {
+	return b.cl.ResendCode()
+}
+
+func (b clientBackend) SignIn(phone, code string) error {
+	return b.cl.SignIn(phone, code)
+}
+
+func (b clientBackend) QRLogin() (*creator.QRLoginResponse, error) {
+	return b.cl.QRLogin()
+}
+
+func (b clientBackend) CheckPassword(password string) error {
+	return b.cl.CheckPassword(password)
+}
+
+func (b clientBackend) Save() error {
+	return b.cl.SaveAPIConfig()
+}
+
+// creatorBackend calls a creator server directly, e.g. a fake one
+// of package creatortest.
+type creatorBackend struct {
+	c   *creator.Client
+	ctx context.Context
+}
+
+// NewCreatorBackend returns a backend calling c with ctx. Save does nothing.
+func NewCreatorBackend(ctx context.Context, c *creator.Client) Backend {
+	return creatorBackend{c: c, ctx: ctx}
+}
+
+func (b creatorBackend) SendAPIData(apiID, apiHash string) error {
+	_, err := b.c.SendAPIData(b.ctx, creator.APIDataRequest{APIID: apiID, APIHash: apiHash})
+	return err
+}
+
+func (b creatorBackend) SendCode(phone string) (*creator.SendCodeResponse, error) {
+	return b.c.SendCode(b.ctx, phone)
+}
+
+func (b creatorBackend) ResendCode(phone string) (*creator.SendCodeResponse, error) {
+	return b.c.ResendCode(b.ctx, phone)
+}
+
+func (b creatorBackend) SignIn(phone, code string) error {
+	return b.c.SignIn(b.ctx, creator.SignInRequest{Phone: phone, Code: code})
+}
+
+func (b creatorBackend) QRLogin() (*creator.QRLoginResponse, error) {
+	return b.c.QRLogin(b.ctx)
+}
+
+func (b creatorBackend) CheckPassword(password string) error {
+	return b.c.CheckPassword(b.ctx, password)
+}
+
+func (b creatorBackend) Save() error {
+	return nil
+}
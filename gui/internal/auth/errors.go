@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mauzec/tdsoft/gui/internal/creator"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+)
+
+// Error is an error of a login step. Message is shown to the user,
+// Err is the cause, e.g. a [*creator.Error].
+type Error struct {
+	State   State
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func userError(state State, msg string, err error) *Error {
+	return &Error{State: state, Message: msg, Err: err}
+}
+
+// messages of creator error codes
+var messages = map[string]string{
+	creator.ErrAPIIDInvalid.Code:          "API ID or API hash is wrong",
+	creator.ErrPhoneNumberInvalid.Code:    "The phone number is invalid, enter it with the country code",
+	creator.ErrPhoneNumberBanned.Code:     "This phone number is banned by telegram",
+	creator.ErrPhoneNumberUnoccupied.Code: "There is no telegram account with this phone number",
+	creator.ErrPhoneCodeInvalid.Code:      "The code is wrong, check it and try again",
+	creator.ErrPhoneCodeExpired.Code:      "The code has expired, request a new one",
+	creator.ErrSendCodeUnavailable.Code:   "The code can't be sent another way, wait for it or go back and send it again",
+	creator.ErrPasswordHashInvalid.Code:   "The password is wrong",
+	creator.ErrCodeNotSent.Code:           "The code was not sent, go back and send it again",
+	creator.ErrClientNotInitialized.Code:  "Login was reset, go back and enter API ID and API hash again",
+}
+
+// wrap returns err of a step in state with a message for the user.
+func wrap(state State, err error) *Error {
+	var ce *creator.Error
+	switch {
+	case errors.As(err, &ce):
+		if msg, ok := messages[ce.Code]; ok {
+			return userError(state, msg, err)
+		}
+		if s, ok := creator.FloodWait(err); ok {
+			return userError(state, fmt.Sprintf("Too many attempts, try again in %d seconds", s), err)
+		}
+		return userError(state, "Telegram error: "+ce.Code, err)
+	case errors.Is(err, apperrors.ErrCreatorNotRunning), errors.Is(err, apperrors.ErrCreatorCrashed):
+		return userError(state, "Login server is not running, reopen the login", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return userError(state, "Login server doesn't answer, try again", err)
+	}
+	return userError(state, "Login failed: "+err.Error(), err)
+}
@@ -0,0 +1,361 @@
+// Package auth is the login of an account as a state machine:
+//
+//	APIData -> Phone -> Code -> [Password] -> Done
+//	              \---> QR ---/
+//
+// QR is a parallel branch to the code: a login token is shown as a QR code
+// and scanned in a logged in telegram app.
+//
+// A [Flow] is driven by the login screen or by tdscli, the steps are done
+// by a [Backend]. Errors of the steps are [*Error] with a message for the user.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mauzec/tdsoft/gui/internal/creator"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+)
+
+type State int
+
+const (
+	StateAPIData State = iota
+	StatePhone
+	StateCode
+	StatePassword
+	StateDone
+	StateQR
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAPIData:
+		return "api data"
+	case StatePhone:
+		return "phone"
+	case StateCode:
+		return "code"
+	case StatePassword:
+		return "password"
+	case StateDone:
+		return "done"
+	case StateQR:
+		return "qr"
+	}
+	return "unknown"
+}
+
+var (
+	ErrWrongState = errors.New("not allowed in this login state")
+	ErrNoBack     = errors.New("no previous login state")
+)
+
+// Backend does the login steps, see [NewClientBackend] and [NewCreatorBackend].
+type Backend interface {
+	SendAPIData(apiID, apiHash string) error
+	SendCode(phone string) (*creator.SendCodeResponse, error)
+	ResendCode(phone string) (*creator.SendCodeResponse, error)
+	// SignIn returns an error matching [creator.ErrPasswordNeeded]
+	// if the account has 2FA.
+	SignIn(phone, code string) error
+	// QRLogin returns the login token to show, or signs in if it was
+	// accepted. Errors are like SignIn.
+	QRLogin() (*creator.QRLoginResponse, error)
+	CheckPassword(password string) error
+	// Save is called when the account is signed in.
+	Save() error
+}
+
+// Flow is the login of an account. It is safe for concurrent use,
+// steps are done one at a time.
+type Flow struct {
+	b Backend
+
+	// stepMu is held while a step calls the backend
+	stepMu sync.Mutex
+
+	mu      sync.Mutex
+	state   State
+	phone   string
+	sent    *creator.SendCodeResponse
+	sentAt  time.Time
+	expired bool
+	hint    string
+	qr      *creator.QRLoginResponse
+	// signedIn is set when Save failed, the step that signed in
+	// only retries Save then
+	signedIn bool
+
+	now func() time.Time
+}
+
+func NewFlow(b Backend) *Flow {
+	return &Flow{b: b, now: time.Now}
+}
+
+func (f *Flow) State() State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+// Phone returns the phone the code was sent to.
+func (f *Flow) Phone() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.phone
+}
+
+// SentCode returns how the last code was sent, nil before StateCode.
+func (f *Flow) SentCode() *creator.SendCodeResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sent
+}
+
+// CodeExpired reports whether telegram said the last code expired,
+// a new one is sent with [Flow.ResendCode].
+func (f *Flow) CodeExpired() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.expired
+}
+
+// ResendIn returns how long to wait before the code may be resent.
+func (f *Flow) ResendIn() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sent == nil {
+		return 0
+	}
+	d := f.sentAt.Add(time.Duration(f.sent.Timeout) * time.Second).Sub(f.now())
+	return max(d, 0)
+}
+
+// QRToken returns the login token to show as a QR code in StateQR.
+// It changes when the token expires.
+func (f *Flow) QRToken() *creator.QRLoginResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.qr
+}
+
+// PasswordHint returns the hint of the 2FA password, set in StatePassword.
+func (f *Flow) PasswordHint() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hint
+}
+
+// SignedIn reports whether the account is signed in but Save failed.
+// The flow stays in the state of the step, doing it again retries Save.
+func (f *Flow) SignedIn() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.signedIn
+}
+
+// SubmitAPIData sends the API credentials: APIData -> Phone.
+func (f *Flow) SubmitAPIData(apiID, apiHash string) error {
+	apiID, apiHash = strings.TrimSpace(apiID), strings.TrimSpace(apiHash)
+	return f.step(StateAPIData, func() (State, error) {
+		if apiID == "" || apiHash == "" {
+			return StateAPIData, userError(StateAPIData, "Enter API ID and API hash", apperrors.ErrFieldRequired)
+		}
+		if strings.ContainsFunc(apiID, func(r rune) bool { return !unicode.IsDigit(r) }) {
+			return StateAPIData, userError(StateAPIData, "API ID must contain only digits", apperrors.ErrOnlyDigitsAllowed)
+		}
+		if err := f.b.SendAPIData(apiID, apiHash); err != nil {
+			return StateAPIData, wrap(StateAPIData, err)
+		}
+		return StatePhone, nil
+	})
+}
+
+// SubmitPhone sends the login code to phone: Phone -> Code.
+func (f *Flow) SubmitPhone(phone string) error {
+	phone = strings.TrimSpace(phone)
+	return f.step(StatePhone, func() (State, error) {
+		if phone == "" {
+			return StatePhone, userError(StatePhone, "Enter the phone number", apperrors.ErrFieldRequired)
+		}
+		res, err := f.b.SendCode(phone)
+		if err != nil {
+			return StatePhone, wrap(StatePhone, err)
+		}
+		f.mu.Lock()
+		f.phone = phone
+		f.setSent(res)
+		f.mu.Unlock()
+		return StateCode, nil
+	})
+}
+
+// ResendCode sends the code again, usually another way (see NextType
+// of [Flow.SentCode]). Allowed in StateCode.
+func (f *Flow) ResendCode() error {
+	return f.step(StateCode, func() (State, error) {
+		res, err := f.b.ResendCode(f.Phone())
+		if err != nil {
+			return StateCode, wrap(StateCode, err)
+		}
+		f.mu.Lock()
+		f.setSent(res)
+		f.mu.Unlock()
+		return StateCode, nil
+	})
+}
+
+// SubmitCode signs in with the code: Code -> Done,
+// or Code -> Password if the account has 2FA.
+func (f *Flow) SubmitCode(code string) error {
+	code = strings.TrimSpace(code)
+	return f.step(StateCode, func() (State, error) {
+		if f.SignedIn() {
+			return f.done(StateCode)
+		}
+		if code == "" {
+			return StateCode, userError(StateCode, "Enter the code", apperrors.ErrFieldRequired)
+		}
+		err := f.b.SignIn(f.Phone(), code)
+		switch {
+		case errors.Is(err, creator.ErrPasswordNeeded):
+			f.mu.Lock()
+			f.hint = creator.PasswordHint(err)
+			f.mu.Unlock()
+			return StatePassword, nil
+		case errors.Is(err, creator.ErrPhoneCodeExpired):
+			f.mu.Lock()
+			f.expired = true
+			f.mu.Unlock()
+			return StateCode, wrap(StateCode, err)
+		case err != nil:
+			return StateCode, wrap(StateCode, err)
+		}
+		return f.done(StateCode)
+	})
+}
+
+// StartQR gets a login token instead of sending the code: Phone -> QR.
+func (f *Flow) StartQR() error {
+	return f.step(StatePhone, func() (State, error) {
+		f.mu.Lock()
+		f.qr = nil
+		f.mu.Unlock()
+		return f.pollQR(StatePhone)
+	})
+}
+
+// PollQR checks whether the token was accepted: QR -> Done, or QR -> Password
+// if the account has 2FA. Otherwise the flow stays in QR, with a new token
+// if the last one expired.
+func (f *Flow) PollQR() error {
+	return f.step(StateQR, func() (State, error) {
+		return f.pollQR(StateQR)
+	})
+}
+
+// pollQR returns from if the poll fails.
+func (f *Flow) pollQR(from State) (State, error) {
+	if f.SignedIn() {
+		return f.done(from)
+	}
+	res, err := f.b.QRLogin()
+	switch {
+	case errors.Is(err, creator.ErrPasswordNeeded):
+		f.mu.Lock()
+		f.hint = creator.PasswordHint(err)
+		f.qr = nil
+		f.mu.Unlock()
+		return StatePassword, nil
+	case err != nil:
+		return from, wrap(from, err)
+	case res.Status == creator.QRSuccess:
+		return f.done(from)
+	}
+	f.mu.Lock()
+	f.qr = res
+	f.mu.Unlock()
+	return StateQR, nil
+}
+
+// SubmitPassword checks the 2FA password: Password -> Done.
+func (f *Flow) SubmitPassword(password string) error {
+	return f.step(StatePassword, func() (State, error) {
+		if f.SignedIn() {
+			return f.done(StatePassword)
+		}
+		if password == "" {
+			return StatePassword, userError(StatePassword, "Enter the password", apperrors.ErrFieldRequired)
+		}
+		if err := f.b.CheckPassword(password); err != nil {
+			return StatePassword, wrap(StatePassword, err)
+		}
+		return f.done(StatePassword)
+	})
+}
+
+// Back goes to the previous state. From Password and QR it goes to Phone,
+// the code or token is used up by then. There is no back from APIData and Done.
+func (f *Flow) Back() error {
+	if !f.stepMu.TryLock() {
+		return ErrWrongState
+	}
+	defer f.stepMu.Unlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch f.state {
+	case StatePhone:
+		f.state = StateAPIData
+	case StateCode, StatePassword, StateQR:
+		f.state = StatePhone
+		f.sent, f.expired, f.hint, f.qr, f.signedIn = nil, false, "", nil, false
+	default:
+		return ErrNoBack
+	}
+	return nil
+}
+
+// done saves the signed in account: from -> Done. If Save fails,
+// the flow stays in from, see [Flow.SignedIn].
+func (f *Flow) done(from State) (State, error) {
+	if err := f.b.Save(); err != nil {
+		f.mu.Lock()
+		f.signedIn = true
+		f.mu.Unlock()
+		return from, userError(from, "Signed in, but failed to save the account, try again: "+err.Error(), err)
+	}
+	f.mu.Lock()
+	f.signedIn = false
+	f.mu.Unlock()
+	return StateDone, nil
+}
+
+// setSent must be called with mu held.
+func (f *Flow) setSent(res *creator.SendCodeResponse) {
+	f.sent = res
+	f.sentAt = f.now()
+	f.expired = false
+}
+
+// step runs do if the flow is in state and moves it to the state do returns.
+func (f *Flow) step(state State, do func() (State, error)) error {
+	f.stepMu.Lock()
+	defer f.stepMu.Unlock()
+	if s := f.State(); s != state {
+		return fmt.Errorf("%w: %s", ErrWrongState, s)
+	}
+
+	next, err := do()
+	f.mu.Lock()
+	f.state = next
+	f.mu.Unlock()
+	return err
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/creator"
+	"github.com/mauzec/tdsoft/gui/internal/creator/creatortest"
+)
+
+const testPhone = "+100"
+
+// saveBackend fails Save with err.
+type saveBackend struct {
+	Backend
+	err error
+}
+
+func (b *saveBackend) Save() error {
+	return b.err
+}
+
+func newTestFlow(t *testing.T) (*Flow, *creatortest.Server) {
+	t.Helper()
+	s := creatortest.NewServer()
+	t.Cleanup(s.Close)
+	c := creator.New(s.URL, creator.WithRetries(0, 0))
+	return NewFlow(NewCreatorBackend(context.Background(), c)), s
+}
+
+// toState moves f from APIData to state, Code or Password.
+func toState(t *testing.T, f *Flow, state State) {
+	t.Helper()
+	if err := f.SubmitAPIData("1", "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if state == StatePhone {
+		return
+	}
+	if err := f.SubmitPhone(testPhone); err != nil {
+		t.Fatal(err)
+	}
+	if state == StateCode {
+		return
+	}
+	if err := f.SubmitCode(creatortest.DefaultCode); err != nil {
+		t.Fatal(err)
+	}
+	if f.State() != state {
+		t.Fatalf("state = %s, want %s", f.State(), state)
+	}
+}
+
+func TestFlowCode(t *testing.T) {
+	f, s := newTestFlow(t)
+	toState(t, f, StateCode)
+
+	err := f.SubmitCode("1")
+	if !errors.Is(err, creator.ErrPhoneCodeInvalid) || f.State() != StateCode {
+		t.Fatalf("err = %v, state = %s", err, f.State())
+	}
+	var ae *Error
+	if !errors.As(err, &ae) || ae.Message != messages[creator.ErrPhoneCodeInvalid.Code] {
+		t.Errorf("err = %#v", err)
+	}
+
+	if err := f.SubmitCode(creatortest.DefaultCode); err != nil {
+		t.Fatal(err)
+	}
+	if f.State() != StateDone || !s.SignedIn() {
+		t.Errorf("state = %s, signed in %v", f.State(), s.SignedIn())
+	}
+}
+
+func TestFlowBack(t *testing.T) {
+	tests := []struct {
+		from, to State
+	}{
+		{StatePhone, StateAPIData},
+		{StateCode, StatePhone},
+		{StatePassword, StatePhone},
+		{StateQR, StatePhone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from.String(), func(t *testing.T) {
+			f, s := newTestFlow(t)
+			s.SetPassword("pass", "hint")
+			switch tt.from {
+			case StateQR:
+				toState(t, f, StatePhone)
+				if err := f.StartQR(); err != nil {
+					t.Fatal(err)
+				}
+			default:
+				toState(t, f, tt.from)
+			}
+
+			if err := f.Back(); err != nil {
+				t.Fatal(err)
+			}
+			if f.State() != tt.to {
+				t.Errorf("state = %s, want %s", f.State(), tt.to)
+			}
+			if tt.to == StatePhone && (f.SentCode() != nil || f.PasswordHint() != "" || f.QRToken() != nil) {
+				t.Error("state of the step is kept")
+			}
+		})
+	}
+
+	f, _ := newTestFlow(t)
+	if err := f.Back(); !errors.Is(err, ErrNoBack) {
+		t.Errorf("back from api data: %v", err)
+	}
+	toState(t, f, StateCode)
+	if err := f.SubmitCode(creatortest.DefaultCode); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Back(); !errors.Is(err, ErrNoBack) {
+		t.Errorf("back from done: %v", err)
+	}
+}
+
+func TestFlowResendCode(t *testing.T) {
+	f, _ := newTestFlow(t)
+	now := time.Now()
+	f.now = func() time.Time { return now }
+	toState(t, f, StateCode)
+
+	if sent := f.SentCode(); sent.Type != "APP" || sent.NextType != "SMS" {
+		t.Errorf("sent = %+v", sent)
+	}
+	if wait := f.ResendIn(); wait != 60*time.Second {
+		t.Errorf("resend in %s, want 60s", wait)
+	}
+	now = now.Add(45 * time.Second)
+	if wait := f.ResendIn(); wait != 15*time.Second {
+		t.Errorf("resend in %s, want 15s", wait)
+	}
+	now = now.Add(time.Minute)
+	if wait := f.ResendIn(); wait != 0 {
+		t.Errorf("resend in %s, want 0", wait)
+	}
+
+	if err := f.ResendCode(); err != nil {
+		t.Fatal(err)
+	}
+	if sent := f.SentCode(); sent.Type != "SMS" || f.ResendIn() != 60*time.Second {
+		t.Errorf("sent = %+v, resend in %s", sent, f.ResendIn())
+	}
+	if err := f.ResendCode(); err != nil {
+		t.Fatal(err)
+	}
+	// the last way has no timeout
+	if sent := f.SentCode(); sent.Type != "CALL" || f.ResendIn() != 0 {
+		t.Errorf("sent = %+v, resend in %s", sent, f.ResendIn())
+	}
+	err := f.ResendCode()
+	if !errors.Is(err, creator.ErrSendCodeUnavailable) || f.State() != StateCode {
+		t.Errorf("err = %v, state = %s", err, f.State())
+	}
+}
+
+func TestFlowCodeExpired(t *testing.T) {
+	f, s := newTestFlow(t)
+	toState(t, f, StateCode)
+
+	s.FailNext("/sign_in", &creator.Error{
+		Code: creator.ErrPhoneCodeExpired.Code, Status: http.StatusBadRequest,
+	})
+	err := f.SubmitCode(creatortest.DefaultCode)
+	if !errors.Is(err, creator.ErrPhoneCodeExpired) || f.State() != StateCode {
+		t.Fatalf("err = %v, state = %s", err, f.State())
+	}
+	if !f.CodeExpired() {
+		t.Error("code is not expired")
+	}
+
+	if err := f.ResendCode(); err != nil {
+		t.Fatal(err)
+	}
+	if f.CodeExpired() {
+		t.Error("resent code is expired")
+	}
+	if err := f.SubmitCode(creatortest.DefaultCode); err != nil {
+		t.Fatal(err)
+	}
+	if f.State() != StateDone {
+		t.Errorf("state = %s", f.State())
+	}
+}
+
+func TestFlowPassword(t *testing.T) {
+	f, s := newTestFlow(t)
+	s.SetPassword("pass", "my hint")
+	toState(t, f, StatePassword)
+
+	if hint := f.PasswordHint(); hint != "my hint" {
+		t.Errorf("hint = %q, want %q", hint, "my hint")
+	}
+	err := f.SubmitPassword("wrong")
+	if !errors.Is(err, creator.ErrPasswordHashInvalid) || f.State() != StatePassword {
+		t.Fatalf("err = %v, state = %s", err, f.State())
+	}
+	if err := f.SubmitPassword("pass"); err != nil {
+		t.Fatal(err)
+	}
+	if f.State() != StateDone || !s.SignedIn() {
+		t.Errorf("state = %s, signed in %v", f.State(), s.SignedIn())
+	}
+}
+
+func TestFlowQRPassword(t *testing.T) {
+	f, s := newTestFlow(t)
+	s.SetPassword("pass", "qr hint")
+	toState(t, f, StatePhone)
+
+	if err := f.StartQR(); err != nil {
+		t.Fatal(err)
+	}
+	if f.State() != StateQR || f.QRToken() == nil {
+		t.Fatalf("state = %s, token %v", f.State(), f.QRToken())
+	}
+	s.AcceptQR()
+	if err := f.PollQR(); err != nil {
+		t.Fatal(err)
+	}
+	if f.State() != StatePassword || f.PasswordHint() != "qr hint" {
+		t.Errorf("state = %s, hint %q", f.State(), f.PasswordHint())
+	}
+}
+
+func TestFlowSaveFailed(t *testing.T) {
+	s := creatortest.NewServer()
+	defer s.Close()
+	c := creator.New(s.URL, creator.WithRetries(0, 0))
+	b := &saveBackend{Backend: NewCreatorBackend(context.Background(), c), err: errors.New("disk full")}
+	f := NewFlow(b)
+	toState(t, f, StateCode)
+
+	err := f.SubmitCode(creatortest.DefaultCode)
+	if err == nil || f.State() != StateCode || !f.SignedIn() {
+		t.Fatalf("err = %v, state = %s, signed in %v", err, f.State(), f.SignedIn())
+	}
+
+	// the code is not sent again, only the account is saved
+	b.err = nil
+	if err := f.SubmitCode(""); err != nil {
+		t.Fatal(err)
+	}
+	if f.State() != StateDone || f.SignedIn() {
+		t.Errorf("state = %s, signed in %v", f.State(), f.SignedIn())
+	}
+	if n := s.Calls("/sign_in"); n != 1 {
+		t.Errorf("sign_in calls = %d, want 1", n)
+	}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/mauzec/tdsoft/gui/internal/accounts"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"go.uber.org/zap"
+)
+
+// WithAccount runs the request with the account name
+// instead of the current one.
+func WithAccount(name string) RunOption {
+	return func(o *runOptions) {
+		o.account = name
+	}
+}
+
+func (cl *Client) Accounts() []accounts.Account {
+	return cl.accounts.List()
+}
+
+func (cl *Client) CurrentAccount() accounts.Account {
+	return cl.accounts.Current()
+}
+
+// Account returns the name of the account a run with opts uses.
+func (cl *Client) Account(opts ...RunOption) string {
+	var o runOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.account != "" {
+		return o.account
+	}
+	return cl.accounts.Current().Name
+}
+
+// account returns the account name, or the current one if name is empty.
+func (cl *Client) account(name string) (accounts.Account, error) {
+	if name == "" {
+		return cl.accounts.Current(), nil
+	}
+	a, ok := cl.accounts.Get(name)
+	if !ok {
+		return accounts.Account{}, accounts.ErrAccountNotFound
+	}
+	return a, nil
+}
+
+// CheckAccount returns [apperrors.ErrNeedAuth] if the account
+// has no session, or no API credentials when they are stored.
+func (cl *Client) CheckAccount(name string) error {
+	a, err := cl.account(name)
+	if err != nil {
+		return err
+	}
+	if !cl.sessions.HasSession(a.Session) {
+		return apperrors.ErrNeedAuth
+	}
+	if cl.prefs != nil && !a.HasCredentials() {
+		return apperrors.ErrNeedAuth
+	}
+	return nil
+}
+
+// SwitchAccount makes the account current. Login and requests without
+// [WithAccount] use it. Returns [apperrors.ErrNeedAuth] if the account
+// needs login, the account is switched anyway.
+func (cl *Client) SwitchAccount(name string) error {
+	if err := cl.accounts.SetCurrent(name); err != nil {
+		return err
+	}
+	cl.ExtLog.Info("account switched", zap.String("account", name))
+
+	err := cl.CheckAccount(name)
+	cl.NeedAuth = err != nil
+	return err
+}
+
+// AddAccount adds an account without session, it needs login.
+func (cl *Client) AddAccount(name string) (accounts.Account, error) {
+	a, err := cl.accounts.Add(strings.TrimSpace(name))
+	if err != nil {
+		return a, err
+	}
+	cl.ExtLog.Info("account added", zap.String("account", a.Name))
+	return a, nil
+}
+
+// Logout deletes the session and credentials of the account locally.
+// The session stays active on telegram, [Client.SignOut] logs it out there too.
+func (cl *Client) Logout(name string) error {
+	a, err := cl.account(name)
+	if err != nil {
+		return err
+	}
+	a.APIID, a.APIHash, a.Phone = "", "", ""
+	if err := cl.accounts.Update(a); err != nil {
+		return err
+	}
+	if a.Name == cl.accounts.Current().Name {
+		cl.NeedAuth = true
+	}
+	cl.ExtLog.Info("account logged out", zap.String("account", a.Name))
+	cl.closeWorkerSession(a.Session)
+	return cl.sessions.DeleteSession(a.Session)
+}
+
+// RemoveAccount logs out and forgets the account.
+func (cl *Client) RemoveAccount(name string) error {
+	if err := cl.Logout(name); err != nil {
+		return err
+	}
+	return cl.accounts.Remove(name)
+}
+
+// credentialsEnv returns the API credentials of the account name as
+// API_ID and API_HASH, scripts/config/config.py reads them. It is nil
+// if the account has none, then scripts read them from .env.
+func (cl *Client) credentialsEnv(name string) map[string]string {
+	a, err := cl.account(name)
+	if err != nil || !a.HasCredentials() {
+		return nil
+	}
+	return map[string]string{
+		"API_ID":   strings.TrimSpace(a.APIID),
+		"API_HASH": strings.TrimSpace(a.APIHash),
+	}
+}
+
+// acquireSession acquires the session of the account chosen by opts.
+// With the worker a plain session stays acquired after release, the worker
+// keeps its client connected, see [Client.holdSession].
+func (cl *Client) acquireSession(opts []RunOption) (string, func(), error) {
+	a, err := cl.account(cl.Account(opts...))
+	if err != nil {
+		return "", nil, err
+	}
+	if cl.cfg.Worker {
+		return cl.holdSession(a.Session)
+	}
+	return cl.sessions.AcquireSession(a.Session)
+}
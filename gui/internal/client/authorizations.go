@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"go.uber.org/zap"
+)
+
+// Authorization is an active session of the account on telegram's side,
+// e.g. this app, a phone or a web login.
+type Authorization struct {
+	Hash    int64
+	Current bool
+
+	DeviceModel   string
+	Platform      string
+	SystemVersion string
+	AppName       string
+	AppVersion    string
+	IP            string
+	Country       string
+
+	Created time.Time
+	Active  time.Time
+}
+
+// parseAuthorization converts an AUTHORIZATION message of scripts/sessions.py.
+func parseAuthorization(pm *PyMsg) (Authorization, error) {
+	str := func(key string) string {
+		s, _ := pm.Details[key].(string)
+		return s
+	}
+	hash, err := strconv.ParseInt(str("hash"), 10, 64)
+	if err != nil {
+		return Authorization{}, err
+	}
+	current, _ := pm.Details["current"].(bool)
+	return Authorization{
+		Hash:          hash,
+		Current:       current,
+		DeviceModel:   str("device_model"),
+		Platform:      str("platform"),
+		SystemVersion: str("system_version"),
+		AppName:       str("app_name"),
+		AppVersion:    str("app_version"),
+		IP:            str("ip"),
+		Country:       str("country"),
+		Created:       time.Unix(int64(detailInt(pm.Details, "date_created")), 0),
+		Active:        time.Unix(int64(detailInt(pm.Details, "date_active")), 0),
+	}, nil
+}
+
+// Authorizations lists the active sessions of the account chosen by opts,
+// the current one first, then the recently active ones.
+func (cl *Client) Authorizations(ctx context.Context, opts ...RunOption) ([]Authorization, error) {
+	var auths []Authorization
+	onOut := func(t string, pm *PyMsg) {
+		if pm == nil || pm.Code != "AUTHORIZATION" {
+			return
+		}
+		a, err := parseAuthorization(pm)
+		if err != nil {
+			cl.ExtLog.Warn("bad authorization", zap.Any("details", pm.Details), zap.Error(err))
+			return
+		}
+		auths = append(auths, a)
+	}
+	if err := cl.runTool(ctx, opts, "sessions.py", []string{"list"}, onOut); err != nil {
+		cl.ExtLog.Error("failed to list authorizations", zap.Error(err))
+		return nil, err
+	}
+	slices.SortStableFunc(auths, func(a, b Authorization) int {
+		switch {
+		case a.Current != b.Current:
+			if a.Current {
+				return -1
+			}
+			return 1
+		default:
+			return b.Active.Compare(a.Active)
+		}
+	})
+	return auths, nil
+}
+
+// TerminateAuthorization terminates the session with hash of the account
+// chosen by opts. The current session can't be terminated, use [Client.SignOut].
+func (cl *Client) TerminateAuthorization(ctx context.Context, hash int64, opts ...RunOption) error {
+	// hashes may be negative, they must not look like a flag
+	args := []string{"terminate", "--hash=" + strconv.FormatInt(hash, 10)}
+	if err := cl.runTool(ctx, opts, "sessions.py", args, nil); err != nil {
+		cl.ExtLog.Error("failed to terminate authorization", zap.Int64("hash", hash), zap.Error(err))
+		return err
+	}
+	cl.ExtLog.Info("authorization terminated", zap.Int64("hash", hash))
+	return nil
+}
+
+// TerminateOtherAuthorizations terminates all sessions of the account chosen
+// by opts but the current one. Telegram forbids it for sessions younger than
+// a day: [apperrors.ErrFreshResetForbidden].
+func (cl *Client) TerminateOtherAuthorizations(ctx context.Context, opts ...RunOption) error {
+	if err := cl.runTool(ctx, opts, "sessions.py", []string{"terminate_others"}, nil); err != nil {
+		cl.ExtLog.Error("failed to terminate other authorizations", zap.Error(err))
+		return err
+	}
+	cl.ExtLog.Info("other authorizations terminated")
+	return nil
+}
+
+// SignOut logs out the session of the account name on telegram's side,
+// then deletes it locally with [Client.Logout]. A session already revoked
+// is only deleted locally. If telegram can't be reached, nothing is deleted.
+func (cl *Client) SignOut(ctx context.Context, name string) error {
+	a, err := cl.account(name)
+	if err != nil {
+		return err
+	}
+	if cl.sessions.HasSession(a.Session) {
+		err = cl.runTool(ctx, []RunOption{WithAccount(a.Name)}, "sessions.py", []string{"log_out"}, nil)
+		if err != nil && !errors.Is(err, apperrors.ErrSessionRevoked) {
+			cl.ExtLog.Error("failed to sign out", zap.String("account", a.Name), zap.Error(err))
+			return err
+		}
+		cl.ExtLog.Info("signed out", zap.String("account", a.Name))
+	}
+	return cl.Logout(a.Name)
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+var (
+	ErrNotResumable = errors.New("request can't be resumed")
+	ErrNoCheckpoint = errors.New("no checkpoint for the output")
+)
+
+// Checkpoint is the last state a script reported with CHECKPOINT, e.g. the
+// last message id or the number of members seen. It is kept next to the
+// output while the run is not done, see [CheckpointPath].
+type Checkpoint struct {
+	Kind      string         `json:"kind"`
+	JobID     string         `json:"job_id,omitempty"`
+	Account   string         `json:"account,omitempty"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	State     map[string]any `json:"state"`
+}
+
+// Checkpointed is a request that can continue from a [Checkpoint].
+type Checkpointed interface {
+	Request
+
+	// FromCheckpoint returns a copy of the request that resumes from
+	// the checkpoint file and appends to the output.
+	FromCheckpoint(path string) Request
+}
+
+// CheckpointPath returns the checkpoint file of the output.
+func CheckpointPath(output string) string {
+	return output + ".checkpoint.json"
+}
+
+// LoadCheckpoint reads the checkpoint of the output.
+// Returns [ErrNoCheckpoint] if there is none.
+func LoadCheckpoint(output string) (*Checkpoint, error) {
+	data, err := os.ReadFile(CheckpointPath(output))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoCheckpoint
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	return &cp, nil
+}
+
+// HasCheckpoint reports whether the output has a checkpoint to resume from.
+func HasCheckpoint(output string) bool {
+	_, err := os.Stat(CheckpointPath(output))
+	return err == nil
+}
+
+// ResumeRequest returns a copy of req that continues from the checkpoint
+// of its output instead of starting over.
+func ResumeRequest(req Request) (Request, error) {
+	r, ok := req.(Checkpointed)
+	if !ok {
+		return nil, ErrNotResumable
+	}
+	if _, err := LoadCheckpoint(req.OutputPath()); err != nil {
+		return nil, err
+	}
+	return r.FromCheckpoint(CheckpointPath(req.OutputPath())), nil
+}
+
+// saveCheckpoint writes the checkpoint of the output atomically,
+// so a crash doesn't leave a broken file.
+func saveCheckpoint(output string, cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	path := CheckpointPath(output)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error when writing temp file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error when renaming temp file: %w", err)
+	}
+	return nil
+}
+
+func removeCheckpoint(output string) error {
+	err := os.Remove(CheckpointPath(output))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
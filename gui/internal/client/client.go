@@ -2,30 +2,32 @@ package client
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
-	"net/url"
-	"os"
-	"os/exec"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
-	"fyne.io/fyne/v2"
+	"github.com/mauzec/tdsoft/gui/internal/accounts"
 	"github.com/mauzec/tdsoft/gui/internal/config"
+	"github.com/mauzec/tdsoft/gui/internal/creator"
 	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
 	"github.com/mauzec/tdsoft/gui/internal/preferences"
 	"go.uber.org/zap"
 )
 
+// creatorCallTimeout limits a login step with its retries.
+const creatorCallTimeout = 15 * time.Second
+
 type Client struct {
+	// APIID, APIHash and Phone are entered during login,
+	// they are saved to the current account by SaveAPIConfig.
 	APIID    string
 	APIHash  string
+	Phone    string
 	NeedAuth bool
 
-	creatorCmd *exec.Cmd
+	creator *creatorSupervisor
 
 	UserLogF func(string)
 	ExtLog   *zap.Logger
@@ -33,29 +35,61 @@ type Client struct {
 	defaultPyOutHandlers map[string]OutHandler
 	defaultPyErrHandlers map[string]ErrHandler
 
-	cfg   *config.AppConfig
-	prefs fyne.Preferences
+	unknownMu    sync.Mutex
+	unknownCodes map[string]int
+
+	journal *Journal
+
+	workerMu     sync.Mutex
+	worker       *worker
+	heldSessions map[string]*heldSession
+
+	cfg      *config.AppConfig
+	prefs    preferences.SettingsStore
+	sessions SessionStore
+	accounts *accounts.Registry
 }
 
-func NewClient(extendedLogger *zap.Logger, appCfg *config.AppConfig, a fyne.App) (*Client, error) {
-	cl := &Client{}
+// NewClient creates a client. prefs keeps accounts and their API credentials,
+// it may be nil for headless use: then accounts are kept in memory and only
+// the session file is required. If prefs is a [SessionStore], sessions are
+// kept there.
+//
+// Returns [apperrors.ErrNeedAuth] with the client if the current account needs login.
+func NewClient(extendedLogger *zap.Logger, appCfg *config.AppConfig, prefs preferences.SettingsStore) (*Client, error) {
+	cl := &Client{heldSessions: make(map[string]*heldSession)}
 	cl.cfg = appCfg
+	if appCfg.JournalPath != "" {
+		cl.journal = NewJournal(appCfg.JournalPath)
+	}
 	if extendedLogger == nil {
 		return cl, apperrors.ErrExtendedLoggerNotProvided
 	}
 	cl.ExtLog = extendedLogger
+	cl.creator = newCreatorSupervisor(cl)
 
-	if a == nil {
-		return cl, errors.New("fyne.App=nil provided")
+	cl.prefs = prefs
+	cl.sessions = plainSessions{}
+	if ss, ok := prefs.(SessionStore); ok {
+		cl.sessions = ss
 	}
-	cl.prefs = a.Preferences()
+
+	var store preferences.SettingsStore = preferences.NewMemoryStore()
+	if prefs != nil {
+		store = prefs
+	}
+	reg, err := accounts.Load(store, appCfg.Session)
+	if err != nil {
+		return cl, err
+	}
+	cl.accounts = reg
 
 	cl.defaultPyOutHandlers = map[string]OutHandler{
 		"FLOOD_WAIT": func(t string, pm *PyMsg) {
 			cl.ExtLog.Warn("flood wait", zap.Any("details", pm.Details))
 			_ = cl.UserLog(2, fmt.Sprintf(
 				"Flood wait: %v seconds, program will pause. You can stop it, data has been saved",
-				pm.Details["seconds"]))
+				pm.Details["value"]))
 		},
 		"CSV_FLUSH_ERROR": func(t string, pm *PyMsg) {
 			cl.ExtLog.Warn("csv flush error", zap.Any("details", pm.Details))
@@ -72,6 +106,11 @@ func NewClient(extendedLogger *zap.Logger, appCfg *config.AppConfig, a fyne.App)
 		"SCRIPT_STARTED": func(t string, pm *PyMsg) {
 			cl.ExtLog.Info("script started", zap.Any("details", pm.Details))
 		},
+		"PROGRESS": func(t string, pm *PyMsg) {
+			cl.ExtLog.Debug("progress", zap.Any("details", pm.Details))
+		},
+		// saved by runPy
+		"CHECKPOINT": func(t string, pm *PyMsg) {},
 	}
 	cl.defaultPyErrHandlers = map[string]ErrHandler{
 		"SCRIPT_UNCAUGHT_ERROR": func(pm *PyMsg) {
@@ -96,291 +135,173 @@ func NewClient(extendedLogger *zap.Logger, appCfg *config.AppConfig, a fyne.App)
 		"NO_SESSION": func(pm *PyMsg) {
 			cl.ExtLog.Error("no session provided", zap.Any("details", pm.Details))
 		},
+		"FLOOD_WAIT_TOO_LONG": func(pm *PyMsg) {
+			cl.ExtLog.Warn("flood wait too long", zap.Any("details", pm.Details))
+			_ = cl.UserLog(2, fmt.Sprintf(
+				"Flood wait of %v seconds is longer than %v, stopped. Data has been saved",
+				pm.Details["value"], pm.Details["max"]))
+		},
 	}
 
-	APIID := strings.TrimSpace(cl.prefs.String(preferences.KeyTGAPIID))
-	APIHash := strings.TrimSpace(cl.prefs.String(preferences.KeyTGAPIHash))
-	if _, err := os.Stat(appCfg.Session + ".session"); err != nil ||
-		cl.cfg.ForceAuth || APIID == "" || APIHash == "" {
+	if err := cl.CheckAccount(""); err != nil || cl.cfg.ForceAuth {
 		cl.NeedAuth = true
-		_ = os.Remove(cl.cfg.Session + ".session")
+		_ = cl.sessions.DeleteSession(reg.Current().Session)
 		return cl, apperrors.ErrNeedAuth
 	}
 
 	return cl, nil
 }
 
-func (cl *Client) DeleteSession() error {
-	cl.prefs.SetString(preferences.KeyTGAPIID, "")
-	cl.prefs.SetString(preferences.KeyTGAPIHash, "")
-	cl.prefs.SetString(preferences.KeyTGPhone, "")
-
-	_ = os.Remove(cl.cfg.Session + ".session")
-	return nil
-}
-
-func (cl *Client) GetDialogs() error {
-	// TODO:
-	return nil
+// Session returns the session name of the account a run with opts uses.
+func (cl *Client) Session(opts ...RunOption) string {
+	a, _ := cl.account(cl.Account(opts...))
+	return a.Session
 }
 
-func (cl *Client) CheckConnection() (context.Context, error) {
-	// TODO:
-	return context.Background(), nil
+// DeleteSession deletes the session of the current account locally,
+// see [Client.Logout]. It stays active on telegram, see [Client.SignOut].
+func (cl *Client) DeleteSession() error {
+	return cl.Logout("")
 }
 
+// SaveAPIConfig saves credentials entered during login to the current account.
 func (cl *Client) SaveAPIConfig() error {
-	cl.prefs.SetString(preferences.KeyTGAPIID, strings.TrimSpace(cl.APIID))
-	cl.prefs.SetString(preferences.KeyTGAPIHash, strings.TrimSpace(cl.APIHash))
-	return nil
-}
-
-func (cl *Client) StartCreatorServer() error {
-	wait := func(timeout time.Duration) error {
-		dl := time.Now().Add(timeout)
-		for time.Now().Before(dl) {
-			if err := cl.pingCreatorServer(); err == nil {
-				return nil // server is good
-			}
-			time.Sleep(50 * time.Millisecond)
-		}
-		return apperrors.ErrCreatorWaitTimeout
-	}
-
-	cmd := exec.Command(cl.cfg.VenvPath+"/bin/python3", cl.cfg.ScriptsPath+"/connect.py")
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
-	logf, _ := os.OpenFile(cl.cfg.LogPath+"/creator_server.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	cmd.Stdout = logf
-	cmd.Stderr = logf
-	if err := cmd.Start(); err != nil {
-		return err
+	a := cl.accounts.Current()
+	a.APIID = strings.TrimSpace(cl.APIID)
+	a.APIHash = strings.TrimSpace(cl.APIHash)
+	if cl.Phone != "" {
+		a.Phone = cl.Phone
 	}
-	cl.creatorCmd = cmd
-
-	err := wait(5 * time.Second)
-	if err != nil {
-		_ = cl.StopCreatorServer()
-		return err
-	}
-
-	err = cl.sendSessionPath()
-	if err != nil {
-		_ = cl.StopCreatorServer()
+	if err := cl.accounts.Update(a); err != nil {
 		return err
 	}
-	cl.ExtLog.Info("creator server started", zap.Int("pid", cmd.Process.Pid))
-
+	cl.NeedAuth = false
 	return nil
 }
 
-func (cl *Client) StopCreatorServer() error {
-	if cl.creatorCmd == nil || cl.creatorCmd.Process == nil {
-		return nil
-	}
-
-	// try gracefu http shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, "GET", cl.cfg.CreatorURI+"/shutdown", nil)
-	if _, err := http.DefaultClient.Do(req); err != nil {
-		cl.ExtLog.Warn("creator server shutdown HTTP failed, proceeding to signal", zap.Error(err))
-	}
-
-	waitCh := make(chan error, 1)
-	go func() {
-		waitCh <- cl.creatorCmd.Wait()
-	}()
-
-	pgid := -cl.creatorCmd.Process.Pid
-	_ = syscall.Kill(pgid, syscall.SIGINT)
-
-	select {
-	case err := <-waitCh:
-		cl.creatorCmd = nil
-		return err
-	case <-time.After(3 * time.Second):
-		_ = syscall.Kill(pgid, syscall.SIGKILL)
-		err := <-waitCh
-		cl.creatorCmd = nil
-		if err != nil {
-			return err
-		}
-		return nil
+// newCreatorClient returns the client of the creator server at uri.
+func newCreatorClient(cfg *config.AppConfig, uri string, log *zap.Logger) *creator.Client {
+	opts := []creator.Option{creator.WithTimeout(cfg.CreatorTimeout), creator.WithLogger(log)}
+	if cfg.CreatorRetries != nil {
+		opts = append(opts, creator.WithRetries(*cfg.CreatorRetries, 0))
 	}
+	return creator.New(uri, opts...)
 }
 
-func (cl *Client) sendSessionPath() error {
-	if err := cl.pingCreatorServer(); err != nil {
-		return err
-	}
+// creatorContext returns the context of a login step,
+// it covers all retries of the call.
+func creatorContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), creatorCallTimeout)
+}
 
-	v := url.Values{}
-	v.Set("path", "../"+cl.cfg.Session)
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (cl *Client) SendAPIData() error {
+	ctx, cancel := creatorContext()
 	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, "POST", cl.cfg.CreatorURI+"/session_path?"+v.Encode(), nil)
-	resp, err := http.DefaultClient.Do(req)
+	api, err := cl.creator.client(ctx)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	res := map[string]string{}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return err
-	}
-	if errMsg, ok := res["error"]; ok {
-		return fmt.Errorf("send session path error: %s", errMsg)
+	req := creator.APIDataRequest{APIID: cl.APIID, APIHash: cl.APIHash}
+	res, err := api.SendAPIData(ctx, req)
+	if err != nil {
+		return fmt.Errorf("send api data: %w", err)
 	}
-
-	cl.ExtLog.Info("/session_path response", zap.Any("response", res))
-
+	// sent again if the server is restarted
+	cl.creator.setAPIData(req)
+	cl.ExtLog.Info("/api_data response", zap.String("message", res.Message), zap.String("session", res.Session))
 	return nil
 }
 
-func (cl *Client) SendAPIData() error {
-	if err := cl.pingCreatorServer(); err != nil {
-		return err
-	}
-
-	v := url.Values{}
-	v.Set("api_id", cl.APIID)
-	v.Set("api_hash", cl.APIHash)
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// SendPhone sends the login code to phone.
+func (cl *Client) SendPhone(phone string) (*creator.SendCodeResponse, error) {
+	ctx, cancel := creatorContext()
 	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, "POST", cl.cfg.CreatorURI+"/api_data?"+v.Encode(), nil)
-	resp, err := http.DefaultClient.Do(req)
+	api, err := cl.creator.client(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	res := map[string]string{}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return err
-	}
-	if errMsg, ok := res["error"]; ok {
-		return fmt.Errorf("send api data error: %s", errMsg)
+	res, err := api.SendCode(ctx, phone)
+	if err != nil {
+		return nil, fmt.Errorf("send phone: %w", err)
 	}
-
-	cl.ExtLog.Info("/api_data response", zap.Any("response", res))
-
-	return nil
+	cl.ExtLog.Info("/send_code response", zap.String("message", res.Message),
+		zap.String("type", res.Type), zap.String("next_type", res.NextType))
+	cl.Phone = phone
+	return res, nil
 }
 
-func (cl *Client) SendPhone(phone string) error {
-	if err := cl.pingCreatorServer(); err != nil {
-		return err
-	}
-
-	v := url.Values{}
-	v.Set("phone", phone)
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// ResendCode sends the login code to the phone of [Client.SendPhone] again,
+// usually another way, e.g. by a call.
+func (cl *Client) ResendCode() (*creator.SendCodeResponse, error) {
+	ctx, cancel := creatorContext()
 	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, "POST", cl.cfg.CreatorURI+"/send_code?"+v.Encode(), nil)
-	resp, err := http.DefaultClient.Do(req)
+	api, err := cl.creator.client(ctx)
 	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	res := map[string]string{}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return err
+		return nil, err
 	}
-	if errMsg, ok := res["error"]; ok {
-		return fmt.Errorf("send phone error: %s", errMsg)
+	res, err := api.ResendCode(ctx, cl.Phone)
+	if err != nil {
+		return nil, fmt.Errorf("resend code: %w", err)
 	}
-
-	cl.ExtLog.Info("/send_code response", zap.Any("response", res))
-
-	return nil
+	cl.ExtLog.Info("/resend_code response", zap.String("message", res.Message),
+		zap.String("type", res.Type), zap.String("next_type", res.NextType))
+	return res, nil
 }
 
+// SignIn returns [apperrors.ErrPasswordNeeded] if the account has 2FA,
+// then the password is checked with [Client.CheckPassword]. The error
+// has the password hint, see [creator.PasswordHint].
 func (cl *Client) SignIn(phone, code string) error {
-	if err := cl.pingCreatorServer(); err != nil {
-		return err
-	}
-
-	v := url.Values{}
-	v.Set("phone", phone)
-	v.Set("code", code)
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := creatorContext()
 	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, "POST", cl.cfg.CreatorURI+"/sign_in?"+v.Encode(), nil)
-	resp, err := http.DefaultClient.Do(req)
+	api, err := cl.creator.client(ctx)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	res := map[string]string{}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return err
+	err = api.SignIn(ctx, creator.SignInRequest{Phone: phone, Code: code})
+	if errors.Is(err, creator.ErrPasswordNeeded) {
+		return fmt.Errorf("%w: %w", apperrors.ErrPasswordNeeded, err)
 	}
-	if errMsg, ok := res["error"]; ok {
-		if strings.HasPrefix(errMsg, "password") {
-			return apperrors.ErrPasswordNeeded
-		}
-		return fmt.Errorf("sign in error: %s", errMsg)
+	if err != nil {
+		return fmt.Errorf("sign in: %w", err)
 	}
-
-	cl.ExtLog.Info("/sign_in response", zap.Any("response", res))
-
+	cl.ExtLog.Info("signed in")
 	return nil
 }
 
-func (cl *Client) CheckPassword(password string) error {
-	if err := cl.pingCreatorServer(); err != nil {
-		return err
-	}
-
-	v := url.Values{}
-	v.Set("password", password)
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// QRLogin polls the QR login, see [creator.Client.QRLogin]. Like [Client.SignIn],
+// it returns [apperrors.ErrPasswordNeeded] if the account has 2FA.
+func (cl *Client) QRLogin() (*creator.QRLoginResponse, error) {
+	ctx, cancel := creatorContext()
 	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, "POST", cl.cfg.CreatorURI+"/check_password?"+v.Encode(), nil)
-	resp, err := http.DefaultClient.Do(req)
+	api, err := cl.creator.client(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	res := map[string]string{}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return err
+	res, err := api.QRLogin(ctx)
+	if errors.Is(err, creator.ErrPasswordNeeded) {
+		return nil, fmt.Errorf("%w: %w", apperrors.ErrPasswordNeeded, err)
 	}
-	if errMsg, ok := res["error"]; ok {
-		return fmt.Errorf("check password error: %s", errMsg)
+	if err != nil {
+		return nil, fmt.Errorf("qr login: %w", err)
 	}
-
-	cl.ExtLog.Info("/check_password response", zap.Any("response", res))
-
-	return nil
+	if res.Status == creator.QRSuccess {
+		cl.ExtLog.Info("signed in with qr code")
+	}
+	return res, nil
 }
 
-func (cl *Client) pingCreatorServer() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+func (cl *Client) CheckPassword(password string) error {
+	ctx, cancel := creatorContext()
 	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, "GET", cl.cfg.CreatorURI+"/ping?message=ping", nil)
-	resp, err := http.DefaultClient.Do(req)
+	api, err := cl.creator.client(ctx)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return apperrors.ErrCreatorPingError
-	}
-
-	res := map[string]string{}
-	err = json.NewDecoder(resp.Body).Decode(&res)
-	if err != nil {
-		return apperrors.ErrCreatorPingError
-	}
-	if res["message"] != "pong" {
-		return apperrors.ErrCreatorPingError
+	if err := api.CheckPassword(ctx, password); err != nil {
+		return fmt.Errorf("check password: %w", err)
 	}
+	cl.ExtLog.Info("signed in with password")
 	return nil
 }
 
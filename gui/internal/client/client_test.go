@@ -0,0 +1,77 @@
+package client
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mauzec/tdsoft/gui/internal/config"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"github.com/mauzec/tdsoft/gui/internal/preferences"
+	"go.uber.org/zap"
+)
+
+// newTestStore returns a store with the credentials of the default account
+// and the config with its session in a temp dir, the session file is created.
+func newTestStore(t *testing.T) (*preferences.MemoryStore, *config.AppConfig) {
+	t.Helper()
+	cfg := &config.AppConfig{Session: filepath.Join(t.TempDir(), "first")}
+	if err := os.WriteFile(cfg.Session+".session", []byte("session"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	prefs := preferences.NewMemoryStore()
+	prefs.SetString(preferences.KeyTGAPIID, "1")
+	prefs.SetString(preferences.KeyTGAPIHash, "hash")
+	return prefs, cfg
+}
+
+func TestNewClient(t *testing.T) {
+	prefs, cfg := newTestStore(t)
+	cl, err := NewClient(zap.NewNop(), cfg, prefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.NeedAuth {
+		t.Error("client needs auth")
+	}
+	if a := cl.CurrentAccount(); a.Name != "first" || a.APIID != "1" {
+		t.Errorf("account = %+v", a)
+	}
+}
+
+func TestNewClientNeedAuth(t *testing.T) {
+	// no credentials
+	_, cfg := newTestStore(t)
+	cl, err := NewClient(zap.NewNop(), cfg, preferences.NewMemoryStore())
+	if !errors.Is(err, apperrors.ErrNeedAuth) {
+		t.Fatalf("err = %v, want %v", err, apperrors.ErrNeedAuth)
+	}
+	if cl == nil || !cl.NeedAuth {
+		t.Error("client doesn't need auth")
+	}
+
+	// no session
+	prefs, cfg := newTestStore(t)
+	if err := os.Remove(cfg.Session + ".session"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewClient(zap.NewNop(), cfg, prefs); !errors.Is(err, apperrors.ErrNeedAuth) {
+		t.Errorf("err = %v, want %v", err, apperrors.ErrNeedAuth)
+	}
+}
+
+func TestNewClientForceAuth(t *testing.T) {
+	prefs, cfg := newTestStore(t)
+	cfg.ForceAuth = true
+	cl, err := NewClient(zap.NewNop(), cfg, prefs)
+	if !errors.Is(err, apperrors.ErrNeedAuth) {
+		t.Fatalf("err = %v, want %v", err, apperrors.ErrNeedAuth)
+	}
+	if !cl.NeedAuth {
+		t.Error("client doesn't need auth")
+	}
+	if _, err := os.Stat(cfg.Session + ".session"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("session is not deleted: %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package client
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// CodeInfo declares a code scripts may emit.
+type CodeInfo struct {
+	Code string
+
+	// Level is the envelope level: INFO, WARN, LOG, PROGRESS or ERROR.
+	Level string
+
+	// Message is a generic user message shown when the code
+	// has no dedicated handler. May be empty.
+	Message string
+}
+
+var (
+	codesMu sync.RWMutex
+	codes   = map[string]CodeInfo{}
+)
+
+// RegisterCode declares a script code. Declared codes without a dedicated
+// handler are shown to the user with their generic message.
+func RegisterCode(info CodeInfo) {
+	codesMu.Lock()
+	defer codesMu.Unlock()
+	codes[info.Code] = info
+}
+
+func LookupCode(code string) (CodeInfo, bool) {
+	codesMu.RLock()
+	defer codesMu.RUnlock()
+	info, ok := codes[code]
+	return info, ok
+}
+
+// RegisteredCodes returns all declared codes, sorted.
+func RegisteredCodes() []string {
+	codesMu.RLock()
+	defer codesMu.RUnlock()
+	out := make([]string, 0, len(codes))
+	for c := range codes {
+		out = append(out, c)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func init() {
+	for _, info := range []CodeInfo{
+		{Code: "SCRIPT_STARTED", Level: "INFO"},
+		{Code: "ALL_DONE", Level: "INFO", Message: "All done"},
+		{Code: "PROGRESS", Level: "PROGRESS"},
+		{Code: "MEMBERS_FETCHED", Level: "INFO"},
+		{Code: "MEMBERS_FROM_MESSAGES_FETCHED", Level: "INFO"},
+		{Code: "MESSAGES_FETCHED", Level: "INFO"},
+		{Code: "FLOOD_WAIT", Level: "WARN", Message: "Flood wait, program will pause"},
+		{Code: "CSV_FLUSH_ERROR", Level: "WARN", Message: "Detected error writing to file"},
+		{Code: "CHECKPOINT", Level: "LOG"},
+		{Code: "COLUMNS", Level: "LOG"},
+		{Code: "RECORD", Level: "LOG"},
+		{Code: "SESSION_OK", Level: "INFO", Message: "Session is authorized"},
+		{Code: "AUTHORIZATION", Level: "INFO"},
+		{Code: "LOGGED_OUT", Level: "INFO", Message: "Logged out"},
+		{Code: "TERMINATED", Level: "INFO", Message: "Session terminated"},
+
+		{Code: "SCRIPT_UNCAUGHT_ERROR", Level: "ERROR", Message: "something went wrong"},
+		{Code: "TASK_CANCELLED", Level: "ERROR", Message: "task cancelled by system"},
+		{Code: "RPC_ERROR", Level: "ERROR", Message: "API error"},
+		{Code: "UNEXPECTED_ERROR", Level: "ERROR", Message: "unexpected error occurred"},
+		{Code: "ARGPARSE_ERROR", Level: "ERROR", Message: "bad script arguments"},
+		{Code: "NO_SESSION", Level: "ERROR", Message: "no session provided"},
+		{Code: "MEMBERS_LIMIT_TOO_HIGH", Level: "ERROR", Message: "limit too high"},
+		{Code: "MESSAGE_LIMIT_TOO_HIGH", Level: "ERROR", Message: "messages limit too high"},
+		{Code: "INVALID_CHAT_NAME", Level: "ERROR", Message: "invalid chat name"},
+		{Code: "INVITE_LINK_NOT_SUPPORTED", Level: "ERROR", Message: "invite link not supported yet"},
+		{Code: "INVALID_USERNAME", Level: "ERROR", Message: "invalid username"},
+		{Code: "FROM_DATE_REQUIRED", Level: "ERROR", Message: "start date is required"},
+		{Code: "TO_DATE_REQUIRED", Level: "ERROR", Message: "end date is required"},
+		{Code: "FROM_DATE_INVALID", Level: "ERROR", Message: "invalid from date format, use MM/DD/YYYY"},
+		{Code: "TO_DATE_INVALID", Level: "ERROR", Message: "invalid to date format, use MM/DD/YYYY"},
+		{Code: "FLOOD_WAIT_TOO_LONG", Level: "ERROR", Message: "flood wait is too long, stopped"},
+		{Code: "CHECKPOINT_INVALID", Level: "ERROR", Message: "broken checkpoint file"},
+		{Code: "SESSION_REVOKED", Level: "ERROR", Message: "session is revoked, log in again"},
+		{Code: "CONNECTION_FAILED", Level: "ERROR", Message: "failed to connect to telegram"},
+		{Code: "AUTHORIZATION_HASH_REQUIRED", Level: "ERROR", Message: "session hash is required"},
+		{Code: "FRESH_RESET_FORBIDDEN", Level: "ERROR", Message: "session is too new to terminate other sessions"},
+	} {
+		RegisterCode(info)
+	}
+}
+
+var (
+	// io.message(f, 'error', 'CODE', ...) and message(...) inside utils/io.py
+	scriptMessageRe = regexp.MustCompile(`message\(\s*[^,()]+,\s*['"]\w+['"]\s*,\s*['"]([A-Z][A-Z0-9_]*)['"]`)
+	// raw envelopes, e.g. {'code': 'CSV_FLUSH_ERROR', ...}
+	scriptRawCodeRe = regexp.MustCompile(`['"]code['"]\s*:\s*['"]([A-Z][A-Z0-9_]*)['"]`)
+)
+
+// ScriptCodes returns sorted codes emitted by python scripts under dir.
+func ScriptCodes(dir string) ([]string, error) {
+	found := map[string]struct{}{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".py") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		data = stripPyComments(data)
+		for _, re := range []*regexp.Regexp{scriptMessageRe, scriptRawCodeRe} {
+			for _, m := range re.FindAllSubmatch(data, -1) {
+				found[string(m[1])] = struct{}{}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(found))
+	for c := range found {
+		out = append(out, c)
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// stripPyComments drops whole-line python comments,
+// so commented out messages are not reported.
+func stripPyComments(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+	kept := lines[:0]
+	for _, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "#") {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return []byte(strings.Join(kept, "\n"))
+}
+
+// UnregisteredScriptCodes returns codes emitted by scripts under dir
+// that are not declared with [RegisterCode].
+func UnregisteredScriptCodes(dir string) ([]string, error) {
+	emitted, err := ScriptCodes(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, c := range emitted {
+		if _, ok := LookupCode(c); !ok {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// fallbackOut handles output codes that have no dedicated handler.
+func (cl *Client) fallbackOut(t string, pm *PyMsg) {
+	info, known := LookupCode(pm.Code)
+	if !known {
+		cl.countUnknownCode(pm.Code)
+		cl.ExtLog.Warn("unknown code from python",
+			zap.String("level", t), zap.String("code", pm.Code),
+			zap.Any("details", pm.Details))
+	} else {
+		cl.ExtLog.Info("unhandled code from python",
+			zap.String("level", t), zap.String("code", pm.Code),
+			zap.Any("details", pm.Details))
+	}
+
+	msg := info.Message
+	if msg == "" {
+		msg = strings.ToLower(strings.ReplaceAll(pm.Code, "_", " "))
+	}
+	switch t {
+	case "WARN":
+		_ = cl.UserLog(2, msg)
+	case "INFO":
+		_ = cl.UserLog(1, msg)
+	}
+}
+
+// fallbackErr handles error codes that have no dedicated handler.
+func (cl *Client) fallbackErr(pm *PyMsg) {
+	info, known := LookupCode(pm.Code)
+	if !known {
+		cl.countUnknownCode(pm.Code)
+		cl.ExtLog.Error("unknown error code from python",
+			zap.String("code", pm.Code), zap.Any("details", pm.Details))
+	} else {
+		cl.ExtLog.Error("unhandled error code from python",
+			zap.String("code", pm.Code), zap.Any("details", pm.Details))
+	}
+
+	msg := info.Message
+	if msg == "" {
+		msg = "script error " + pm.Code
+	}
+	_ = cl.UserLog(3, msg)
+}
+
+func (cl *Client) countUnknownCode(code string) {
+	cl.unknownMu.Lock()
+	defer cl.unknownMu.Unlock()
+	if cl.unknownCodes == nil {
+		cl.unknownCodes = map[string]int{}
+	}
+	cl.unknownCodes[code]++
+}
+
+// UnknownCodes returns how many times each undeclared code was received.
+func (cl *Client) UnknownCodes() map[string]int {
+	cl.unknownMu.Lock()
+	defer cl.unknownMu.Unlock()
+	out := make(map[string]int, len(cl.unknownCodes))
+	for c, n := range cl.unknownCodes {
+		out[c] = n
+	}
+	return out
+}
@@ -0,0 +1,13 @@
+package client
+
+import "testing"
+
+func TestScriptCodesRegistered(t *testing.T) {
+	codes, err := UnregisteredScriptCodes("../../../scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) > 0 {
+		t.Errorf("codes emitted by scripts but not registered: %v", codes)
+	}
+}
@@ -0,0 +1,526 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/creator"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"go.uber.org/zap"
+)
+
+// CreatorState is the state of the creator server process.
+type CreatorState int
+
+const (
+	CreatorStopped CreatorState = iota
+	CreatorStarting
+	CreatorReady
+	CreatorCrashed
+)
+
+func (s CreatorState) String() string {
+	switch s {
+	case CreatorStopped:
+		return "stopped"
+	case CreatorStarting:
+		return "starting"
+	case CreatorReady:
+		return "ready"
+	case CreatorCrashed:
+		return "crashed"
+	}
+	return "unknown"
+}
+
+const (
+	// creatorStartTimeout is how long a started server has to answer ping.
+	creatorStartTimeout = 5 * time.Second
+
+	creatorPingInterval = 2 * time.Second
+	creatorPingTimeout  = time.Second
+	// the server is restarted after this many failed pings in a row
+	creatorMaxPingFailures = 3
+
+	creatorRestartBackoff    = 500 * time.Millisecond
+	creatorMaxRestartBackoff = 10 * time.Second
+	// after this many failed restarts in a row the server stays crashed
+	creatorMaxRestarts = 5
+)
+
+// creatorSupervisor runs the creator server (scripts/connect.py) on a unix
+// socket or a free port and watches it: the server is restarted with backoff if the process
+// exits or stops answering ping, and the session path and API data are
+// sent to it again.
+type creatorSupervisor struct {
+	cl *Client
+
+	// runMu serializes start and shutdown
+	runMu sync.Mutex
+
+	mu    sync.Mutex
+	state CreatorState
+	// ready is closed while the state is ready or stopped
+	ready       chan struct{}
+	readyClosed bool
+	// failed is set when the server stays crashed
+	failed error
+
+	uri string
+	// socketDir is the private directory of the unix socket, if created
+	socketDir string
+	api       *creator.Client
+	cmd       *exec.Cmd
+	exited    chan struct{}
+	session   string
+	release   func()
+	apiData   *creator.APIDataRequest
+
+	stop chan struct{}
+	done chan struct{}
+
+	nextWatcher int
+	watchers    map[int]func(CreatorState)
+}
+
+func newCreatorSupervisor(cl *Client) *creatorSupervisor {
+	ready := make(chan struct{})
+	close(ready)
+	return &creatorSupervisor{
+		cl:          cl,
+		ready:       ready,
+		readyClosed: true,
+		watchers:    make(map[int]func(CreatorState)),
+	}
+}
+
+// StartCreatorServer starts the creator server for the current account and
+// waits until it is ready. It does nothing if the server is already running.
+func (cl *Client) StartCreatorServer() error {
+	return cl.creator.start()
+}
+
+// StopCreatorServer stops the creator server and releases the session.
+func (cl *Client) StopCreatorServer() error {
+	return cl.creator.shutdown()
+}
+
+// CreatorState returns the state of the creator server.
+func (cl *Client) CreatorState() CreatorState {
+	s := cl.creator
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// WatchCreatorState calls f on every state change of the creator server,
+// from the goroutine of the change. Call the returned function to stop.
+func (cl *Client) WatchCreatorState(f func(CreatorState)) func() {
+	s := cl.creator
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextWatcher
+	s.nextWatcher++
+	s.watchers[id] = f
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers, id)
+	}
+}
+
+func (s *creatorSupervisor) setState(state CreatorState) {
+	s.mu.Lock()
+	if s.state == state {
+		s.mu.Unlock()
+		return
+	}
+	s.state = state
+	switch state {
+	case CreatorReady, CreatorStopped:
+		if !s.readyClosed {
+			close(s.ready)
+			s.readyClosed = true
+		}
+	default:
+		if s.readyClosed {
+			s.ready = make(chan struct{})
+			s.readyClosed = false
+		}
+	}
+	watchers := slices.Collect(maps.Values(s.watchers))
+	s.mu.Unlock()
+
+	s.cl.ExtLog.Info("creator server state", zap.Stringer("state", state))
+	for _, f := range watchers {
+		f(state)
+	}
+}
+
+// giveUp leaves the server crashed, waiting calls return err.
+func (s *creatorSupervisor) giveUp(err error) {
+	s.mu.Lock()
+	s.failed = err
+	if !s.readyClosed {
+		close(s.ready)
+		s.readyClosed = true
+	}
+	s.mu.Unlock()
+}
+
+// client returns the client of the ready server. While the server is
+// starting or restarting, it waits until the server is ready or ctx is done.
+func (s *creatorSupervisor) client(ctx context.Context) (*creator.Client, error) {
+	for {
+		s.mu.Lock()
+		state, api, ready, failed := s.state, s.api, s.ready, s.failed
+		s.mu.Unlock()
+
+		switch {
+		case state == CreatorReady:
+			return api, nil
+		case state == CreatorStopped:
+			return nil, apperrors.ErrCreatorNotRunning
+		case failed != nil:
+			return nil, fmt.Errorf("%w: %w", apperrors.ErrCreatorCrashed, failed)
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *creatorSupervisor) start() error {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	s.mu.Lock()
+	state, failed := s.state, s.failed
+	s.mu.Unlock()
+	if state != CreatorStopped {
+		if failed == nil {
+			return nil
+		}
+		_ = s.shutdownLocked()
+	}
+
+	// the server logs in the current account
+	session, release, err := s.cl.sessions.AcquireSession(s.cl.accounts.Current().Session)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.session, s.release = session, release
+	s.failed = nil
+	s.apiData = nil
+	s.uri = ""
+	s.mu.Unlock()
+
+	s.setState(CreatorStarting)
+	if err := s.launch(); err != nil {
+		_ = s.shutdownLocked()
+		return err
+	}
+	s.setState(CreatorReady)
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.monitor(s.stop, s.done)
+	return nil
+}
+
+// launch starts the server process and prepares it: it gets the session
+// path and the API data sent before a restart.
+func (s *creatorSupervisor) launch() error {
+	cfg := s.cl.cfg
+	s.mu.Lock()
+	prev, session, apiData := s.uri, s.session, s.apiData
+	s.mu.Unlock()
+
+	uri, err := s.listenURI(cfg.CreatorURI, prev)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(cfg.VenvPath+"/bin/python3", cfg.ScriptsPath+"/connect.py", "--uri", uri)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	logf, _ := os.OpenFile(cfg.LogPath+"/creator_server.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	cmd.Stdout = logf
+	cmd.Stderr = logf
+	if err := cmd.Start(); err != nil {
+		if logf != nil {
+			_ = logf.Close()
+		}
+		return err
+	}
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		if logf != nil {
+			_ = logf.Close()
+		}
+		s.cl.ExtLog.Info("creator server exited", zap.Int("pid", cmd.Process.Pid), zap.Error(err))
+		close(exited)
+	}()
+
+	api := newCreatorClient(cfg, uri, s.cl.ExtLog)
+	s.mu.Lock()
+	s.uri, s.api, s.cmd, s.exited = uri, api, cmd, exited
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), creatorStartTimeout)
+	defer cancel()
+	if err := waitCreator(ctx, api, exited); err != nil {
+		return err
+	}
+
+	ctx, cancel = creatorContext()
+	defer cancel()
+	if err := api.SetSessionPath(ctx, session); err != nil {
+		return fmt.Errorf("send session path: %w", err)
+	}
+	if apiData != nil {
+		if _, err := api.SendAPIData(ctx, *apiData); err != nil {
+			return fmt.Errorf("send api data: %w", err)
+		}
+	}
+	s.cl.ExtLog.Info("creator server started", zap.Int("pid", cmd.Process.Pid), zap.String("uri", uri))
+	return nil
+}
+
+// waitCreator pings the server until it answers.
+func waitCreator(ctx context.Context, api *creator.Client, exited <-chan struct{}) error {
+	for {
+		if err := api.Ping(ctx); err == nil {
+			return nil // server is good
+		}
+		select {
+		case <-exited:
+			return apperrors.ErrCreatorExited
+		case <-ctx.Done():
+			return apperrors.ErrCreatorWaitTimeout
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// monitor restarts the server when its process exits
+// or it doesn't answer ping, until stop is closed.
+func (s *creatorSupervisor) monitor(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	t := time.NewTicker(creatorPingInterval)
+	defer t.Stop()
+
+	failures := 0
+	for {
+		s.mu.Lock()
+		api, exited := s.api, s.exited
+		s.mu.Unlock()
+
+		select {
+		case <-stop:
+			return
+		case <-exited:
+			s.cl.ExtLog.Warn("creator server died")
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), creatorPingTimeout)
+			err := api.Ping(ctx)
+			cancel()
+			if err == nil {
+				failures = 0
+				continue
+			}
+			if failures++; failures < creatorMaxPingFailures {
+				continue
+			}
+			s.cl.ExtLog.Warn("creator server doesn't answer ping", zap.Error(err))
+		}
+
+		failures = 0
+		s.setState(CreatorCrashed)
+		_ = s.cl.UserLog(2, "Login server stopped working, restarting it")
+		if !s.restart(stop) {
+			return
+		}
+	}
+}
+
+// restart kills the server and starts it again with backoff.
+// Returns false if it was stopped or gave up.
+func (s *creatorSupervisor) restart(stop <-chan struct{}) bool {
+	wait := creatorRestartBackoff
+	var err error
+	for i := 0; i < creatorMaxRestarts; i++ {
+		s.kill()
+		select {
+		case <-stop:
+			return false
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, creatorMaxRestartBackoff)
+
+		s.setState(CreatorStarting)
+		if err = s.launch(); err == nil {
+			s.setState(CreatorReady)
+			_ = s.cl.UserLog(1, "Login server restarted. If the code was already sent, send the phone again")
+			return true
+		}
+		s.cl.ExtLog.Warn("creator server restart failed", zap.Int("attempt", i+1), zap.Error(err))
+		s.setState(CreatorCrashed)
+	}
+
+	s.kill()
+	s.cl.ExtLog.Error("creator server gave up restarting", zap.Error(err))
+	_ = s.cl.UserLog(3, "Login server can't be started, see logs")
+	s.giveUp(err)
+	return false
+}
+
+// kill stops the server process, if it is running.
+func (s *creatorSupervisor) kill() {
+	s.mu.Lock()
+	cmd, exited := s.cmd, s.exited
+	s.cmd = nil
+	s.mu.Unlock()
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	terminateGroup(cmd.Process.Pid, exited, stopGracePeriod)
+	<-exited
+}
+
+// shutdown stops monitoring, asks the server to exit and
+// kills it if it doesn't, then releases the session.
+func (s *creatorSupervisor) shutdown() error {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	return s.shutdownLocked()
+}
+
+// shutdownLocked must be called with runMu held.
+func (s *creatorSupervisor) shutdownLocked() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop, s.done = nil, nil
+	}
+
+	s.mu.Lock()
+	api, cmd := s.api, s.cmd
+	s.mu.Unlock()
+	if cmd != nil && api != nil {
+		// try graceful http shutdown
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		if err := api.Shutdown(ctx); err != nil {
+			s.cl.ExtLog.Warn("creator server shutdown HTTP failed, proceeding to signal", zap.Error(err))
+		}
+		cancel()
+	}
+	s.kill()
+
+	// the server may have written the session, store it after exit
+	s.mu.Lock()
+	release, uri, socketDir := s.release, s.uri, s.socketDir
+	s.release = nil
+	s.api = nil
+	s.apiData = nil
+	s.socketDir = ""
+	s.mu.Unlock()
+	if release != nil {
+		release()
+	}
+	if path, ok := creator.SocketPath(uri); ok && path != "" {
+		_ = os.Remove(path)
+	}
+	if socketDir != "" {
+		_ = os.RemoveAll(socketDir)
+	}
+	s.setState(CreatorStopped)
+	return nil
+}
+
+// setAPIData keeps the API data sent to the server for restarts.
+func (s *creatorSupervisor) setAPIData(req creator.APIDataRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiData = &req
+}
+
+// listenURI returns the uri the server of base listens on, the address of
+// prev is kept for a restarted server. unix:// without path gets a socket in
+// a private directory of the runtime dir.
+func (s *creatorSupervisor) listenURI(base, prev string) (string, error) {
+	path, ok := creator.SocketPath(base)
+	switch {
+	case !ok:
+		return freePortURI(base, prev)
+	case path != "":
+		return base, nil
+	case prev != "":
+		return prev, nil
+	}
+
+	// MkdirTemp creates the directory with 0700
+	dir, err := os.MkdirTemp(runtimeDir(), "tdsoft-creator-")
+	if err != nil {
+		return "", fmt.Errorf("create socket dir: %w", err)
+	}
+	s.mu.Lock()
+	s.socketDir = dir
+	s.mu.Unlock()
+	return "unix://" + filepath.Join(dir, "creator.sock"), nil
+}
+
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// freePortURI returns base with a free port of its host. The port of prev
+// is kept if it is still free, so a restarted server has the same address.
+func freePortURI(base, prev string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("parse creator uri: %w", err)
+	}
+	host := u.Hostname()
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	port := "0"
+	if p, err := url.Parse(prev); err == nil && prev != "" {
+		port = p.Port()
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil && port != "0" {
+		l, err = net.Listen("tcp", net.JoinHostPort(host, "0"))
+	}
+	if err != nil {
+		return "", fmt.Errorf("find free port: %w", err)
+	}
+	addr, ok := l.Addr().(*net.TCPAddr)
+	_ = l.Close()
+	if !ok {
+		return "", errors.New("find free port: not a tcp address")
+	}
+
+	u.Host = net.JoinHostPort(host, strconv.Itoa(addr.Port))
+	return u.String(), nil
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Chat types of [Dialog], as written by scripts/print_dialogs.py.
+const (
+	ChatTypePrivate    = "private"
+	ChatTypeBot        = "bot"
+	ChatTypeGroup      = "group"
+	ChatTypeSupergroup = "supergroup"
+	ChatTypeChannel    = "channel"
+)
+
+// Dialog is a row of the CSV written by [Client.PrintDialogs].
+type Dialog struct {
+	ChatID   int64
+	Type     string
+	Title    string
+	Username string
+}
+
+// Chat returns the name to pass as ChatID of requests:
+// @username if the chat has one, the id otherwise.
+func (d Dialog) Chat() string {
+	if d.Username != "" {
+		return "@" + d.Username
+	}
+	return strconv.FormatInt(d.ChatID, 10)
+}
+
+// IsGroup reports whether the chat is a group or a supergroup.
+func (d Dialog) IsGroup() bool {
+	return d.Type == ChatTypeGroup || d.Type == ChatTypeSupergroup
+}
+
+// ReadDialogs reads the chat_id,type,title,username CSV written by PrintDialogs.
+func ReadDialogs(path string) ([]Dialog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 4
+	if _, err := r.Read(); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read dialogs header: %w", err)
+	}
+	var dialogs []Dialog
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return dialogs, nil
+		}
+		if err != nil {
+			return dialogs, fmt.Errorf("read dialogs: %w", err)
+		}
+		id, err := strconv.ParseInt(rec[0], 10, 64)
+		if err != nil {
+			return dialogs, fmt.Errorf("read dialogs: bad chat_id %q", rec[0])
+		}
+		dialogs = append(dialogs, Dialog{
+			ChatID:   id,
+			Type:     strings.ToLower(rec[1]),
+			Title:    rec[2],
+			Username: rec[3],
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"go.uber.org/zap"
+)
+
+// defaultHealthCheckInterval is used if health_check_interval is not set.
+const defaultHealthCheckInterval = time.Minute
+
+// HealthCheckInterval returns how often the session should be checked
+// with [Client.CheckConnection].
+func (cl *Client) HealthCheckInterval() time.Duration {
+	if cl.cfg.HealthCheckInterval <= 0 {
+		return defaultHealthCheckInterval
+	}
+	return cl.cfg.HealthCheckInterval
+}
+
+// Health is the result of [Client.CheckConnection].
+type Health struct {
+	Account   string
+	UserID    int64
+	FirstName string
+	Username  string
+
+	// Latency is the round trip of a request to telegram.
+	Latency   time.Duration
+	CheckedAt time.Time
+}
+
+// Name returns @username, or the first name if there is no username.
+func (h *Health) Name() string {
+	if h.Username != "" {
+		return "@" + h.Username
+	}
+	return h.FirstName
+}
+
+// CheckConnection checks that the session of the account chosen by opts
+// is authorized, with scripts/check_session.py. It is quiet: errors are
+// logged to the extended log only.
+//
+// If the session was revoked elsewhere, the account is logged out and
+// [apperrors.ErrSessionRevoked] is returned.
+func (cl *Client) CheckConnection(ctx context.Context, opts ...RunOption) (*Health, error) {
+	a, err := cl.account(cl.Account(opts...))
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Health{Account: a.Name}
+	ok := false
+	onOut := func(t string, pm *PyMsg) {
+		if pm == nil || pm.Code != "SESSION_OK" {
+			return
+		}
+		ok = true
+		h.UserID = int64(detailInt(pm.Details, "id"))
+		h.FirstName, _ = pm.Details["first_name"].(string)
+		h.Username, _ = pm.Details["username"].(string)
+		h.Latency = time.Duration(detailInt(pm.Details, "latency_ms")) * time.Millisecond
+	}
+	err = cl.runTool(ctx, opts, "check_session.py", nil, onOut)
+	h.CheckedAt = time.Now()
+
+	switch {
+	case errors.Is(err, apperrors.ErrSessionRevoked):
+		cl.ExtLog.Warn("session revoked", zap.String("account", a.Name), zap.Error(err))
+		if lErr := cl.Logout(a.Name); lErr != nil {
+			cl.ExtLog.Error("failed to log out revoked account", zap.String("account", a.Name), zap.Error(lErr))
+		}
+		return nil, err
+	case err != nil:
+		cl.ExtLog.Warn("session check failed", zap.String("account", a.Name), zap.Error(err))
+		return nil, err
+	case !ok:
+		return nil, apperrors.NewScriptError("UNEXPECTED_ERROR",
+			map[string]any{"when": "check session", "error": "no SESSION_OK"}, nil)
+	}
+	cl.ExtLog.Debug("session ok", zap.String("account", a.Name), zap.Duration("latency", h.Latency))
+	return h, nil
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Final statuses of a journaled run.
+const (
+	RunStatusDone      = "done"
+	RunStatusFailed    = "failed"
+	RunStatusCancelled = "cancelled"
+)
+
+// JournalEntry is one line of the requests journal,
+// it describes a single executed [Request].
+type JournalEntry struct {
+	JobID         string          `json:"job_id,omitempty"`
+	Type          string          `json:"type"`
+	Account       string          `json:"account,omitempty"`
+	Session       string          `json:"session"`
+	Request       json.RawMessage `json:"request"`
+	StartedAt     time.Time       `json:"started_at"`
+	EndedAt       time.Time       `json:"ended_at"`
+	Status        string          `json:"status"`
+	Output        string          `json:"output"`
+	LastErrorCode string          `json:"last_error_code,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// DecodeRequest decodes the entry request according to its type.
+func (e *JournalEntry) DecodeRequest() (Request, error) {
+	var req Request
+	switch e.Type {
+	case KindGetMembers:
+		req = &GetMembersRequest{}
+	case KindGetChatStats:
+		req = &GetChatStatsRequest{}
+	case KindSearchMessages:
+		req = &SearchMessagesRequest{}
+	case KindPrintDialogs:
+		req = &PrintDialogsRequest{}
+	default:
+		return nil, fmt.Errorf("unknown request type %q", e.Type)
+	}
+	if err := json.Unmarshal(e.Request, req); err != nil {
+		return nil, fmt.Errorf("decode %s request: %w", e.Type, err)
+	}
+	return req, nil
+}
+
+// Journal appends entries to a JSON Lines file.
+type Journal struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewJournal(path string) *Journal {
+	return &Journal{path: path}
+}
+
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Append writes e as a single line.
+func (j *Journal) Append(e *JournalEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadJournal reads all entries from the journal at path, oldest first.
+// Missing file means empty journal. Malformed lines (e.g. a line cut
+// by a crash) are skipped.
+func ReadJournal(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 1024*64), 1<<20)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"go.uber.org/zap"
+)
+
+// defaultFloodWaitThreshold is used if the account pool is enabled
+// without flood_wait_threshold, in seconds.
+const defaultFloodWaitThreshold = 300
+
+func (cl *Client) floodWaitThreshold() int {
+	if cl.cfg.FloodWaitThreshold > 0 {
+		return cl.cfg.FloodWaitThreshold
+	}
+	return defaultFloodWaitThreshold
+}
+
+// floodWaitArgs returns script args for resumable requests. Without
+// the account pool scripts wait out any flood wait.
+func (cl *Client) floodWaitArgs() []string {
+	if !cl.cfg.AccountPool {
+		return nil
+	}
+	return []string{"--max-flood-wait", strconv.Itoa(cl.floodWaitThreshold())}
+}
+
+// setCooldown saves the flood wait of value seconds reported by a script
+// for the account.
+func (cl *Client) setCooldown(account string, value any) {
+	var seconds float64
+	switch v := value.(type) {
+	case float64:
+		seconds = v
+	case int:
+		seconds = float64(v)
+	default:
+		return
+	}
+	a, err := cl.account(account)
+	if err != nil {
+		return
+	}
+	until := time.Now().Add(time.Duration(seconds * float64(time.Second)))
+	if err := cl.accounts.SetCooldown(a.Name, until); err != nil {
+		cl.ExtLog.Error("failed to save account cooldown",
+			zap.String("account", a.Name), zap.Error(err))
+	}
+}
+
+// nextAccount returns a logged in account without cooldown
+// that is not in tried.
+func (cl *Client) nextAccount(tried []string) (string, bool) {
+	now := time.Now()
+	for _, a := range cl.accounts.List() {
+		if slices.Contains(tried, a.Name) || a.CoolingDown(now) {
+			continue
+		}
+		if cl.CheckAccount(a.Name) != nil {
+			continue
+		}
+		return a.Name, true
+	}
+	return "", false
+}
+
+// runPool runs req and, while it stops with FLOOD_WAIT_TOO_LONG, runs
+// the rest of it with the next healthy account. Each account is tried once,
+// see [WithAccountSwitch].
+func (cl *Client) runPool(ctx context.Context, req Request, opts ...RunOption) error {
+	var o runOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	tried := []string{cl.Account(opts...)}
+	for {
+		err := cl.run(ctx, req, opts...)
+
+		var se *apperrors.ScriptError
+		if !errors.Is(err, apperrors.ErrFloodWaitTooLong) || !errors.As(err, &se) {
+			return err
+		}
+		r, ok := req.(Resumable)
+		if !ok {
+			return err
+		}
+		next, rErr := r.Remaining(se.Details)
+		if rErr != nil {
+			cl.ExtLog.Error("failed to get remaining request", zap.Error(rErr))
+			return err
+		}
+		name, ok := cl.nextAccount(tried)
+		if !ok {
+			_ = cl.UserLog(3, "No account without flood wait left, stopped")
+			return err
+		}
+
+		if o.onSwitch != nil {
+			if sErr := o.onSwitch(ctx, name); sErr != nil {
+				return sErr
+			}
+		}
+		cl.ExtLog.Info("moving job to next account",
+			zap.String("from", tried[len(tried)-1]), zap.String("to", name),
+			zap.Any("request", next))
+		_ = cl.UserLog(2, fmt.Sprintf("Continuing with account %s", name))
+
+		tried = append(tried, name)
+		req = next
+		opts = append(slices.Clip(opts), WithAccount(name))
+	}
+}
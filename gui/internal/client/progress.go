@@ -0,0 +1,54 @@
+package client
+
+// Progress is a typed PROGRESS message of a script.
+type Progress struct {
+	// Phase names the part of the job in progress,
+	// e.g. "members", "messages", "history", "days", "dialogs".
+	Phase string
+
+	Current int
+
+	// Total is 0 if unknown.
+	Total int
+}
+
+// Fraction returns the done part in [0, 1], or -1 if total is unknown.
+func (p Progress) Fraction() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return min(float64(p.Current)/float64(p.Total), 1)
+}
+
+// ParseProgress converts a PROGRESS message to [Progress].
+func ParseProgress(pm *PyMsg) (Progress, bool) {
+	if pm == nil || pm.Code != "PROGRESS" {
+		return Progress{}, false
+	}
+	p := Progress{}
+	p.Phase, _ = pm.Details["phase"].(string)
+	p.Current = detailInt(pm.Details, "current")
+	p.Total = detailInt(pm.Details, "total")
+	return p, true
+}
+
+// WithProgress registers f to receive progress of the run.
+func WithProgress(f func(Progress)) RunOption {
+	return WithObserver(func(_ string, pm *PyMsg) {
+		if p, ok := ParseProgress(pm); ok && f != nil {
+			f(p)
+		}
+	})
+}
+
+// detailInt returns details[key] as int. JSON numbers are decoded as float64.
+func detailInt(details map[string]any, key string) int {
+	switch v := details[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
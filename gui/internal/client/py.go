@@ -2,25 +2,78 @@ package client
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"os"
 	"os/exec"
 	"strings"
+	"syscall"
+	"time"
+
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
 )
 
+// stopGracePeriod is how long a script gets to exit after SIGINT
+// before the whole process group is killed.
+const stopGracePeriod = 3 * time.Second
+
 type PyMsg struct {
 	Code    string         `json:"code"`
 	Details map[string]any `json:"details"`
 }
 
 type PyEnvelope struct {
-	Error *PyMsg `json:"error,omitempty"`
-	Info  *PyMsg `json:"info,omitempty"`
-	Warn  *PyMsg `json:"warn,omitempty"`
-	Log   *PyMsg `json:"log,omitempty"`
+	Error    *PyMsg `json:"error,omitempty"`
+	Info     *PyMsg `json:"info,omitempty"`
+	Warn     *PyMsg `json:"warn,omitempty"`
+	Log      *PyMsg `json:"log,omitempty"`
+	Progress *PyMsg `json:"progress,omitempty"`
+}
+
+// dispatch passes the message of env to onOut with its level,
+// or to onErr if it is an error. Nil handlers are skipped.
+func (env *PyEnvelope) dispatch(onOut func(string, *PyMsg), onErr func(*PyMsg)) {
+	if env.Error != nil {
+		if onErr != nil {
+			onErr(env.Error)
+		}
+		return
+	}
+	if onOut == nil {
+		return
+	}
+	switch {
+	case env.Info != nil:
+		onOut("INFO", env.Info)
+	case env.Warn != nil:
+		onOut("WARN", env.Warn)
+	case env.Log != nil:
+		onOut("LOG", env.Log)
+	case env.Progress != nil:
+		onOut("PROGRESS", env.Progress)
+	}
 }
 
-func runPyWithStreaming(venv string, args []string, onOut func(string, *PyMsg), onErr func(*PyMsg)) error {
+// runPyWithStreaming runs python script in its own process group and streams
+// its envelopes to onOut/onErr. env is added to the environment of the script.
+// When ctx is done, the process group gets SIGINT, then SIGKILL after
+// stopGracePeriod, and ctx.Err() is returned.
+//
+// If the script fails, the returned error is *apperrors.ScriptError with
+// the code of the last structured error, or SCRIPT_UNCAUGHT_ERROR.
+func runPyWithStreaming(ctx context.Context, venv string, args []string, env map[string]string, onOut func(string, *PyMsg), onErr func(*PyMsg)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	cmd := exec.Command(venv+"/bin/python3", args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if len(env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -37,26 +90,31 @@ func runPyWithStreaming(venv string, args []string, onOut func(string, *PyMsg),
 
 	outDone := make(chan struct{})
 	errDone := make(chan struct{})
-	seenStructErr := false
+	var lastStructErr *PyMsg
 	var stderrLines []string
 	const maxStderrLines = 200
 
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			terminateGroup(cmd.Process.Pid, exited, stopGracePeriod)
+		case <-exited:
+		}
+	}()
+
 	go func() {
 		defer close(outDone)
 		for scOut.Scan() {
 			var env PyEnvelope
 			if nil == json.Unmarshal(scOut.Bytes(), &env) {
-				if onOut == nil {
-					continue
-				}
-				switch {
-				case env.Info != nil:
-					onOut("INFO", env.Info)
-				case env.Warn != nil:
-					onOut("WARN", env.Warn)
-				case env.Log != nil:
-					onOut("LOG", env.Log)
-				}
+				// errors are read from stderr
+				env.Error = nil
+				env.dispatch(onOut, nil)
 			}
 		}
 	}()
@@ -66,7 +124,7 @@ func runPyWithStreaming(venv string, args []string, onOut func(string, *PyMsg),
 		for scErr.Scan() {
 			var env PyEnvelope
 			if err := json.Unmarshal(scErr.Bytes(), &env); err == nil && env.Error != nil {
-				seenStructErr = true
+				lastStructErr = env.Error
 				if onErr != nil {
 					onErr(env.Error)
 				}
@@ -79,29 +137,43 @@ func runPyWithStreaming(venv string, args []string, onOut func(string, *PyMsg),
 		}
 	}()
 
-	if err := cmd.Start(); err != nil {
-		return err
-	}
-
-	waitErr := make(chan error, 1)
-	go func() { waitErr <- cmd.Wait() }()
 	<-outDone
 	<-errDone
-	err = <-waitErr
+	err = cmd.Wait()
+	close(exited)
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
 
+	if lastStructErr != nil {
+		return apperrors.NewScriptError(lastStructErr.Code, lastStructErr.Details, err)
+	}
 	if err != nil {
-		if seenStructErr {
-			return nil
+		pm := &PyMsg{
+			Code: "SCRIPT_UNCAUGHT_ERROR",
+			Details: map[string]any{
+				"error":  err.Error(),
+				"stderr": strings.Join(stderrLines, "\n"),
+			},
 		}
 		if onErr != nil {
-			onErr(&PyMsg{
-				Code: "SCRIPT_UNCAUGHT_ERROR",
-				Details: map[string]any{
-					"error":  err.Error(),
-					"stderr": strings.Join(stderrLines, "\n"),
-				},
-			})
+			onErr(pm)
 		}
+		return apperrors.NewScriptError(pm.Code, pm.Details, err)
+	}
+	return nil
+}
+
+// terminateGroup sends SIGINT to the process group of pid and
+// escalates to SIGKILL if exited is not closed within grace.
+func terminateGroup(pid int, exited <-chan struct{}, grace time.Duration) {
+	pgid := -pid
+	_ = syscall.Kill(pgid, syscall.SIGINT)
+
+	select {
+	case <-exited:
+	case <-time.After(grace):
+		_ = syscall.Kill(pgid, syscall.SIGKILL)
 	}
-	return err
 }
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mauzec/tdsoft/gui/internal/output"
+)
+
+// recordWriter writes the rows a script emits with --records to the
+// output of a request: COLUMNS opens the sink, RECORD is a row.
+//
+// Messages come from one goroutine, the writer is not locked.
+type recordWriter struct {
+	req  Request
+	sink output.Sink
+	// err is the first error, the rest of the rows are dropped
+	err error
+}
+
+func newRecordWriter(req Request) *recordWriter {
+	return &recordWriter{req: req}
+}
+
+// handle writes pm if it is COLUMNS or RECORD and reports whether it was.
+func (rw *recordWriter) handle(pm *PyMsg) bool {
+	switch pm.Code {
+	case "COLUMNS":
+		if rw.err == nil {
+			rw.err = rw.open(pm)
+		}
+	case "RECORD":
+		if rw.err == nil {
+			rw.err = rw.write(pm)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (rw *recordWriter) open(pm *PyMsg) error {
+	if rw.sink != nil {
+		return errors.New("columns of the output are sent twice")
+	}
+	cols := detailStrings(pm.Details, "columns")
+	appendTo, _ := pm.Details["append"].(bool)
+	sink, err := output.Open(rw.req.OutputFormat(), rw.req.OutputPath(), rw.req.Kind(), appendTo)
+	if err != nil {
+		return fmt.Errorf("open output: %w", err)
+	}
+	rw.sink = sink
+	if err := sink.Columns(cols); err != nil {
+		return fmt.Errorf("write columns: %w", err)
+	}
+	return nil
+}
+
+func (rw *recordWriter) write(pm *PyMsg) error {
+	if rw.sink == nil {
+		return errors.New("record before the columns of the output")
+	}
+	if err := rw.sink.Write(detailStrings(pm.Details, "row")); err != nil {
+		return fmt.Errorf("write record: %w", err)
+	}
+	return nil
+}
+
+// flush makes the written rows durable before a checkpoint is saved,
+// a checkpoint must not get ahead of the output.
+func (rw *recordWriter) flush() error {
+	if rw.err != nil {
+		return rw.err
+	}
+	if rw.sink == nil {
+		return nil
+	}
+	if err := rw.sink.Flush(); err != nil {
+		rw.err = fmt.Errorf("flush output: %w", err)
+	}
+	return rw.err
+}
+
+// close closes the sink and returns the first error.
+func (rw *recordWriter) close() error {
+	if rw.sink != nil {
+		if err := rw.sink.Close(); err != nil && rw.err == nil {
+			rw.err = fmt.Errorf("close output: %w", err)
+		}
+	}
+	return rw.err
+}
+
+// detailStrings returns the strings of the list at key of details.
+func detailStrings(details map[string]any, key string) []string {
+	list, _ := details[key].([]any)
+	out := make([]string, len(list))
+	for i, v := range list {
+		switch v := v.(type) {
+		case string:
+			out[i] = v
+		case nil:
+		default:
+			out[i] = fmt.Sprint(v)
+		}
+	}
+	return out
+}
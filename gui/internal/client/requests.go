@@ -1,18 +1,22 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/mauzec/tdsoft/gui/internal/output"
 	"go.uber.org/zap"
 )
 
 type OutHandler func(string, *PyMsg)
 type ErrHandler func(*PyMsg)
 
-func ComposeOnOut(base, extra map[string]OutHandler) OutHandler {
+// ComposeOnOut returns a handler that dispatches to extra, then base.
+// Codes handled by neither go to fallback.
+func ComposeOnOut(base, extra map[string]OutHandler, fallback OutHandler) OutHandler {
 	return func(t string, env *PyMsg) {
 		if env == nil {
 			return
@@ -25,10 +29,15 @@ func ComposeOnOut(base, extra map[string]OutHandler) OutHandler {
 			hdl(t, env)
 			return
 		}
-		panic(fmt.Sprintf("unhandled output from python: %v", env))
+		if fallback != nil {
+			fallback(t, env)
+		}
 	}
 }
-func ComposeOnErr(base, extra map[string]ErrHandler) ErrHandler {
+
+// ComposeOnErr returns a handler that dispatches to extra, then base.
+// Codes handled by neither go to fallback.
+func ComposeOnErr(base, extra map[string]ErrHandler, fallback ErrHandler) ErrHandler {
 	return func(env *PyMsg) {
 		if env == nil {
 			return
@@ -41,7 +50,9 @@ func ComposeOnErr(base, extra map[string]ErrHandler) ErrHandler {
 			hdl(env)
 			return
 		}
-		panic(fmt.Sprintf("unhandled error from python: %v", env))
+		if fallback != nil {
+			fallback(env)
+		}
 	}
 }
 
@@ -49,50 +60,91 @@ func ComposeOnErr(base, extra map[string]ErrHandler) ErrHandler {
 
 type Request interface {
 	Validate() error
+
+	// Kind returns the request kind, e.g. [KindGetMembers].
+	Kind() string
+
+	// OutputPath returns the path where results will be saved.
+	OutputPath() string
+
+	// OutputFormat returns the format results are saved in.
+	OutputFormat() output.Format
 }
 
+// Resumable is a request the rest of which can be run by another
+// account after the script stopped with FLOOD_WAIT_TOO_LONG.
+type Resumable interface {
+	Request
+
+	// Remaining returns the request for the rest of the work,
+	// details are of the FLOOD_WAIT_TOO_LONG error.
+	Remaining(details map[string]any) (Request, error)
+}
+
+const (
+	KindGetMembers     = "get_members"
+	KindGetChatStats   = "get_chat_stats"
+	KindSearchMessages = "search_messages"
+	KindPrintDialogs   = "print_dialogs"
+)
+
+// SearchMessagesDateLayout is the format of dates in the output
+// of scripts/search_messages.py.
+const SearchMessagesDateLayout = "01.02.2006 15:04:05"
+
 type GetMembersRequest struct {
 	// ChatID is either a username(t.me/chat, chat, @chat),
 	// a chatID (not peerID), or invite link.
 	//
 	// TODO: invite link not supported yet.
-	ChatID string `validate:"required"`
+	ChatID string `json:"chat_id" validate:"required"`
 
 	// InviteLink says if chat is an invite link.
-	InviteLink bool `validate:"-"`
+	InviteLink bool `json:"invite_link" validate:"-"`
 
 	// Limit is the maximum number of members to return.
 	// The maximum is 50,000.
-	Limit int `validate:"min=1,max=50000"`
+	Limit int `json:"limit" validate:"min=1,max=50000"`
 
-	// Output is the path to the CSV file where
+	// Output is the path to the file where
 	// results will be saved.
-	Output string `validate:"min=1,filepath"`
+	Output string `json:"output" validate:"min=1,filepath"`
+
+	// Format is the format of Output, CSV if empty.
+	Format output.Format `json:"format,omitempty" validate:"omitempty,oneof=csv ndjson sqlite xlsx"`
 
 	// ParseFromMessages parses users/bots from messages if true.
 	// Default is false.
-	ParseFromMessages bool `validate:"-"`
+	ParseFromMessages bool `json:"parse_from_messages" validate:"-"`
 
 	// MessagesLimit is the number of messages to parse
 	// if ParseFromMessages is true. The maximum is 5000.
 	// Validate if ParseFromMessages is true.
-	MessagesLimit int `validate:"omitempty,min=1,max=5000"`
+	MessagesLimit int `json:"messages_limit" validate:"omitempty,min=1,max=5000"`
 
 	// TODO: not implemented yet.
-	ExcludeBots bool `validate:"-"`
+	ExcludeBots bool `json:"exclude_bots" validate:"-"`
 
 	// ParseBio parses users' bio.
 	// This may slow down the process.
-	ParseBio bool `validate:"-"`
+	ParseBio bool `json:"parse_bio" validate:"-"`
 
 	// AddAdditionalInfo adds additional information about users,
 	// such as bio, premium, scam flag, etc.
-	AddAdditionalInfo bool `validate:"-"`
+	AddAdditionalInfo bool `json:"add_additional_info" validate:"-"`
 
 	// AutoJoin automatically joins the chat if true.
 	//
 	// TODO: not implemented yet
-	AutoJoin bool `validate:"-"`
+	AutoJoin bool `json:"auto_join" validate:"-"`
+
+	// Append appends to existing Output instead of overwriting it,
+	// members already written are skipped.
+	Append bool `json:"append,omitempty" validate:"-"`
+
+	// Checkpoint is the checkpoint file to resume from, see [ResumeRequest].
+	// It implies Append.
+	Checkpoint string `json:"checkpoint,omitempty" validate:"omitempty,filepath"`
 }
 
 func (req *GetMembersRequest) Validate() error {
@@ -102,75 +154,161 @@ func (req *GetMembersRequest) Validate() error {
 	return validator.New().Struct(req)
 }
 
+func (req *GetMembersRequest) Kind() string                { return KindGetMembers }
+func (req *GetMembersRequest) OutputPath() string          { return req.Output }
+func (req *GetMembersRequest) OutputFormat() output.Format { return req.Format }
+
+// Remaining fetches members again appending to Output,
+// written members are skipped by the script.
+func (req *GetMembersRequest) Remaining(details map[string]any) (Request, error) {
+	next := *req
+	next.Append = true
+	if HasCheckpoint(req.Output) {
+		next.Checkpoint = CheckpointPath(req.Output)
+	}
+	return &next, nil
+}
+
+func (req *GetMembersRequest) FromCheckpoint(path string) Request {
+	next := *req
+	next.Append = true
+	next.Checkpoint = path
+	return &next
+}
+
 type GetChatStatsRequest struct {
 	// ChatID is either a username(t.me/chat, chat, @chat),
 	// a chatID (not peerID), or invite link.
 	//
 	// TODO: invite link not supported yet.
-	ChatID string `validate:"required"`
+	ChatID string `json:"chat_id" validate:"required"`
 
 	// InviteLink says if chat is an invite link.
-	InviteLink bool `validate:"-"`
+	InviteLink bool `json:"invite_link" validate:"-"`
 
 	// MessagesLimit is the number of messages to parse
 	// No max value, 0 means all messages
-	MessagesLimit int `validate:"min=0"`
+	MessagesLimit int `json:"messages_limit" validate:"min=0"`
 
-	// Output is the path to the CSV file where
+	// Output is the path to the file where
 	// results will be saved.
-	Output string `validate:"min=1,filepath"`
+	Output string `json:"output" validate:"min=1,filepath"`
+
+	// Format is the format of Output, CSV if empty.
+	Format output.Format `json:"format,omitempty" validate:"omitempty,oneof=csv ndjson sqlite xlsx"`
+
+	// Checkpoint is the checkpoint file to resume from, see [ResumeRequest].
+	Checkpoint string `json:"checkpoint,omitempty" validate:"omitempty,filepath"`
 }
 
 func (req *GetChatStatsRequest) Validate() error {
 	return validator.New().Struct(req)
 }
 
+func (req *GetChatStatsRequest) Kind() string                { return KindGetChatStats }
+func (req *GetChatStatsRequest) OutputPath() string          { return req.Output }
+func (req *GetChatStatsRequest) OutputFormat() output.Format { return req.Format }
+
+func (req *GetChatStatsRequest) FromCheckpoint(path string) Request {
+	next := *req
+	next.Checkpoint = path
+	return &next
+}
+
 type SearchMessagesRequest struct {
 	// ChatID is either a username(t.me/chat, chat, @chat),
 	// a chatID (not peerID), or invite link.
 	//
 	// TODO: invite link not supported yet.
-	ChatID string `validate:"required"`
+	ChatID string `json:"chat_id" validate:"required"`
 
 	// InviteLink says if chat is an invite link.
-	InviteLink bool `validate:"-"`
+	InviteLink bool `json:"invite_link" validate:"-"`
 
 	// Username is a username(t.me/user, user, @user)
 	// Required
-	Username string `validate:"required"`
+	Username string `json:"username" validate:"required"`
 
-	// Output is the path to the CSV file where
+	// Output is the path to the file where
 	// results will be saved.
-	Output string `validate:"min=1,filepath"`
+	Output string `json:"output" validate:"min=1,filepath"`
+
+	// Format is the format of Output, CSV if empty.
+	Format output.Format `json:"format,omitempty" validate:"omitempty,oneof=csv ndjson sqlite xlsx"`
 
 	// FromDate is the start date in MM/DD/YYYY format.
 	// Required
-	FromDate string `validate:"required"`
+	FromDate string `json:"from_date" validate:"required"`
 
 	// ToDate is the end date in MM/DD/YYYY format.
 	// Required
-	ToDate string `validate:"required"`
+	ToDate string `json:"to_date" validate:"required"`
+
+	// Append appends to existing Output instead of overwriting it,
+	// messages already written are skipped.
+	Append bool `json:"append,omitempty" validate:"-"`
+
+	// Checkpoint is the checkpoint file to resume from, see [ResumeRequest].
+	// It implies Append.
+	Checkpoint string `json:"checkpoint,omitempty" validate:"omitempty,filepath"`
 }
 
 func (req *SearchMessagesRequest) Validate() error {
 	return validator.New().Struct(req)
 }
 
+func (req *SearchMessagesRequest) Kind() string                { return KindSearchMessages }
+func (req *SearchMessagesRequest) OutputPath() string          { return req.Output }
+func (req *SearchMessagesRequest) OutputFormat() output.Format { return req.Format }
+
+// Remaining searches from FromDate to the date the script stopped at.
+func (req *SearchMessagesRequest) Remaining(details map[string]any) (Request, error) {
+	to, _ := details["resume_to_date"].(string)
+	if to == "" {
+		return nil, errors.New("no resume_to_date in details")
+	}
+	next := *req
+	next.ToDate = to
+	next.Append = true
+	if HasCheckpoint(req.Output) {
+		next.Checkpoint = CheckpointPath(req.Output)
+	}
+	return &next, nil
+}
+
+func (req *SearchMessagesRequest) FromCheckpoint(path string) Request {
+	next := *req
+	next.Append = true
+	next.Checkpoint = path
+	return &next
+}
+
 type PrintDialogsRequest struct {
 	// Limit is the maximum number of dialogs to receive.
 	// No max value
-	Limit int `validate:"min=1"`
+	Limit int `json:"limit" validate:"min=1"`
 
 	// InviteLink says if chat is an invite link.
-	InviteLink bool `validate:"-"`
+	InviteLink bool `json:"invite_link" validate:"-"`
 
-	// Output is the path to the CSV file where
+	// Output is the path to the file where
 	// results will be saved.
-	Output string `validate:"min=1,filepath"`
+	Output string `json:"output" validate:"min=1,filepath"`
+
+	// Format is the format of Output, CSV if empty.
+	Format output.Format `json:"format,omitempty" validate:"omitempty,oneof=csv ndjson sqlite xlsx"`
 }
 
+func (req *PrintDialogsRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+func (req *PrintDialogsRequest) Kind() string                { return KindPrintDialogs }
+func (req *PrintDialogsRequest) OutputPath() string          { return req.Output }
+func (req *PrintDialogsRequest) OutputFormat() output.Format { return req.Format }
+
 // GetMembers get members of a group/channel if possible
-func (cl *Client) GetMembers(req *GetMembersRequest, validate bool) error {
+func (cl *Client) GetMembers(ctx context.Context, req *GetMembersRequest, validate bool, opts ...RunOption) error {
 	if err := cl.ensureUserLogF(); err != nil {
 		return err
 	}
@@ -185,8 +323,15 @@ func (cl *Client) GetMembers(req *GetMembersRequest, validate bool) error {
 	}
 	cl.ExtLog.Info("get members", zap.Any("request", req))
 
+	session, release, err := cl.acquireSession(opts)
+	if err != nil {
+		cl.ExtLog.Error("failed to acquire session", zap.Error(err))
+		return err
+	}
+	defer release()
+
 	args := []string{cl.cfg.ScriptsPath + "/get_members.py"}
-	args = append(args, "../"+cl.cfg.Session, req.ChatID)
+	args = append(args, session, req.ChatID)
 	args = append(args, "--limit", strconv.Itoa(req.Limit))
 	args = append(args, "--output", req.Output)
 	if req.ParseFromMessages {
@@ -200,6 +345,13 @@ func (cl *Client) GetMembers(req *GetMembersRequest, validate bool) error {
 	if req.AddAdditionalInfo {
 		args = append(args, "--add-additional-info")
 	}
+	if req.Append {
+		args = append(args, "--append")
+	}
+	if req.Checkpoint != "" {
+		args = append(args, "--resume-from", req.Checkpoint)
+	}
+	args = append(args, cl.floodWaitArgs()...)
 
 	extraOut := map[string]OutHandler{
 		"MEMBERS_FETCHED": func(t string, pm *PyMsg) {
@@ -241,16 +393,16 @@ func (cl *Client) GetMembers(req *GetMembersRequest, validate bool) error {
 			_ = cl.UserLog(3, "invite link not supported yet")
 		},
 	}
-	onOut := ComposeOnOut(cl.defaultPyOutHandlers, extraOut)
-	onErr := ComposeOnErr(cl.defaultPyErrHandlers, extraErr)
+	onOut := ComposeOnOut(cl.defaultPyOutHandlers, extraOut, cl.fallbackOut)
+	onErr := ComposeOnErr(cl.defaultPyErrHandlers, extraErr, cl.fallbackErr)
 
-	if err := runPyWithStreaming(cl.cfg.VenvPath, args, onOut, onErr); err != nil {
+	if err := cl.runPy(ctx, req, args, onOut, onErr, opts...); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (cl *Client) GetChatStats(req *GetChatStatsRequest, validate bool) error {
+func (cl *Client) GetChatStats(ctx context.Context, req *GetChatStatsRequest, validate bool, opts ...RunOption) error {
 	if cl.UserLogF == nil {
 		cl.ExtLog.Error("no user log function to set")
 		return errors.New("no user log function set")
@@ -265,13 +417,23 @@ func (cl *Client) GetChatStats(req *GetChatStatsRequest, validate bool) error {
 	}
 	cl.ExtLog.Info("get chat stats", zap.Any("request", req))
 
+	session, release, err := cl.acquireSession(opts)
+	if err != nil {
+		cl.ExtLog.Error("failed to acquire session", zap.Error(err))
+		return err
+	}
+	defer release()
+
 	args := []string{cl.cfg.ScriptsPath + "/get_chat_statistic.py"}
-	args = append(args, "../"+cl.cfg.Session, req.ChatID)
-	args = append(args, "--messages-limit", strconv.Itoa(req.MessagesLimit))
+	args = append(args, session, req.ChatID)
+	args = append(args, "--history-limit", strconv.Itoa(req.MessagesLimit))
 	args = append(args, "--output", req.Output)
 	if req.InviteLink {
 		args = append(args, "--invite-link")
 	}
+	if req.Checkpoint != "" {
+		args = append(args, "--resume-from", req.Checkpoint)
+	}
 
 	extraOut := map[string]OutHandler(nil)
 	extraErr := map[string]ErrHandler{
@@ -286,16 +448,16 @@ func (cl *Client) GetChatStats(req *GetChatStatsRequest, validate bool) error {
 			_ = cl.UserLog(3, "invite link not supported yet")
 		},
 	}
-	onOut := ComposeOnOut(cl.defaultPyOutHandlers, extraOut)
-	onErr := ComposeOnErr(cl.defaultPyErrHandlers, extraErr)
+	onOut := ComposeOnOut(cl.defaultPyOutHandlers, extraOut, cl.fallbackOut)
+	onErr := ComposeOnErr(cl.defaultPyErrHandlers, extraErr, cl.fallbackErr)
 
-	if err := runPyWithStreaming(cl.cfg.VenvPath, args, onOut, onErr); err != nil {
+	if err := cl.runPy(ctx, req, args, onOut, onErr, opts...); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (cl *Client) SearchMessages(req *SearchMessagesRequest, validate bool) error {
+func (cl *Client) SearchMessages(ctx context.Context, req *SearchMessagesRequest, validate bool, opts ...RunOption) error {
 	if cl.UserLogF == nil {
 		cl.ExtLog.Error("no user log function to set")
 		return errors.New("no user log function set")
@@ -311,14 +473,28 @@ func (cl *Client) SearchMessages(req *SearchMessagesRequest, validate bool) erro
 	}
 	cl.ExtLog.Info("searching messages", zap.Any("request", req))
 
+	session, release, err := cl.acquireSession(opts)
+	if err != nil {
+		cl.ExtLog.Error("failed to acquire session", zap.Error(err))
+		return err
+	}
+	defer release()
+
 	args := []string{cl.cfg.ScriptsPath + "/search_messages.py"}
-	args = append(args, "../"+cl.cfg.Session, req.ChatID, req.Username)
+	args = append(args, session, req.ChatID, req.Username)
 
 	if req.Output != "" {
 		args = append(args, "--output", req.Output)
 	}
 	args = append(args, "--from-date", req.FromDate)
 	args = append(args, "--to-date", req.ToDate)
+	if req.Append {
+		args = append(args, "--append")
+	}
+	if req.Checkpoint != "" {
+		args = append(args, "--resume-from", req.Checkpoint)
+	}
+	args = append(args, cl.floodWaitArgs()...)
 
 	extraOut := map[string]OutHandler{
 		"MESSAGES_FETCHED": func(s string, pm *PyMsg) {
@@ -362,23 +538,23 @@ func (cl *Client) SearchMessages(req *SearchMessagesRequest, validate bool) erro
 			_ = cl.UserLog(3, "invalid username")
 		},
 	}
-	onOut := ComposeOnOut(cl.defaultPyOutHandlers, extraOut)
-	onErr := ComposeOnErr(cl.defaultPyErrHandlers, extraErr)
+	onOut := ComposeOnOut(cl.defaultPyOutHandlers, extraOut, cl.fallbackOut)
+	onErr := ComposeOnErr(cl.defaultPyErrHandlers, extraErr, cl.fallbackErr)
 
-	if err := runPyWithStreaming(cl.cfg.VenvPath, args, onOut, onErr); err != nil {
+	if err := cl.runPy(ctx, req, args, onOut, onErr, opts...); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (cl *Client) PrintDialogs(req *PrintDialogsRequest, validate bool) error {
+func (cl *Client) PrintDialogs(ctx context.Context, req *PrintDialogsRequest, validate bool, opts ...RunOption) error {
 	if cl.UserLogF == nil {
 		cl.ExtLog.Error("no user log function to set")
 		return errors.New("no user log function set")
 	}
 	if validate {
-		if err := validator.New().Struct(req); err != nil {
+		if err := req.Validate(); err != nil {
 			cl.ExtLog.Error(
 				"validating print dialogs request failed",
 				zap.Error(err),
@@ -387,8 +563,15 @@ func (cl *Client) PrintDialogs(req *PrintDialogsRequest, validate bool) error {
 		}
 	}
 
+	session, release, err := cl.acquireSession(opts)
+	if err != nil {
+		cl.ExtLog.Error("failed to acquire session", zap.Error(err))
+		return err
+	}
+	defer release()
+
 	args := []string{cl.cfg.ScriptsPath + "/print_dialogs.py"}
-	args = append(args, "../"+cl.cfg.Session)
+	args = append(args, session)
 
 	if req.Limit > 0 {
 		args = append(args, "--limit", strconv.Itoa(req.Limit))
@@ -397,9 +580,9 @@ func (cl *Client) PrintDialogs(req *PrintDialogsRequest, validate bool) error {
 		args = append(args, "--output", req.Output)
 	}
 
-	if err := runPyWithStreaming(cl.cfg.VenvPath, args,
-		ComposeOnOut(cl.defaultPyOutHandlers, nil),
-		ComposeOnErr(cl.defaultPyErrHandlers, nil)); err != nil {
+	if err := cl.runPy(ctx, req, args,
+		ComposeOnOut(cl.defaultPyOutHandlers, nil, cl.fallbackOut),
+		ComposeOnErr(cl.defaultPyErrHandlers, nil, cl.fallbackErr), opts...); err != nil {
 		return err
 	}
 
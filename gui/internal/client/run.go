@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RunOption configures a single script run.
+type RunOption func(*runOptions)
+
+type runOptions struct {
+	jobID     string
+	account   string
+	observers []func(string, *PyMsg)
+	onSwitch  func(ctx context.Context, account string) error
+}
+
+// WithJobID sets the job ID the run is journaled with.
+func WithJobID(id string) RunOption {
+	return func(o *runOptions) {
+		o.jobID = id
+	}
+}
+
+// WithObserver registers f to receive every message emitted by the script,
+// after the client's own handlers. Errors are passed with "ERROR" level.
+func WithObserver(f func(level string, pm *PyMsg)) RunOption {
+	return func(o *runOptions) {
+		if f != nil {
+			o.observers = append(o.observers, f)
+		}
+	}
+}
+
+// WithAccountSwitch registers f to be called before the account pool moves
+// the run to another account, e.g. to wait for a free slot of the account.
+// If f returns an error, the run stops with it.
+func WithAccountSwitch(f func(ctx context.Context, account string) error) RunOption {
+	return func(o *runOptions) {
+		o.onSwitch = f
+	}
+}
+
+// Run dispatches req to the matching client method.
+// Request is validated before run.
+//
+// With the account pool enabled, the rest of a [Resumable] request is run
+// with the next account when the current one gets a long flood wait.
+func (cl *Client) Run(ctx context.Context, req Request, opts ...RunOption) error {
+	if cl.cfg.AccountPool {
+		return cl.runPool(ctx, req, opts...)
+	}
+	return cl.run(ctx, req, opts...)
+}
+
+func (cl *Client) run(ctx context.Context, req Request, opts ...RunOption) error {
+	switch r := req.(type) {
+	case *GetMembersRequest:
+		return cl.GetMembers(ctx, r, true, opts...)
+	case *GetChatStatsRequest:
+		return cl.GetChatStats(ctx, r, true, opts...)
+	case *SearchMessagesRequest:
+		return cl.SearchMessages(ctx, r, true, opts...)
+	case *PrintDialogsRequest:
+		return cl.PrintDialogs(ctx, r, true, opts...)
+	default:
+		return fmt.Errorf("unsupported request type %T", req)
+	}
+}
+
+// runPy runs the script of req with the client's venv, or in the worker
+// if it is enabled, and journals the run. The script gets the API
+// credentials of the account, see [Client.credentialsEnv].
+// If ctx is cancelled, the script is stopped and ctx.Err() is returned.
+//
+// The script emits rows as RECORD messages (--records), they are written
+// to the output of req in its format. If writing fails, the script is stopped.
+func (cl *Client) runPy(ctx context.Context, req Request, args []string, onOut OutHandler, onErr ErrHandler, opts ...RunOption) error {
+	var o runOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	records := newRecordWriter(req)
+	args = append(args, "--records")
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu          sync.Mutex
+		lastErrCode string
+	)
+	out := func(t string, pm *PyMsg) {
+		// rows are not passed to the handlers and observers
+		if pm != nil && records.handle(pm) {
+			if records.err != nil {
+				cancel()
+			}
+			return
+		}
+		if pm != nil && pm.Code == "FLOOD_WAIT" {
+			cl.setCooldown(o.account, pm.Details["value"])
+		}
+		if pm != nil && pm.Code == "CHECKPOINT" {
+			if err := records.flush(); err != nil {
+				cancel()
+			} else {
+				cl.saveCheckpoint(req, &o, pm)
+			}
+		}
+		onOut(t, pm)
+		for _, f := range o.observers {
+			f(t, pm)
+		}
+	}
+	errh := func(pm *PyMsg) {
+		if pm != nil {
+			mu.Lock()
+			lastErrCode = pm.Code
+			mu.Unlock()
+		}
+		onErr(pm)
+		for _, f := range o.observers {
+			f("ERROR", pm)
+		}
+	}
+
+	env := cl.credentialsEnv(o.account)
+	started := time.Now()
+	var err error
+	if cl.cfg.Worker {
+		err = cl.runWorker(rctx, args, env, out, errh)
+	} else {
+		err = runPyWithStreaming(rctx, cl.cfg.VenvPath, args, env, out, errh)
+	}
+	if wErr := records.close(); wErr != nil {
+		cl.ExtLog.Error("failed to write output",
+			zap.String("output", req.OutputPath()), zap.Error(wErr))
+		_ = cl.UserLog(3, "Failed to write the output: "+wErr.Error())
+		if ctx.Err() == nil {
+			err = wErr
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		cl.ExtLog.Info("script stopped", zap.Strings("args", args), zap.Error(err))
+		_ = cl.UserLog(2, "Stopped")
+	}
+
+	mu.Lock()
+	code := lastErrCode
+	mu.Unlock()
+	if err == nil && code == "" {
+		// the run is done, there is nothing to resume
+		if rmErr := removeCheckpoint(req.OutputPath()); rmErr != nil {
+			cl.ExtLog.Warn("failed to remove checkpoint", zap.Error(rmErr))
+		}
+	}
+	cl.journalRun(req, &o, started, code, ctx.Err(), err)
+
+	return err
+}
+
+// runTool runs a short script that is not a job, e.g. a session check,
+// with the session of the account chosen by opts: scripts/<script> <session> args...
+// It is not journaled, errors of the script go to the extended log only.
+func (cl *Client) runTool(ctx context.Context, opts []RunOption, script string, args []string, onOut func(string, *PyMsg)) error {
+	session, release, err := cl.acquireSession(opts)
+	if err != nil {
+		cl.ExtLog.Error("failed to acquire session", zap.Error(err))
+		return err
+	}
+	defer release()
+
+	onErr := func(pm *PyMsg) {
+		cl.ExtLog.Debug("script error", zap.String("script", script),
+			zap.String("code", pm.Code), zap.Any("details", pm.Details))
+	}
+	argv := append([]string{cl.cfg.ScriptsPath + "/" + script, session}, args...)
+	env := cl.credentialsEnv(cl.Account(opts...))
+	if cl.cfg.Worker {
+		return cl.runWorker(ctx, argv, env, onOut, onErr)
+	}
+	return runPyWithStreaming(ctx, cl.cfg.VenvPath, argv, env, onOut, onErr)
+}
+
+func (cl *Client) saveCheckpoint(req Request, o *runOptions, pm *PyMsg) {
+	account, _ := cl.account(o.account)
+	cp := &Checkpoint{
+		Kind:      req.Kind(),
+		JobID:     o.jobID,
+		Account:   account.Name,
+		UpdatedAt: time.Now(),
+		State:     pm.Details,
+	}
+	if err := saveCheckpoint(req.OutputPath(), cp); err != nil {
+		cl.ExtLog.Error("failed to save checkpoint",
+			zap.String("output", req.OutputPath()), zap.Error(err))
+	}
+}
+
+func (cl *Client) journalRun(req Request, o *runOptions, started time.Time, lastErrCode string, ctxErr, err error) {
+	if cl.journal == nil {
+		return
+	}
+
+	account, _ := cl.account(o.account)
+	e := &JournalEntry{
+		JobID:         o.jobID,
+		Type:          req.Kind(),
+		Account:       account.Name,
+		Session:       account.Session,
+		StartedAt:     started,
+		EndedAt:       time.Now(),
+		Status:        RunStatusDone,
+		Output:        req.OutputPath(),
+		LastErrorCode: lastErrCode,
+	}
+	switch {
+	case ctxErr != nil:
+		e.Status = RunStatusCancelled
+	case err != nil || lastErrCode != "":
+		e.Status = RunStatusFailed
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	data, mErr := json.Marshal(req)
+	if mErr != nil {
+		cl.ExtLog.Error("failed to marshal request for journal", zap.Error(mErr))
+		return
+	}
+	e.Request = data
+
+	if jErr := cl.journal.Append(e); jErr != nil {
+		cl.ExtLog.Error("failed to append to journal",
+			zap.String("path", cl.journal.Path()), zap.Error(jErr))
+	}
+}
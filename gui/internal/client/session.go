@@ -0,0 +1,39 @@
+package client
+
+import "os"
+
+// SessionStore keeps pyrogram sessions by session name (see accounts.Account).
+//
+// If the settings store passed to [NewClient] is a SessionStore too
+// (e.g. *vault.Vault), it is used for sessions. Otherwise a session
+// is a plain file at name + ".session".
+type SessionStore interface {
+	HasSession(name string) bool
+
+	// AcquireSession returns the session name to pass to scripts.
+	// release must be called when the script is done.
+	AcquireSession(name string) (session string, release func(), err error)
+
+	DeleteSession(name string) error
+}
+
+type plainSessions struct{}
+
+func (plainSessions) HasSession(name string) bool {
+	_, err := os.Stat(name + ".session")
+	return err == nil
+}
+
+// AcquireSession returns the name relative to the scripts dir,
+// pyrogram workdir is there.
+func (plainSessions) AcquireSession(name string) (string, func(), error) {
+	return "../" + name, func() {}, nil
+}
+
+func (plainSessions) DeleteSession(name string) error {
+	err := os.Remove(name + ".session")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,431 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"go.uber.org/zap"
+)
+
+var ErrWorkerExited = errors.New("worker exited")
+
+// JSON-RPC error code of a cancelled call, see scripts/worker.py.
+const rpcRequestCancelled = -32800
+
+// workerShutdownTimeout is how long the worker gets to stop its clients.
+const workerShutdownTimeout = 5 * time.Second
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// rpcMessage is a response or a notification from the worker.
+type rpcMessage struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+
+	// Data is the last error envelope of the script, may be nil.
+	Data *PyMsg `json:"data"`
+}
+
+type workerEvent struct {
+	Call     int64      `json:"call"`
+	Envelope PyEnvelope `json:"envelope"`
+}
+
+type workerCall struct {
+	onEvent func(*PyEnvelope)
+	done    chan workerResult
+}
+
+type workerResult struct {
+	result json.RawMessage
+	err    error
+}
+
+// worker is a long-lived scripts/worker.py process. Script runs are
+// JSON-RPC calls over its stdin/stdout, envelopes of a run come back as
+// "event" notifications. Telegram clients stay connected between runs.
+type worker struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	log   *zap.Logger
+
+	writeMu sync.Mutex
+
+	mu     sync.Mutex
+	nextID int64
+	calls  map[int64]*workerCall
+	err    error
+	exited chan struct{}
+}
+
+func startWorker(venv, scriptsPath, logPath string, log *zap.Logger) (*worker, error) {
+	cmd := exec.Command(venv+"/bin/python3", scriptsPath+"/worker.py")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	logf, _ := os.OpenFile(logPath+"/worker.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	cmd.Stderr = logf
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	w := &worker{
+		cmd:    cmd,
+		stdin:  stdin,
+		log:    log,
+		calls:  make(map[int64]*workerCall),
+		exited: make(chan struct{}),
+	}
+	go w.readLoop(stdout, logf)
+	log.Info("worker started", zap.Int("pid", cmd.Process.Pid))
+	return w, nil
+}
+
+func (w *worker) readLoop(stdout io.Reader, logf *os.File) {
+	r := bufio.NewReader(stdout)
+	for {
+		// no line limit, checkpoints of big chats may be large
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			w.handle(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	waitErr := w.cmd.Wait()
+	if logf != nil {
+		_ = logf.Close()
+	}
+	exitErr := ErrWorkerExited
+	if waitErr != nil {
+		exitErr = fmt.Errorf("%w: %v", ErrWorkerExited, waitErr)
+	}
+	w.log.Info("worker exited", zap.Error(waitErr))
+
+	w.mu.Lock()
+	w.err = exitErr
+	calls := w.calls
+	w.calls = map[int64]*workerCall{}
+	w.mu.Unlock()
+	for _, c := range calls {
+		c.done <- workerResult{err: exitErr}
+	}
+	close(w.exited)
+}
+
+func (w *worker) handle(line []byte) {
+	var msg rpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		w.log.Warn("bad message from worker", zap.ByteString("line", line), zap.Error(err))
+		return
+	}
+
+	if msg.Method == "event" {
+		var ev workerEvent
+		if err := json.Unmarshal(msg.Params, &ev); err != nil {
+			w.log.Warn("bad event from worker", zap.Error(err))
+			return
+		}
+		w.mu.Lock()
+		c := w.calls[ev.Call]
+		w.mu.Unlock()
+		if c != nil && c.onEvent != nil {
+			c.onEvent(&ev.Envelope)
+		}
+		return
+	}
+	if msg.ID == nil {
+		if msg.Error != nil {
+			w.log.Warn("worker error", zap.String("message", msg.Error.Message))
+		}
+		return
+	}
+
+	w.mu.Lock()
+	c := w.calls[*msg.ID]
+	delete(w.calls, *msg.ID)
+	w.mu.Unlock()
+	if c == nil {
+		return
+	}
+
+	res := workerResult{result: msg.Result}
+	switch e := msg.Error; {
+	case e == nil:
+	case e.Code == rpcRequestCancelled:
+		res.err = context.Canceled
+	case e.Data != nil && e.Data.Code != "":
+		res.err = apperrors.NewScriptError(e.Data.Code, e.Data.Details, nil)
+	default:
+		res.err = fmt.Errorf("worker error %d: %s", e.Code, e.Message)
+	}
+	c.done <- res
+}
+
+func (w *worker) send(req rpcRequest) error {
+	req.JSONRPC = "2.0"
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	_, err = w.stdin.Write(data)
+	return err
+}
+
+// call calls method and waits for the response. Notifications of the
+// call are passed to onEvent. When ctx is done, the call is cancelled
+// and ctx.Err() is returned.
+func (w *worker) call(ctx context.Context, method string, params any, onEvent func(*PyEnvelope)) (json.RawMessage, error) {
+	c := &workerCall{onEvent: onEvent, done: make(chan workerResult, 1)}
+
+	w.mu.Lock()
+	if w.err != nil {
+		w.mu.Unlock()
+		return nil, w.err
+	}
+	w.nextID++
+	id := w.nextID
+	w.calls[id] = c
+	w.mu.Unlock()
+
+	if err := w.send(rpcRequest{ID: &id, Method: method, Params: params}); err != nil {
+		w.mu.Lock()
+		delete(w.calls, id)
+		w.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case res := <-c.done:
+		return res.result, res.err
+	case <-ctx.Done():
+	}
+
+	_ = w.send(rpcRequest{Method: "cancel", Params: map[string]any{"call": id}})
+	select {
+	case <-c.done:
+	case <-time.After(stopGracePeriod):
+		w.log.Warn("worker call was not cancelled in time", zap.Int64("call", id))
+		w.mu.Lock()
+		delete(w.calls, id)
+		w.mu.Unlock()
+	}
+	return nil, ctx.Err()
+}
+
+func (w *worker) alive() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err == nil
+}
+
+// stop asks the worker to stop its clients and exit,
+// the process group is killed if it doesn't.
+func (w *worker) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), workerShutdownTimeout)
+	defer cancel()
+	if _, err := w.call(ctx, "shutdown", nil, nil); err != nil && !errors.Is(err, ErrWorkerExited) {
+		w.log.Warn("worker shutdown failed", zap.Error(err))
+	}
+	_ = w.stdin.Close()
+
+	select {
+	case <-w.exited:
+	case <-time.After(stopGracePeriod):
+		terminateGroup(w.cmd.Process.Pid, w.exited, stopGracePeriod)
+		<-w.exited
+	}
+}
+
+// heldSession is a session acquired for the worker,
+// it is held while the worker may keep its client.
+type heldSession struct {
+	session string
+	release func()
+
+	// refs counts the calls using a vault session
+	refs int
+}
+
+// runWorker runs the script of args in the worker, see [Client.runPy].
+// env is set for the call only, the worker is shared by accounts.
+func (cl *Client) runWorker(ctx context.Context, args []string, env map[string]string, onOut func(string, *PyMsg), onErr func(*PyMsg)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	w, err := cl.getWorker()
+	if err != nil {
+		return err
+	}
+
+	params := map[string]any{
+		"script": strings.TrimSuffix(filepath.Base(args[0]), ".py"),
+		"args":   args[1:],
+	}
+	if len(env) > 0 {
+		params["env"] = env
+	}
+	_, err = w.call(ctx, "run", params, func(env *PyEnvelope) {
+		env.dispatch(onOut, onErr)
+	})
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if errors.Is(err, ErrWorkerExited) {
+		pm := &PyMsg{
+			Code:    "SCRIPT_UNCAUGHT_ERROR",
+			Details: map[string]any{"error": err.Error()},
+		}
+		if onErr != nil {
+			onErr(pm)
+		}
+		return apperrors.NewScriptError(pm.Code, pm.Details, err)
+	}
+	return err
+}
+
+// getWorker returns the running worker, it is (re)started if needed.
+func (cl *Client) getWorker() (*worker, error) {
+	cl.workerMu.Lock()
+	defer cl.workerMu.Unlock()
+	if cl.worker != nil && cl.worker.alive() {
+		return cl.worker, nil
+	}
+	if cl.worker != nil {
+		// the clients of the dead worker are gone
+		cl.releaseHeldSessions()
+	}
+
+	w, err := startWorker(cl.cfg.VenvPath, cl.cfg.ScriptsPath, cl.cfg.LogPath, cl.ExtLog)
+	if err != nil {
+		cl.ExtLog.Error("failed to start worker", zap.Error(err))
+		return nil, err
+	}
+	cl.worker = w
+	return w, nil
+}
+
+// holdSession acquires the session name for the worker. A plain session
+// is held until [Client.StopWorker] or [Client.Logout], so the worker keeps
+// its client connected between calls. A session of the vault is decrypted
+// only while calls use it: after the last one is released, the worker
+// client is stopped and the session is stored back.
+func (cl *Client) holdSession(name string) (string, func(), error) {
+	cl.workerMu.Lock()
+	defer cl.workerMu.Unlock()
+	h, ok := cl.heldSessions[name]
+	if !ok {
+		session, release, err := cl.sessions.AcquireSession(name)
+		if err != nil {
+			return "", nil, err
+		}
+		h = &heldSession{session: session, release: release}
+		cl.heldSessions[name] = h
+	}
+	if _, plain := cl.sessions.(plainSessions); plain {
+		return h.session, func() {}, nil
+	}
+
+	h.refs++
+	var once sync.Once
+	release := func() {
+		once.Do(func() { cl.unholdSession(name, h) })
+	}
+	return h.session, release, nil
+}
+
+// unholdSession releases a call of the vault session name,
+// see [Client.holdSession].
+func (cl *Client) unholdSession(name string, h *heldSession) {
+	cl.workerMu.Lock()
+	defer cl.workerMu.Unlock()
+	h.refs--
+	if h.refs > 0 || cl.heldSessions[name] != h {
+		return
+	}
+	cl.closeHeldSession(name, h)
+}
+
+// closeWorkerSession stops the worker client of the session name
+// and releases the session.
+func (cl *Client) closeWorkerSession(name string) {
+	cl.workerMu.Lock()
+	defer cl.workerMu.Unlock()
+	if h, ok := cl.heldSessions[name]; ok {
+		cl.closeHeldSession(name, h)
+	}
+}
+
+// closeHeldSession must be called with workerMu held. The worker client
+// is stopped first, so pyrogram writes the session before it is released.
+func (cl *Client) closeHeldSession(name string, h *heldSession) {
+	if cl.worker != nil && cl.worker.alive() {
+		ctx, cancel := context.WithTimeout(context.Background(), workerShutdownTimeout)
+		_, err := cl.worker.call(ctx, "close_session", map[string]any{"session": h.session}, nil)
+		cancel()
+		if err != nil {
+			cl.ExtLog.Warn("failed to close worker session", zap.String("session", name), zap.Error(err))
+		}
+	}
+	h.release()
+	delete(cl.heldSessions, name)
+}
+
+// releaseHeldSessions must be called with workerMu held.
+func (cl *Client) releaseHeldSessions() {
+	for name, h := range cl.heldSessions {
+		h.release()
+		delete(cl.heldSessions, name)
+	}
+}
+
+// StopWorker stops the worker, if it was started, and releases
+// the sessions it used. Running calls are cancelled.
+func (cl *Client) StopWorker() {
+	cl.workerMu.Lock()
+	defer cl.workerMu.Unlock()
+	if cl.worker == nil {
+		return
+	}
+	cl.worker.stop()
+	cl.worker = nil
+	cl.releaseHeldSessions()
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"encoding/json"
 	"reflect"
@@ -26,8 +27,46 @@ type AppConfig struct {
 	ScriptsPath string `mapstructure:"scripts_path" validate:"required"`
 	Session     string `mapstructure:"session_name" validate:"required,filepath"`
 	LogPath     string `mapstructure:"log_path" validate:"required,dirpath"`
-	CreatorURI  string `mapstructure:"creator_uri" validate:"required,uri"`
 	ForceAuth   bool   `mapstructure:"force_auth"`
+
+	// CreatorURI is where the creator server listens: unix:///path/to.sock,
+	// unix:// for a socket in the runtime dir, or http://host with a port
+	// picked free when the server starts.
+	CreatorURI string `mapstructure:"creator_uri" validate:"required,uri"`
+
+	// CreatorTimeout is the timeout of a call to the creator server, e.g. "3s".
+	// Failed calls are repeated CreatorRetries times, see package creator.
+	CreatorTimeout time.Duration `mapstructure:"creator_timeout" validate:"omitempty,min=0"`
+	CreatorRetries *int          `mapstructure:"creator_retries" validate:"omitempty,min=0"`
+
+	// JobsPerSession limits how many scripts may run at once
+	// with the same session. Default is 1.
+	JobsPerSession int `mapstructure:"jobs_per_session" validate:"omitempty,min=1"`
+
+	// JournalPath is the JSON Lines file every executed request
+	// is appended to. Empty disables the journal.
+	JournalPath string `mapstructure:"journal_path" validate:"omitempty,filepath"`
+
+	// StorePath is the SQLite database the outputs of done jobs are
+	// ingested into, see package store. Empty disables the store.
+	StorePath string `mapstructure:"store_path" validate:"omitempty,filepath"`
+
+	// VaultPath is the encrypted file API credentials and the session
+	// are kept in. Empty keeps them in plain preferences and session file.
+	VaultPath string `mapstructure:"vault_path" validate:"omitempty,filepath"`
+
+	// AccountPool moves the rest of a resumable job to the next logged in
+	// account when a flood wait is longer than FloodWaitThreshold seconds.
+	AccountPool        bool `mapstructure:"account_pool"`
+	FloodWaitThreshold int  `mapstructure:"flood_wait_threshold" validate:"omitempty,min=1"`
+
+	// Worker runs scripts in one long-lived python process (scripts/worker.py)
+	// instead of a process per job, telegram clients stay connected.
+	Worker bool `mapstructure:"worker"`
+
+	// HealthCheckInterval is how often the main screen checks that
+	// the session is authorized, e.g. "1m". Default is 1 minute.
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval" validate:"omitempty,min=0"`
 }
 
 func LoadConfig[T any](name, ext string, paths ...string) (*T, error) {
@@ -0,0 +1,312 @@
+// Package creator is the client of the creator server (scripts/connect.py),
+// which logs an account in and writes its session. The server listens on
+// TCP (http://host:port) or on a unix socket (unix:///path/to.sock).
+//
+// Requests have JSON bodies, so secrets (API hash, code, 2FA password)
+// never get to URLs. Server errors are returned as [*Error] with the
+// telegram error code, e.g. PHONE_CODE_INVALID.
+package creator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultTimeout = 3 * time.Second
+	DefaultRetries = 2
+
+	defaultBackoff = 200 * time.Millisecond
+)
+
+// Client calls the creator server. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	log     *zap.Logger
+}
+
+// Option configures a [Client].
+type Option func(*Client)
+
+// WithTimeout sets the timeout of a single attempt. Default is [DefaultTimeout].
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.timeout = d
+		}
+	}
+}
+
+// WithRetries sets how many times a failed call is repeated, the wait
+// between attempts starts at backoff and doubles. Default is [DefaultRetries].
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		if n >= 0 {
+			c.retries = n
+		}
+		if backoff > 0 {
+			c.backoff = backoff
+		}
+	}
+}
+
+// WithHTTPClient sets the HTTP client, e.g. with a custom transport.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.http = hc
+		}
+	}
+}
+
+func WithLogger(log *zap.Logger) Option {
+	return func(c *Client) {
+		if log != nil {
+			c.log = log
+		}
+	}
+}
+
+// New returns a client of the server at baseURL, e.g. http://127.0.0.1:9001
+// or unix:///run/user/1000/tdsoft/creator.sock.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    http.DefaultClient,
+		timeout: DefaultTimeout,
+		retries: DefaultRetries,
+		backoff: defaultBackoff,
+		log:     zap.NewNop(),
+	}
+	if path, ok := SocketPath(baseURL); ok {
+		// the host is not used, requests go to the socket
+		c.baseURL = "http://creator"
+		c.http = &http.Client{Transport: unixTransport(path)}
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SocketPath returns the socket of a unix:// uri.
+func SocketPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "unix" {
+		return "", false
+	}
+	return u.Path, true
+}
+
+func unixTransport(path string) *http.Transport {
+	var d net.Dialer
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", path)
+		},
+		MaxIdleConns:    2,
+		IdleConnTimeout: 30 * time.Second,
+	}
+}
+
+// Ping checks that the server is up. It is not retried.
+func (c *Client) Ping(ctx context.Context) error {
+	var res MessageResponse
+	if err := c.attempt(ctx, http.MethodGet, "/ping?message=ping", nil, &res); err != nil {
+		return err
+	}
+	if res.Message != "pong" {
+		return &Error{Code: ErrUnexpectedPingMessage.Code, Message: res.Message, Status: http.StatusOK}
+	}
+	return nil
+}
+
+// SetSessionPath sets the session the server logs in, without ".session".
+func (c *Client) SetSessionPath(ctx context.Context, path string) error {
+	return c.do(ctx, http.MethodPost, "/session_path", SessionPathRequest{Path: path}, nil, true)
+}
+
+// SendAPIData creates the telegram client of the session and connects it.
+func (c *Client) SendAPIData(ctx context.Context, req APIDataRequest) (*APIDataResponse, error) {
+	var res APIDataResponse
+	if err := c.do(ctx, http.MethodPost, "/api_data", req, &res, true); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SendCode sends the login code to the phone.
+func (c *Client) SendCode(ctx context.Context, phone string) (*SendCodeResponse, error) {
+	var res SendCodeResponse
+	if err := c.do(ctx, http.MethodPost, "/send_code", SendCodeRequest{Phone: phone}, &res, false); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ResendCode sends the code again, the way of NextType of the last
+// [SendCodeResponse], e.g. by a call.
+func (c *Client) ResendCode(ctx context.Context, phone string) (*SendCodeResponse, error) {
+	var res SendCodeResponse
+	if err := c.do(ctx, http.MethodPost, "/resend_code", ResendCodeRequest{Phone: phone}, &res, false); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SignIn signs in with the code. Returns [ErrPasswordNeeded] if the
+// account has 2FA, then call [Client.CheckPassword]. The password hint
+// is in Details["hint"] of the error, see [PasswordHint].
+func (c *Client) SignIn(ctx context.Context, req SignInRequest) error {
+	return c.do(ctx, http.MethodPost, "/sign_in", req, nil, false)
+}
+
+func (c *Client) CheckPassword(ctx context.Context, password string) error {
+	return c.do(ctx, http.MethodPost, "/check_password", CheckPasswordRequest{Password: password}, nil, false)
+}
+
+// QRLogin exports a login token or, if the last one was accepted, signs in
+// with it. It is polled while the QR code is shown. Returns
+// [ErrPasswordNeeded] if the account has 2FA, like [Client.SignIn].
+func (c *Client) QRLogin(ctx context.Context) (*QRLoginResponse, error) {
+	var res QRLoginResponse
+	if err := c.do(ctx, http.MethodPost, "/qr_login", nil, &res, false); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetMe returns the signed in user.
+func (c *Client) GetMe(ctx context.Context) (*Me, error) {
+	var me Me
+	if err := c.do(ctx, http.MethodGet, "/get_me", nil, &me, true); err != nil {
+		return nil, err
+	}
+	return &me, nil
+}
+
+// Shutdown asks the server to exit. It is not retried.
+func (c *Client) Shutdown(ctx context.Context) error {
+	return c.attempt(ctx, http.MethodPost, "/shutdown", nil, nil)
+}
+
+// do calls the server with retries. Idempotent calls are retried on
+// transport errors and 5xx responses, the others only if the server
+// refused the connection, so a code is never sent or checked twice.
+func (c *Client) do(ctx context.Context, method, path string, body, out any, idempotent bool) error {
+	wait := c.backoff
+	for i := 0; ; i++ {
+		err := c.attempt(ctx, method, path, body, out)
+		if err == nil || i >= c.retries || !retryable(err, idempotent) {
+			return err
+		}
+		c.log.Warn("creator call failed, retrying",
+			zap.String("path", path), zap.Int("attempt", i+1), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, body, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp.StatusCode, data)
+	}
+	c.log.Debug("creator response", zap.String("path", path), zap.Int("status", resp.StatusCode))
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return &Error{Code: ErrBadResponse.Code, Message: err.Error(), Status: resp.StatusCode}
+	}
+	return nil
+}
+
+// decodeError returns the error of a non 2xx response. Bodies without
+// {"error": {...}}, e.g. validation errors of FastAPI, get a code by status.
+func decodeError(status int, data []byte) error {
+	var res errorResponse
+	if err := json.Unmarshal(data, &res); err == nil && res.Error != nil && res.Error.Code != "" {
+		res.Error.Status = status
+		return res.Error
+	}
+
+	code := ErrBadResponse.Code
+	if status >= 500 {
+		code = ErrUnexpected.Code
+	}
+	msg := strings.TrimSpace(string(data))
+	if len(msg) > 200 {
+		msg = msg[:200]
+	}
+	return &Error{Code: code, Message: fmt.Sprintf("%s: %s", http.StatusText(status), msg), Status: status}
+}
+
+func retryable(err error, idempotent bool) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	// ENOENT: the socket of a restarted server is not created yet
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status >= 500
+	}
+	// transport errors, including the timeout of an attempt
+	return true
+}
@@ -0,0 +1,259 @@
+package creator_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/creator"
+	"github.com/mauzec/tdsoft/gui/internal/creator/creatortest"
+)
+
+// recorder is a transport keeping the requests it sends.
+type recorder struct {
+	mu   sync.Mutex
+	reqs []recorded
+}
+
+type recorded struct {
+	method, url, contentType, body string
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body = io.NopCloser(strings.NewReader(string(body)))
+	}
+	r.mu.Lock()
+	r.reqs = append(r.reqs, recorded{req.Method, req.URL.String(), req.Header.Get("Content-Type"), string(body)})
+	r.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newClient(s *creatortest.Server, opts ...creator.Option) *creator.Client {
+	opts = append([]creator.Option{creator.WithRetries(2, time.Millisecond)}, opts...)
+	return creator.New(s.URL, opts...)
+}
+
+func TestClientJSONBodies(t *testing.T) {
+	s := creatortest.NewServer()
+	defer s.Close()
+	rec := &recorder{}
+	c := newClient(s, creator.WithHTTPClient(&http.Client{Transport: rec}))
+	ctx := context.Background()
+
+	if err := c.SetSessionPath(ctx, "/tmp/first"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.SendAPIData(ctx, creator.APIDataRequest{APIID: "1", APIHash: "secret-hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Session != "/tmp/first" {
+		t.Errorf("session = %q, want /tmp/first", res.Session)
+	}
+	if _, err := c.SendCode(ctx, "+100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SignIn(ctx, creator.SignInRequest{Phone: "+100", Code: creatortest.DefaultCode}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.SignedIn() {
+		t.Error("not signed in")
+	}
+
+	for _, r := range rec.reqs {
+		if r.method != http.MethodPost {
+			continue
+		}
+		if r.contentType != "application/json" {
+			t.Errorf("%s: content type %q", r.url, r.contentType)
+		}
+		for _, secret := range []string{"secret-hash", creatortest.DefaultCode} {
+			if strings.Contains(r.url, secret) {
+				t.Errorf("%s: secret in url", r.url)
+			}
+		}
+	}
+	if body := rec.reqs[1].body; !strings.Contains(body, `"secret-hash"`) {
+		t.Errorf("api_data body = %s", body)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	s := creatortest.NewServer()
+	defer s.Close()
+	c := newClient(s)
+	ctx := context.Background()
+
+	_, err := c.SendCode(ctx, "+100")
+	if !errors.Is(err, creator.ErrClientNotInitialized) {
+		t.Fatalf("err = %v, want %v", err, creator.ErrClientNotInitialized)
+	}
+	var e *creator.Error
+	if !errors.As(err, &e) || e.Status != http.StatusConflict {
+		t.Errorf("err = %#v, want status %d", err, http.StatusConflict)
+	}
+
+	s.SetPassword("pass", "my hint")
+	if _, err := c.SendAPIData(ctx, creator.APIDataRequest{APIID: "1", APIHash: "h"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendCode(ctx, "+100"); err != nil {
+		t.Fatal(err)
+	}
+	err = c.SignIn(ctx, creator.SignInRequest{Phone: "+100", Code: "1"})
+	if !errors.Is(err, creator.ErrPhoneCodeInvalid) {
+		t.Errorf("err = %v, want %v", err, creator.ErrPhoneCodeInvalid)
+	}
+	err = c.SignIn(ctx, creator.SignInRequest{Phone: "+100", Code: creatortest.DefaultCode})
+	if !errors.Is(err, creator.ErrPasswordNeeded) {
+		t.Fatalf("err = %v, want %v", err, creator.ErrPasswordNeeded)
+	}
+	if hint := creator.PasswordHint(err); hint != "my hint" {
+		t.Errorf("hint = %q, want %q", hint, "my hint")
+	}
+}
+
+func TestClientUnstructuredError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	c := creator.New(srv.URL, creator.WithRetries(0, 0))
+
+	_, err := c.GetMe(context.Background())
+	var e *creator.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("err = %v, want *creator.Error", err)
+	}
+	if e.Code != creator.ErrUnexpected.Code || e.Status != http.StatusInternalServerError {
+		t.Errorf("err = %#v", e)
+	}
+}
+
+func TestClientRetriesIdempotent(t *testing.T) {
+	s := creatortest.NewServer()
+	defer s.Close()
+	c := newClient(s)
+
+	unavailable := &creator.Error{Code: "UNAVAILABLE", Status: http.StatusServiceUnavailable}
+	s.FailNext("/session_path", unavailable)
+	s.FailNext("/session_path", unavailable)
+	if err := c.SetSessionPath(context.Background(), "/tmp/first"); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Calls("/session_path"); n != 3 {
+		t.Errorf("calls = %d, want 3", n)
+	}
+
+	// client errors are not retried
+	s.FailNext("/session_path", &creator.Error{Code: "BAD", Status: http.StatusBadRequest})
+	if err := c.SetSessionPath(context.Background(), "/tmp/first"); err == nil {
+		t.Fatal("no error")
+	}
+	if n := s.Calls("/session_path"); n != 4 {
+		t.Errorf("calls = %d, want 4", n)
+	}
+}
+
+func TestClientNoRetryNonIdempotent(t *testing.T) {
+	s := creatortest.NewServer()
+	defer s.Close()
+	c := newClient(s)
+	ctx := context.Background()
+	if _, err := c.SendAPIData(ctx, creator.APIDataRequest{APIID: "1", APIHash: "h"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.FailNext("/send_code", &creator.Error{Code: "UNAVAILABLE", Status: http.StatusServiceUnavailable})
+	if _, err := c.SendCode(ctx, "+100"); err == nil {
+		t.Fatal("no error")
+	}
+	if n := s.Calls("/send_code"); n != 1 {
+		t.Errorf("send_code calls = %d, want 1", n)
+	}
+}
+
+func TestClientRetriesRefusedConnection(t *testing.T) {
+	s := creatortest.NewServer()
+	defer s.Close()
+
+	// a closed listener refuses connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := l.Addr().String()
+	l.Close()
+
+	var (
+		mu     sync.Mutex
+		refuse int
+		dials  int
+	)
+	var d net.Dialer
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			dials++
+			if refuse > 0 {
+				refuse--
+				addr = refused
+			}
+			mu.Unlock()
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	c := newClient(s, creator.WithHTTPClient(&http.Client{Transport: transport}))
+	ctx := context.Background()
+	if _, err := c.SendAPIData(ctx, creator.APIDataRequest{APIID: "1", APIHash: "h"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the code was not sent by the refused attempt, so it is safe to retry
+	mu.Lock()
+	refuse, dials = 1, 0
+	mu.Unlock()
+	if _, err := c.SendCode(ctx, "+100"); err != nil {
+		t.Fatal(err)
+	}
+	if dials != 2 || s.Calls("/send_code") != 1 {
+		t.Errorf("dials = %d, send_code calls = %d, want 2 and 1", dials, s.Calls("/send_code"))
+	}
+
+	mu.Lock()
+	refuse, dials = 10, 0
+	mu.Unlock()
+	_, err = c.SendCode(ctx, "+100")
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("err = %v, want ECONNREFUSED", err)
+	}
+	if dials != 3 {
+		t.Errorf("dials = %d, want 3", dials)
+	}
+}
+
+func TestClientShutdown(t *testing.T) {
+	s := creatortest.NewServer()
+	defer s.Close()
+	rec := &recorder{}
+	c := newClient(s, creator.WithHTTPClient(&http.Client{Transport: rec}))
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if m := rec.reqs[0].method; m != http.MethodPost {
+		t.Errorf("method = %s, want %s", m, http.MethodPost)
+	}
+}
@@ -0,0 +1,301 @@
+// Package creatortest provides a fake creator server for tests,
+// it speaks the protocol of scripts/connect.py without telegram.
+package creatortest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/creator"
+)
+
+const (
+	DefaultCode = "12345"
+	defaultUser = "tester"
+)
+
+// Server is a fake creator server. The login code is [DefaultCode],
+// the account has 2FA after [Server.SetPassword].
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	password string
+	hint     string
+	resent   int
+	session  string
+	apiID    string
+	phone    string
+	codeSent bool
+	signedIn bool
+	// qrToken is the exported login token, qrAccepted is set by AcceptQR
+	qrToken    int
+	qrExpires  time.Time
+	qrAccepted bool
+	calls      map[string]int
+	failures   map[string][]*creator.Error
+}
+
+// NewServer starts a fake server, stop it with Close.
+func NewServer() *Server {
+	s := &Server{
+		calls:    make(map[string]int),
+		failures: make(map[string][]*creator.Error),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ping", s.handle(s.ping))
+	mux.HandleFunc("POST /session_path", s.handle(s.sessionPath))
+	mux.HandleFunc("POST /api_data", s.handle(s.apiData))
+	mux.HandleFunc("POST /send_code", s.handle(s.sendCode))
+	mux.HandleFunc("POST /resend_code", s.handle(s.resendCode))
+	mux.HandleFunc("POST /sign_in", s.handle(s.signIn))
+	mux.HandleFunc("POST /qr_login", s.handle(s.qrLogin))
+	mux.HandleFunc("POST /check_password", s.handle(s.checkPassword))
+	mux.HandleFunc("GET /get_me", s.handle(s.getMe))
+	mux.HandleFunc("POST /shutdown", s.handle(s.shutdown))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// SetPassword enables 2FA with password and its hint, empty disables it.
+func (s *Server) SetPassword(password, hint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password, s.hint = password, hint
+}
+
+// QRTTL is how long a login token of the fake server is valid.
+const QRTTL = 30 * time.Second
+
+// AcceptQR accepts the last login token, as scanning it in the app does.
+func (s *Server) AcceptQR() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.qrAccepted = true
+}
+
+// ExpireQR makes the last login token expired, the next poll gets a new one.
+func (s *Server) ExpireQR() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.qrExpires = time.Time{}
+}
+
+// FailNext makes the next call of path, e.g. "/sign_in", fail with err.
+// Failures of a path are returned in order.
+func (s *Server) FailNext(path string, err *creator.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = append(s.failures[path], err)
+}
+
+// Calls returns how many times path was called, including failures.
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[path]
+}
+
+// Session returns the session path set by the client.
+func (s *Server) Session() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.session
+}
+
+func (s *Server) SignedIn() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signedIn
+}
+
+type handlerFunc func(r *http.Request) (any, *creator.Error)
+
+// handle counts the call, returns a queued failure or
+// calls h with mu held and writes its result.
+func (s *Server) handle(h handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls[r.URL.Path]++
+		var (
+			res any
+			err *creator.Error
+		)
+		if q := s.failures[r.URL.Path]; len(q) > 0 {
+			err, s.failures[r.URL.Path] = q[0], q[1:]
+		} else {
+			res, err = h(r)
+		}
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			status := err.Status
+			if status == 0 {
+				status = http.StatusBadRequest
+			}
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": err})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
+
+func decode(r *http.Request, v any) *creator.Error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return &creator.Error{Code: "BAD_REQUEST", Message: err.Error(), Status: http.StatusUnprocessableEntity}
+	}
+	return nil
+}
+
+func errorOf(sentinel *creator.Error, status int, msg string) *creator.Error {
+	return &creator.Error{Code: sentinel.Code, Message: msg, Status: status}
+}
+
+func (s *Server) ping(r *http.Request) (any, *creator.Error) {
+	msg := "saimon"
+	if r.URL.Query().Get("message") == "ping" {
+		msg = "pong"
+	}
+	return creator.MessageResponse{Message: msg}, nil
+}
+
+func (s *Server) sessionPath(r *http.Request) (any, *creator.Error) {
+	var req creator.SessionPathRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	s.session = req.Path
+	return creator.MessageResponse{Message: "session path set to " + req.Path}, nil
+}
+
+func (s *Server) apiData(r *http.Request) (any, *creator.Error) {
+	var req creator.APIDataRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if req.APIID == "" || req.APIHash == "" {
+		return nil, errorOf(creator.ErrAPIIDInvalid, http.StatusBadRequest, "the api_id/api_hash combination is invalid")
+	}
+	s.apiID = req.APIID
+	s.codeSent, s.signedIn = false, false
+	return creator.APIDataResponse{Message: "client initialized", Session: s.session}, nil
+}
+
+func (s *Server) sendCode(r *http.Request) (any, *creator.Error) {
+	var req creator.SendCodeRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if s.apiID == "" {
+		return nil, errorOf(creator.ErrClientNotInitialized, http.StatusConflict, "client is not initialized")
+	}
+	if req.Phone == "" {
+		return nil, errorOf(creator.ErrPhoneNumberInvalid, http.StatusBadRequest, "the phone number is invalid")
+	}
+	s.phone = req.Phone
+	s.codeSent = true
+	s.resent = 0
+	return creator.SendCodeResponse{Message: "code sent", Type: "APP", NextType: "SMS", Timeout: 60}, nil
+}
+
+// resendCode sends the code by SMS, then by a call, then fails.
+func (s *Server) resendCode(r *http.Request) (any, *creator.Error) {
+	var req creator.ResendCodeRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if !s.codeSent || req.Phone != s.phone {
+		return nil, errorOf(creator.ErrCodeNotSent, http.StatusConflict, "code not sent")
+	}
+	s.resent++
+	switch s.resent {
+	case 1:
+		return creator.SendCodeResponse{Message: "code resent", Type: "SMS", NextType: "CALL", Timeout: 60}, nil
+	case 2:
+		return creator.SendCodeResponse{Message: "code resent", Type: "CALL"}, nil
+	}
+	return nil, errorOf(creator.ErrSendCodeUnavailable, http.StatusBadRequest, "no other way to send the code")
+}
+
+func (s *Server) signIn(r *http.Request) (any, *creator.Error) {
+	var req creator.SignInRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if s.apiID == "" {
+		return nil, errorOf(creator.ErrClientNotInitialized, http.StatusConflict, "client is not initialized")
+	}
+	if !s.codeSent {
+		return nil, errorOf(creator.ErrCodeNotSent, http.StatusConflict, "code not sent")
+	}
+	if req.Phone != s.phone || req.Code != DefaultCode {
+		return nil, errorOf(creator.ErrPhoneCodeInvalid, http.StatusBadRequest, "the confirmation code is invalid")
+	}
+	if s.password != "" {
+		err := errorOf(creator.ErrPasswordNeeded, http.StatusUnauthorized, "password needed")
+		err.Details = map[string]any{"hint": s.hint}
+		return nil, err
+	}
+	s.signedIn = true
+	return creator.MessageResponse{Message: "signed in"}, nil
+}
+
+func (s *Server) qrLogin(r *http.Request) (any, *creator.Error) {
+	if s.apiID == "" {
+		return nil, errorOf(creator.ErrClientNotInitialized, http.StatusConflict, "client is not initialized")
+	}
+	if s.qrAccepted {
+		s.qrAccepted = false
+		if s.password != "" {
+			err := errorOf(creator.ErrPasswordNeeded, http.StatusUnauthorized, "password needed")
+			err.Details = map[string]any{"hint": s.hint}
+			return nil, err
+		}
+		s.signedIn = true
+		return creator.QRLoginResponse{Status: creator.QRSuccess}, nil
+	}
+	if time.Now().After(s.qrExpires) {
+		s.qrToken++
+		s.qrExpires = time.Now().Add(QRTTL)
+	}
+	return creator.QRLoginResponse{
+		Status:  creator.QRPending,
+		Token:   "token" + strconv.Itoa(s.qrToken),
+		Expires: s.qrExpires.Unix(),
+	}, nil
+}
+
+func (s *Server) checkPassword(r *http.Request) (any, *creator.Error) {
+	var req creator.CheckPasswordRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if s.apiID == "" {
+		return nil, errorOf(creator.ErrClientNotInitialized, http.StatusConflict, "client is not initialized")
+	}
+	if req.Password != s.password {
+		return nil, errorOf(creator.ErrPasswordHashInvalid, http.StatusBadRequest, "the password is invalid")
+	}
+	s.signedIn = true
+	return creator.MessageResponse{Message: "signed in"}, nil
+}
+
+func (s *Server) getMe(r *http.Request) (any, *creator.Error) {
+	if s.apiID == "" {
+		return nil, errorOf(creator.ErrClientNotInitialized, http.StatusConflict, "client is not initialized")
+	}
+	if !s.signedIn {
+		return nil, &creator.Error{Code: "AUTH_KEY_UNREGISTERED", Message: "the key is not registered in the system", Status: http.StatusUnauthorized}
+	}
+	return creator.Me{ID: 1, FirstName: "Test", Username: defaultUser}, nil
+}
+
+func (s *Server) shutdown(r *http.Request) (any, *creator.Error) {
+	return creator.MessageResponse{Message: "server shutting down"}, nil
+}
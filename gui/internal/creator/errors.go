@@ -0,0 +1,85 @@
+package creator
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Error is a structured error returned by the creator server.
+//
+// Use errors.Is with sentinel values below to check the code,
+// and errors.As to get the details.
+type Error struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+
+	// Status is the HTTP status of the response.
+	Status int `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := "creator error " + e.Code
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if len(e.Details) == 0 {
+		return msg
+	}
+	parts := make([]string, 0, len(e.Details))
+	for _, k := range slices.Sorted(maps.Keys(e.Details)) {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, e.Details[k]))
+	}
+	return fmt.Sprintf("%s (%s)", msg, strings.Join(parts, ", "))
+}
+
+// Is reports whether target is an *Error with the same code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// PasswordHint returns the hint of the 2FA password
+// from an [ErrPasswordNeeded] error.
+func PasswordHint(err error) string {
+	var e *Error
+	if !errors.As(err, &e) {
+		return ""
+	}
+	hint, _ := e.Details["hint"].(string)
+	return hint
+}
+
+// FloodWait returns the seconds to wait from an [ErrFloodWait] error.
+func FloodWait(err error) (int, bool) {
+	var e *Error
+	if !errors.As(err, &e) || e.Code != ErrFloodWait.Code {
+		return 0, false
+	}
+	v, ok := e.Details["value"].(float64)
+	return int(v), ok
+}
+
+// Sentinel creator errors, compare with errors.Is. Telegram errors
+// not listed here keep their own code, e.g. PHONE_NUMBER_BANNED.
+var (
+	ErrPasswordNeeded        = &Error{Code: "PASSWORD_NEEDED"}
+	ErrPhoneCodeInvalid      = &Error{Code: "PHONE_CODE_INVALID"}
+	ErrPhoneCodeExpired      = &Error{Code: "PHONE_CODE_EXPIRED"}
+	ErrPhoneNumberInvalid    = &Error{Code: "PHONE_NUMBER_INVALID"}
+	ErrPasswordHashInvalid   = &Error{Code: "PASSWORD_HASH_INVALID"}
+	ErrAPIIDInvalid          = &Error{Code: "API_ID_INVALID"}
+	ErrFloodWait             = &Error{Code: "FLOOD_WAIT"}
+	ErrClientNotInitialized  = &Error{Code: "CLIENT_NOT_INITIALIZED"}
+	ErrCodeNotSent           = &Error{Code: "CODE_NOT_SENT"}
+	ErrSendCodeUnavailable   = &Error{Code: "SEND_CODE_UNAVAILABLE"}
+	ErrPhoneNumberBanned     = &Error{Code: "PHONE_NUMBER_BANNED"}
+	ErrPhoneNumberUnoccupied = &Error{Code: "PHONE_NUMBER_UNOCCUPIED"}
+	ErrServerNotRunning      = &Error{Code: "SERVER_NOT_RUNNING"}
+	ErrUnexpected            = &Error{Code: "UNEXPECTED_ERROR"}
+	ErrBadResponse           = &Error{Code: "BAD_RESPONSE"}
+	ErrUnexpectedPingMessage = &Error{Code: "UNEXPECTED_PING_MESSAGE"}
+)
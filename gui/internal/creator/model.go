@@ -0,0 +1,87 @@
+package creator
+
+import "time"
+
+// Request and response bodies of the creator server (scripts/connect.py).
+
+type SessionPathRequest struct {
+	Path string `json:"path"`
+}
+
+type APIDataRequest struct {
+	APIID   string `json:"api_id"`
+	APIHash string `json:"api_hash"`
+}
+
+type SendCodeRequest struct {
+	Phone string `json:"phone"`
+}
+
+type ResendCodeRequest struct {
+	Phone string `json:"phone"`
+}
+
+type SignInRequest struct {
+	Phone string `json:"phone"`
+	Code  string `json:"code"`
+}
+
+type CheckPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// MessageResponse is returned by the calls without a result.
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+type APIDataResponse struct {
+	Message string `json:"message"`
+	Session string `json:"session"`
+}
+
+// SendCodeResponse is returned when the code is sent or resent.
+type SendCodeResponse struct {
+	Message string `json:"message"`
+
+	// Type is how the code was sent: APP, SMS, CALL, FLASH_CALL...
+	Type string `json:"type"`
+	// NextType is how the code is sent by resend, empty if it can't be.
+	NextType string `json:"next_type"`
+	// Timeout is the seconds before the code may be resent.
+	Timeout int `json:"timeout"`
+}
+
+const (
+	QRPending = "pending"
+	QRSuccess = "success"
+)
+
+// QRLoginResponse is the state of a QR login. While it is pending,
+// Token is shown as a QR code until Expires (unix seconds).
+type QRLoginResponse struct {
+	Status  string `json:"status"`
+	Token   string `json:"token"`
+	Expires int64  `json:"expires"`
+}
+
+// URL returns the tg://login link of the token, it is scanned
+// in Settings > Devices of a logged in telegram app.
+func (r *QRLoginResponse) URL() string {
+	return "tg://login?token=" + r.Token
+}
+
+func (r *QRLoginResponse) ExpiresAt() time.Time {
+	return time.Unix(r.Expires, 0)
+}
+
+// Me is the signed in user.
+type Me struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	Username  string `json:"username"`
+}
+
+type errorResponse struct {
+	Error *Error `json:"error"`
+}
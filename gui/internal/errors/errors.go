@@ -7,10 +7,21 @@ var (
 	ErrExtendedLoggerNotProvided = errors.New("no extended logger provided")
 	ErrCreatorPingError          = errors.New("ping to creator server failed")
 	ErrCreatorWaitTimeout        = errors.New("timeout waiting for creator server")
+	ErrCreatorExited             = errors.New("creator server exited")
+	ErrCreatorNotRunning         = errors.New("creator server is not running")
+	ErrCreatorCrashed            = errors.New("creator server crashed")
 	ErrPasswordNeeded            = errors.New("password needed")
 	ErrSystemError               = errors.New("system error")
 )
 
+var (
+	ErrVaultLocked        = errors.New("vault is locked")
+	ErrWrongPassphrase    = errors.New("wrong passphrase or corrupted vault")
+	ErrVaultFormat        = errors.New("unsupported vault format")
+	ErrPassphraseTooShort = errors.New("passphrase is too short")
+	ErrSessionConflict    = errors.New("vault has another session with the name")
+)
+
 var (
 	ErrOnlyDigitsAllowed       = errors.New("only digits are allowed")
 	ErrFieldRequired           = errors.New("field is required")
@@ -0,0 +1,69 @@
+package errors
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ScriptError is a structured error reported by a python script.
+//
+// Use errors.Is with sentinel values below to check the code,
+// and errors.As to get the details.
+type ScriptError struct {
+	Code    string
+	Details map[string]any
+
+	// Err is the underlying error, e.g. *exec.ExitError. May be nil.
+	Err error
+}
+
+func NewScriptError(code string, details map[string]any, err error) *ScriptError {
+	return &ScriptError{Code: code, Details: details, Err: err}
+}
+
+func (e *ScriptError) Error() string {
+	if len(e.Details) == 0 {
+		return "script error " + e.Code
+	}
+	parts := make([]string, 0, len(e.Details))
+	for _, k := range slices.Sorted(maps.Keys(e.Details)) {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, e.Details[k]))
+	}
+	return fmt.Sprintf("script error %s: %s", e.Code, strings.Join(parts, ", "))
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is a *ScriptError with the same code.
+func (e *ScriptError) Is(target error) bool {
+	t, ok := target.(*ScriptError)
+	return ok && t.Code == e.Code
+}
+
+// Sentinel script errors, compare with errors.Is.
+var (
+	ErrScriptUncaught         = &ScriptError{Code: "SCRIPT_UNCAUGHT_ERROR"}
+	ErrTaskCancelled          = &ScriptError{Code: "TASK_CANCELLED"}
+	ErrRPC                    = &ScriptError{Code: "RPC_ERROR"}
+	ErrUnexpected             = &ScriptError{Code: "UNEXPECTED_ERROR"}
+	ErrArgparse               = &ScriptError{Code: "ARGPARSE_ERROR"}
+	ErrNoSession              = &ScriptError{Code: "NO_SESSION"}
+	ErrMembersLimitTooHigh    = &ScriptError{Code: "MEMBERS_LIMIT_TOO_HIGH"}
+	ErrMessageLimitTooHigh    = &ScriptError{Code: "MESSAGE_LIMIT_TOO_HIGH"}
+	ErrInvalidChatName        = &ScriptError{Code: "INVALID_CHAT_NAME"}
+	ErrInviteLinkNotSupported = &ScriptError{Code: "INVITE_LINK_NOT_SUPPORTED"}
+	ErrInvalidUsername        = &ScriptError{Code: "INVALID_USERNAME"}
+	ErrFromDateRequired       = &ScriptError{Code: "FROM_DATE_REQUIRED"}
+	ErrToDateRequired         = &ScriptError{Code: "TO_DATE_REQUIRED"}
+	ErrFromDateInvalid        = &ScriptError{Code: "FROM_DATE_INVALID"}
+	ErrToDateInvalid          = &ScriptError{Code: "TO_DATE_INVALID"}
+	ErrFloodWaitTooLong       = &ScriptError{Code: "FLOOD_WAIT_TOO_LONG"}
+	ErrCheckpointInvalid      = &ScriptError{Code: "CHECKPOINT_INVALID"}
+	ErrSessionRevoked         = &ScriptError{Code: "SESSION_REVOKED"}
+	ErrConnectionFailed       = &ScriptError{Code: "CONNECTION_FAILED"}
+	ErrFreshResetForbidden    = &ScriptError{Code: "FRESH_RESET_FORBIDDEN"}
+)
@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/client"
+)
+
+type Status string
+
+const (
+	StatusQueued       Status = "queued"
+	StatusRunning      Status = "running"
+	StatusFloodWaiting Status = "flood-waiting"
+	StatusDone         Status = "done"
+	StatusFailed       Status = "failed"
+	StatusCancelled    Status = "cancelled"
+)
+
+// Finished reports whether the status is terminal.
+func (s Status) Finished() bool {
+	return s == StatusDone || s == StatusFailed || s == StatusCancelled
+}
+
+// maxJobEvents is the number of the latest events kept per job.
+const maxJobEvents = 500
+
+// Event is a message emitted by the script of a job.
+type Event struct {
+	Time  time.Time
+	Level string // INFO, WARN, LOG or ERROR
+	Msg   client.PyMsg
+}
+
+// Job is a single script run owned by [Manager].
+type Job struct {
+	ID      string
+	Account string
+	Request client.Request
+
+	mu        sync.RWMutex
+	status    Status
+	queuedAt  time.Time
+	startedAt time.Time
+	endedAt   time.Time
+	events    []Event
+	progress  client.Progress
+	err       error
+
+	opts   []client.RunOption
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Snapshot is a point-in-time copy of the job state.
+type Snapshot struct {
+	ID        string
+	Account   string
+	Kind      string
+	Output    string
+	Request   client.Request
+	Status    Status
+	QueuedAt  time.Time
+	StartedAt time.Time
+	EndedAt   time.Time
+	Events    []Event
+	Progress  client.Progress
+	Err       error
+}
+
+func (j *Job) Snapshot() Snapshot {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	return Snapshot{
+		ID:        j.ID,
+		Account:   j.Account,
+		Kind:      j.Request.Kind(),
+		Output:    j.Request.OutputPath(),
+		Request:   j.Request,
+		Status:    j.status,
+		QueuedAt:  j.queuedAt,
+		StartedAt: j.startedAt,
+		EndedAt:   j.endedAt,
+		Events:    append([]Event(nil), j.events...),
+		Progress:  j.progress,
+		Err:       j.err,
+	}
+}
+
+func (j *Job) Status() Status {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.status
+}
+
+// Err returns the error the job finished with, if any.
+func (j *Job) Err() error {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.err
+}
+
+// Done returns a channel that is closed when the job finishes.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+func (j *Job) setStatus(s Status) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status == s {
+		return false
+	}
+	j.status = s
+	if s == StatusRunning && j.startedAt.IsZero() {
+		j.startedAt = time.Now()
+	}
+	return true
+}
+
+func (j *Job) addEvent(level string, pm *client.PyMsg) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.events = append(j.events, Event{Time: time.Now(), Level: level, Msg: *pm})
+	if len(j.events) > maxJobEvents {
+		j.events = j.events[len(j.events)-maxJobEvents:]
+	}
+}
+
+func (j *Job) setProgress(p client.Progress) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress = p
+}
+
+func (j *Job) finish(s Status, err error) {
+	j.mu.Lock()
+	j.status = s
+	j.err = err
+	j.endedAt = time.Now()
+	j.mu.Unlock()
+	close(j.done)
+}
@@ -0,0 +1,382 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrJobNotFound    = errors.New("job not found")
+	ErrJobFinished    = errors.New("job already finished")
+	ErrJobNotFinished = errors.New("job is not finished")
+	ErrNilRequest     = errors.New("nil request")
+	ErrRunnerRequired = errors.New("runner required")
+)
+
+// Runner runs script requests. It is implemented by [client.Client].
+type Runner interface {
+	Run(ctx context.Context, req client.Request, opts ...client.RunOption) error
+
+	// Account returns the name of the account a run with opts uses.
+	Account(opts ...client.RunOption) string
+}
+
+// Manager owns every script run: it queues jobs, limits how many
+// run at once per account, also when the account pool moves a job to
+// another account, and keeps their history.
+type Manager struct {
+	runner Runner
+	limit  int
+	log    *zap.Logger
+
+	mu   sync.RWMutex
+	jobs []*Job
+	byID map[string]*Job
+	sems map[string]chan struct{}
+	subs map[int]func(*Job)
+	sub  int
+}
+
+// NewManager creates a manager running at most limit jobs
+// at once per account. limit < 1 means 1.
+func NewManager(runner Runner, limit int, log *zap.Logger) (*Manager, error) {
+	if runner == nil {
+		return nil, ErrRunnerRequired
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	if log == nil {
+		log = zap.NewNop()
+	}
+	return &Manager{
+		runner: runner,
+		limit:  limit,
+		log:    log,
+		byID:   make(map[string]*Job),
+		sems:   make(map[string]chan struct{}),
+		subs:   make(map[int]func(*Job)),
+	}, nil
+}
+
+// Submit queues req and returns its job. The job is cancelled
+// when ctx is done. opts are passed to every run of the job.
+// The account is chosen on submit, see [client.WithAccount].
+func (m *Manager) Submit(ctx context.Context, req client.Request, opts ...client.RunOption) (*Job, error) {
+	if req == nil {
+		return nil, ErrNilRequest
+	}
+
+	jctx, cancel := context.WithCancel(ctx)
+	j := &Job{
+		ID:       NewID(),
+		Account:  m.runner.Account(opts...),
+		Request:  req,
+		status:   StatusQueued,
+		queuedAt: time.Now(),
+		opts:     opts,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.jobs = append(m.jobs, j)
+	m.byID[j.ID] = j
+	m.mu.Unlock()
+
+	m.log.Info("job queued", zap.String("id", j.ID), zap.String("kind", req.Kind()))
+	m.notify(j)
+
+	go m.run(jctx, j)
+	return j, nil
+}
+
+// Restore adds finished jobs from journal entries, e.g. to rebuild
+// the history on startup. Entries with unknown request type are skipped.
+//
+// A job moved to other accounts has an entry per account, a later entry
+// updates the result of the job, the first request is kept.
+func (m *Manager) Restore(entries []client.JournalEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range entries {
+		req, err := e.DecodeRequest()
+		if err != nil {
+			m.log.Warn("skip journal entry", zap.String("id", e.JobID), zap.Error(err))
+			continue
+		}
+		id := e.JobID
+		if id == "" {
+			id = NewID()
+		}
+		if j, ok := m.byID[id]; ok {
+			j.Account = journalAccount(e)
+			j.status = journalStatus(e.Status)
+			j.endedAt = e.EndedAt
+			j.err = journalErr(e)
+			continue
+		}
+
+		j := &Job{
+			ID:        id,
+			Account:   journalAccount(e),
+			Request:   req,
+			status:    journalStatus(e.Status),
+			queuedAt:  e.StartedAt,
+			startedAt: e.StartedAt,
+			endedAt:   e.EndedAt,
+			err:       journalErr(e),
+			cancel:    func() {},
+			done:      make(chan struct{}),
+		}
+		close(j.done)
+
+		m.jobs = append(m.jobs, j)
+		m.byID[id] = j
+	}
+}
+
+// journalAccount returns the account of e. Entries written before
+// accounts have only the session name.
+func journalAccount(e client.JournalEntry) string {
+	if e.Account != "" {
+		return e.Account
+	}
+	return filepath.Base(e.Session)
+}
+
+// journalErr returns the error a journaled run finished with, a
+// [apperrors.ScriptError] if the script reported an error code.
+func journalErr(e client.JournalEntry) error {
+	switch {
+	case e.LastErrorCode != "":
+		var cause error
+		if e.Error != "" {
+			cause = errors.New(e.Error)
+		}
+		return apperrors.NewScriptError(e.LastErrorCode, nil, cause)
+	case e.Error != "":
+		return errors.New(e.Error)
+	}
+	return nil
+}
+
+func journalStatus(s string) Status {
+	switch s {
+	case client.RunStatusDone:
+		return StatusDone
+	case client.RunStatusCancelled:
+		return StatusCancelled
+	default:
+		return StatusFailed
+	}
+}
+
+// Rerun submits a new job with the same request as job id.
+func (m *Manager) Rerun(ctx context.Context, id string) (*Job, error) {
+	j, ok := m.Get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return m.Submit(ctx, j.Request, client.WithAccount(j.Account))
+}
+
+// Resume submits a new job that continues job id from the checkpoint
+// next to its output and appends to the output.
+func (m *Manager) Resume(ctx context.Context, id string) (*Job, error) {
+	j, ok := m.Get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if !j.Status().Finished() {
+		return nil, ErrJobNotFinished
+	}
+	req, err := client.ResumeRequest(j.Request)
+	if err != nil {
+		return nil, err
+	}
+	return m.Submit(ctx, req, client.WithAccount(j.Account))
+}
+
+// Cancel stops a queued or running job.
+func (m *Manager) Cancel(id string) error {
+	j, ok := m.Get(id)
+	if !ok {
+		return ErrJobNotFound
+	}
+	if j.Status().Finished() {
+		return ErrJobFinished
+	}
+	j.cancel()
+	return nil
+}
+
+// CancelAll stops every unfinished job.
+func (m *Manager) CancelAll() {
+	for _, j := range m.Jobs() {
+		if !j.Status().Finished() {
+			j.cancel()
+		}
+	}
+}
+
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.byID[id]
+	return j, ok
+}
+
+// Jobs returns all jobs, the newest first.
+func (m *Manager) Jobs() []*Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*Job, len(m.jobs))
+	for i, j := range m.jobs {
+		out[len(m.jobs)-1-i] = j
+	}
+	return out
+}
+
+// Subscribe registers f to be called whenever a job changes.
+// Returns a function that removes the subscription.
+func (m *Manager) Subscribe(f func(*Job)) (unsubscribe func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sub++
+	id := m.sub
+	m.subs[id] = f
+	return func() {
+		m.mu.Lock()
+		delete(m.subs, id)
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) notify(j *Job) {
+	m.mu.RLock()
+	subs := make([]func(*Job), 0, len(m.subs))
+	for _, f := range m.subs {
+		subs = append(subs, f)
+	}
+	m.mu.RUnlock()
+
+	for _, f := range subs {
+		f(j)
+	}
+}
+
+func (m *Manager) semaphore(account string) chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sem, ok := m.sems[account]
+	if !ok {
+		sem = make(chan struct{}, m.limit)
+		m.sems[account] = sem
+	}
+	return sem
+}
+
+func (m *Manager) run(ctx context.Context, j *Job) {
+	defer j.cancel()
+
+	// held is the slot of the account the job runs with
+	held := m.semaphore(j.Account)
+	select {
+	case held <- struct{}{}:
+		defer func() {
+			if held != nil {
+				<-held
+			}
+		}()
+	case <-ctx.Done():
+		m.finish(j, ctx.Err())
+		return
+	}
+
+	j.setStatus(StatusRunning)
+	m.log.Info("job started", zap.String("id", j.ID))
+	m.notify(j)
+
+	observer := func(level string, pm *client.PyMsg) {
+		if pm == nil {
+			return
+		}
+		if p, ok := client.ParseProgress(pm); ok {
+			j.setProgress(p)
+		} else {
+			j.addEvent(level, pm)
+		}
+		if pm.Code == "FLOOD_WAIT" {
+			j.setStatus(StatusFloodWaiting)
+		} else {
+			j.setStatus(StatusRunning)
+		}
+		m.notify(j)
+	}
+
+	// the account pool may move the job to another account, it waits for
+	// a slot there. The slot of the last account is released first, so
+	// jobs moving to each other's accounts don't wait forever
+	switchAccount := func(ctx context.Context, account string) error {
+		<-held
+		held = nil
+		j.setStatus(StatusQueued)
+		m.notify(j)
+
+		next := m.semaphore(account)
+		select {
+		case next <- struct{}{}:
+			held = next
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		m.log.Info("job moved to account", zap.String("id", j.ID), zap.String("account", account))
+		j.setStatus(StatusRunning)
+		m.notify(j)
+		return nil
+	}
+
+	opts := append([]client.RunOption{
+		client.WithJobID(j.ID), client.WithObserver(observer),
+		client.WithAccountSwitch(switchAccount),
+	}, j.opts...)
+	// pin the account chosen on submit, the current one may change
+	opts = append(opts, client.WithAccount(j.Account))
+	err := m.runner.Run(ctx, j.Request, opts...)
+	m.finish(j, err)
+}
+
+func (m *Manager) finish(j *Job, err error) {
+	status := StatusDone
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		status = StatusCancelled
+	default:
+		status = StatusFailed
+	}
+	j.finish(status, err)
+
+	m.log.Info("job finished", zap.String("id", j.ID),
+		zap.String("status", string(status)), zap.Error(err))
+	m.notify(j)
+}
+
+// NewID returns a new job ID: the time and a random suffix.
+func NewID() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return fmt.Sprintf("%s-%s", time.Now().Format("20060102-150405"), hex.EncodeToString(b[:]))
+}
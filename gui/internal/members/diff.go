@@ -0,0 +1,172 @@
+package members
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mauzec/tdsoft/gui/internal/output"
+)
+
+// ChangeType is how a member differs between two lists.
+type ChangeType string
+
+const (
+	Joined  ChangeType = "joined"
+	Left    ChangeType = "left"
+	Changed ChangeType = "changed"
+)
+
+// Field is a change of a field of a member.
+type Field struct {
+	Name     string
+	Old, New string
+}
+
+// Change is a member that joined, left or changed. Member is the new
+// data, the old one for Left.
+type Change struct {
+	Type   ChangeType
+	Member Member
+	// Fields are the changed fields of Changed.
+	Fields []Field
+}
+
+// Diff is the difference of two member lists, by user ID.
+type Diff struct {
+	Changes []Change
+	// Old and New are the numbers of members in the lists.
+	Old, New int
+}
+
+// Count returns the number of changes of type t.
+func (d Diff) Count(t ChangeType) int {
+	n := 0
+	for _, c := range d.Changes {
+		if c.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+// Compare returns the changes from the list from to the list to: joined,
+// left and changed members, each sorted by user ID. Premium and scam
+// flags are compared only if both lists have them.
+func Compare(from, to []Member) Diff {
+	before := make(map[int64]Member, len(from))
+	for _, m := range from {
+		before[m.UserID] = m
+	}
+	after := make(map[int64]Member, len(to))
+	for _, m := range to {
+		after[m.UserID] = m
+	}
+
+	var joined, left, changed []Change
+	for _, m := range after {
+		o, ok := before[m.UserID]
+		if !ok {
+			joined = append(joined, Change{Type: Joined, Member: m})
+			continue
+		}
+		if fields := compareFields(o, m); len(fields) > 0 {
+			changed = append(changed, Change{Type: Changed, Member: m, Fields: fields})
+		}
+	}
+	for _, m := range before {
+		if _, ok := after[m.UserID]; !ok {
+			left = append(left, Change{Type: Left, Member: m})
+		}
+	}
+
+	byID := func(a, b Change) int { return cmp.Compare(a.Member.UserID, b.Member.UserID) }
+	slices.SortFunc(joined, byID)
+	slices.SortFunc(left, byID)
+	slices.SortFunc(changed, byID)
+	return Diff{
+		Changes: slices.Concat(joined, left, changed),
+		Old:     len(before),
+		New:     len(after),
+	}
+}
+
+func compareFields(o, n Member) []Field {
+	var fields []Field
+	add := func(name, from, to string) {
+		if from != to {
+			fields = append(fields, Field{Name: name, Old: from, New: to})
+		}
+	}
+	add("username", o.Username, n.Username)
+	add("first_name", o.FirstName, n.FirstName)
+	add("last_name", o.LastName, n.LastName)
+	if o.Premium != nil && n.Premium != nil {
+		add("premium_status", flagText(o.Premium, "premium", "not premium"),
+			flagText(n.Premium, "premium", "not premium"))
+	}
+	if o.Scam != nil && n.Scam != nil {
+		add("is_scam", flagText(o.Scam, "scam", "not scam"), flagText(n.Scam, "scam", "not scam"))
+	}
+	return fields
+}
+
+// flagText returns the text of a flag as the scripts write it,
+// empty if it is unknown.
+func flagText(v *bool, yes, no string) string {
+	switch {
+	case v == nil:
+		return ""
+	case *v:
+		return yes
+	}
+	return no
+}
+
+// FieldsText returns the changed fields as "name: old -> new" separated by "; ".
+func (c Change) FieldsText() string {
+	parts := make([]string, len(c.Fields))
+	for i, f := range c.Fields {
+		parts[i] = fmt.Sprintf("%s: %s -> %s", f.Name, f.Old, f.New)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Columns are the columns of an exported diff.
+var Columns = []string{
+	"user_id", "change", "username", "first_name", "last_name",
+	"premium_status", "is_scam", "changes",
+}
+
+// Row returns the values of the change by [Columns].
+func (c Change) Row() []string {
+	m := c.Member
+	return []string{
+		strconv.FormatInt(m.UserID, 10), string(c.Type), m.Username, m.FirstName, m.LastName,
+		flagText(m.Premium, "premium", "not premium"), flagText(m.Scam, "scam", "not scam"),
+		c.FieldsText(),
+	}
+}
+
+// Export writes the changes to path in format, the table
+// or sheet is members_diff.
+func (d Diff) Export(format output.Format, path string) (err error) {
+	sink, err := output.Open(format, path, "members_diff", false)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, sink.Close()) }()
+
+	if err := sink.Columns(Columns); err != nil {
+		return err
+	}
+	for _, c := range d.Changes {
+		if err := sink.Write(c.Row()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
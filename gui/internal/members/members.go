@@ -0,0 +1,94 @@
+// Package members compares two member lists of a chat, e.g. outputs of
+// get_members jobs run a week apart, and reports who joined, who left
+// and whose data changed.
+package members
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	"github.com/mauzec/tdsoft/gui/internal/output"
+)
+
+// Member is a member of a chat as written by scripts/get_members.py.
+type Member struct {
+	UserID    int64
+	Username  string
+	FirstName string
+	LastName  string
+	// Premium and Scam are known if the output has additional info,
+	// see [client.GetMembersRequest.AddAdditionalInfo].
+	Premium *bool
+	Scam    *bool
+}
+
+// Read reads the members of the output at path of format. Users parsed
+// from messages who are not members of the chat are skipped.
+func Read(format output.Format, path string) ([]Member, error) {
+	r, err := output.OpenReader(format, path, client.KindGetMembers)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	cols := make(map[string]int)
+	for i, c := range r.Columns() {
+		cols[c] = i
+	}
+	if _, ok := cols["user_id"]; !ok {
+		return nil, fmt.Errorf("%s is not a members output: no user_id column", path)
+	}
+	get := func(row []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+	flag := func(row []string, name, yes, no string) *bool {
+		var v bool
+		switch get(row, name) {
+		case yes:
+			v = true
+		case no:
+		default:
+			return nil
+		}
+		return &v
+	}
+
+	var out []Member
+	for {
+		row, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if get(row, "is_member") == "not member" {
+			continue
+		}
+		id, err := strconv.ParseInt(get(row, "user_id"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad user_id %q in %s", get(row, "user_id"), path)
+		}
+		out = append(out, Member{
+			UserID:    id,
+			Username:  get(row, "username"),
+			FirstName: get(row, "first_name"),
+			LastName:  get(row, "last_name"),
+			Premium:   flag(row, "premium_status", "premium", "not premium"),
+			Scam:      flag(row, "is_scam", "scam", "not scam"),
+		})
+	}
+}
+
+// ReadFile reads the members of the output at path, the format is
+// taken from the extension, see [output.FormatOf].
+func ReadFile(path string) ([]Member, error) {
+	return Read(output.FormatOf(path), path)
+}
@@ -0,0 +1,88 @@
+package output
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+)
+
+type csvSink struct {
+	f      *os.File
+	w      *csv.Writer
+	header bool
+	n      int
+}
+
+// openCSV opens path for writing, or for appending if it has a header already.
+func openCSV(path string, appendTo bool) (*csvSink, error) {
+	if appendTo {
+		if st, err := os.Stat(path); err == nil && st.Size() > 0 {
+			f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, err
+			}
+			return &csvSink{f: f, w: csv.NewWriter(f), header: true}, nil
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &csvSink{f: f, w: csv.NewWriter(f)}, nil
+}
+
+func (s *csvSink) Columns(cols []string) error {
+	s.n = len(cols)
+	if s.header {
+		return nil
+	}
+	s.header = true
+	return s.w.Write(cols)
+}
+
+func (s *csvSink) Write(row []string) error {
+	return s.w.Write(fit(row, s.n))
+}
+
+func (s *csvSink) Flush() error {
+	s.w.Flush()
+	if err := s.w.Error(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *csvSink) Close() error {
+	return errors.Join(s.Flush(), s.f.Close())
+}
+
+func (s *csvSink) keys() ([]string, error) {
+	f, err := os.Open(s.f.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	if _, err := r.Read(); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var keys []string
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return keys, nil
+		}
+		if err != nil {
+			return keys, err
+		}
+		if len(rec) > 0 && rec[0] != "" {
+			keys = append(keys, rec[0])
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// ndjsonSink writes a row per line as a JSON object with the columns
+// as keys, in the order of the columns.
+type ndjsonSink struct {
+	f     *os.File
+	w     *bufio.Writer
+	names []string
+}
+
+func openNDJSON(path string, appendTo bool) (*ndjsonSink, error) {
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if appendTo {
+		flags = os.O_RDWR | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &ndjsonSink{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (s *ndjsonSink) Columns(cols []string) error {
+	s.names = fieldNames(cols)
+	return nil
+}
+
+func (s *ndjsonSink) Write(row []string) error {
+	row = fit(row, len(s.names))
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, name := range s.names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(row[i])
+		if err != nil {
+			return err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteString("}\n")
+	_, err := s.w.Write(b.Bytes())
+	return err
+}
+
+func (s *ndjsonSink) Flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *ndjsonSink) Close() error {
+	return errors.Join(s.Flush(), s.f.Close())
+}
+
+func (s *ndjsonSink) keys() ([]string, error) {
+	if len(s.names) == 0 {
+		return nil, nil
+	}
+	f, err := os.Open(s.f.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for sc.Scan() {
+		var obj map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &obj); err != nil {
+			continue
+		}
+		if k, _ := obj[s.names[0]].(string); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys, sc.Err()
+}
@@ -0,0 +1,278 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Reader reads the rows of an output written by a [Sink].
+type Reader interface {
+	// Columns returns the header of the output. NDJSON, SQLite and XLSX
+	// outputs have the names of the columns as the sink wrote them.
+	Columns() []string
+	// Next returns the next row, or io.EOF after the last one.
+	Next() ([]string, error)
+	Close() error
+}
+
+// OpenReader opens the output at path of format. table is the table the
+// rows were written to, see [Open].
+func OpenReader(format Format, path, table string) (Reader, error) {
+	switch format {
+	case FormatCSV, "":
+		return openCSVReader(path)
+	case FormatNDJSON:
+		return openNDJSONReader(path)
+	case FormatSQLite:
+		return openSQLiteReader(path, table)
+	case FormatXLSX:
+		return openXLSXReader(path, table)
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+type csvReader struct {
+	f    *os.File
+	r    *csv.Reader
+	cols []string
+}
+
+func openCSVReader(path string) (*csvReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	cols, err := r.Read()
+	if err != nil && !errors.Is(err, io.EOF) {
+		f.Close()
+		return nil, err
+	}
+	return &csvReader{f: f, r: r, cols: cols}, nil
+}
+
+func (r *csvReader) Columns() []string { return r.cols }
+
+func (r *csvReader) Next() ([]string, error) {
+	if r.cols == nil {
+		return nil, io.EOF
+	}
+	return r.r.Read()
+}
+
+func (r *csvReader) Close() error { return r.f.Close() }
+
+// ndjsonReader takes the columns from the keys of the first object,
+// in their order in the line.
+type ndjsonReader struct {
+	f    *os.File
+	sc   *bufio.Scanner
+	cols []string
+	// first is the first row, read to get the columns
+	first []string
+}
+
+func openNDJSONReader(path string) (*ndjsonReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	r := &ndjsonReader{f: f, sc: sc}
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		r.cols, r.first, err = orderedObject(sc.Bytes())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return r, nil
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *ndjsonReader) Columns() []string { return r.cols }
+
+func (r *ndjsonReader) Next() ([]string, error) {
+	if r.first != nil {
+		row := r.first
+		r.first = nil
+		return row, nil
+	}
+	for r.sc.Scan() {
+		if len(bytes.TrimSpace(r.sc.Bytes())) == 0 {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal(r.sc.Bytes(), &obj); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(r.cols))
+		for i, c := range r.cols {
+			row[i] = jsonString(obj[c])
+		}
+		return row, nil
+	}
+	if err := r.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *ndjsonReader) Close() error { return r.f.Close() }
+
+// orderedObject returns the keys and values of a JSON object in order.
+func orderedObject(line []byte) (keys, values []string, err error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, nil, fmt.Errorf("not a JSON object: %.40s", line)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, _ := t.(string)
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, jsonString(v))
+	}
+	return keys, values, nil
+}
+
+func jsonString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+type sqliteReader struct {
+	db   *sql.DB
+	rows *sql.Rows
+	cols []string
+}
+
+func openSQLiteReader(path, table string) (*sqliteReader, error) {
+	if table == "" {
+		table = "rows"
+	}
+	// the sink creates the file, do not create an empty database
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT * FROM " + quoteIdent(table) + " ORDER BY rowid")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		db.Close()
+		return nil, err
+	}
+	return &sqliteReader{db: db, rows: rows, cols: cols}, nil
+}
+
+func (r *sqliteReader) Columns() []string { return r.cols }
+
+func (r *sqliteReader) Next() ([]string, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	values := make([]sql.NullString, len(r.cols))
+	dest := make([]any, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	row := make([]string, len(values))
+	for i, v := range values {
+		row[i] = v.String
+	}
+	return row, nil
+}
+
+func (r *sqliteReader) Close() error {
+	return errors.Join(r.rows.Close(), r.db.Close())
+}
+
+// xlsxReader reads a sheet, the workbook is loaded into memory.
+type xlsxReader struct {
+	rows [][]string
+	cols []string
+}
+
+func openXLSXReader(path, table string) (*xlsxReader, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sheet := table
+	if len(sheet) > maxSheetName {
+		sheet = sheet[:maxSheetName]
+	}
+	if idx, err := f.GetSheetIndex(sheet); err != nil || idx < 0 {
+		sheet = f.GetSheetName(f.GetActiveSheetIndex())
+	}
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	r := &xlsxReader{}
+	if len(rows) > 0 {
+		r.cols, r.rows = rows[0], rows[1:]
+	}
+	return r, nil
+}
+
+func (r *xlsxReader) Columns() []string { return r.cols }
+
+func (r *xlsxReader) Next() ([]string, error) {
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+	// trailing empty cells are not returned by excelize
+	row := fit(r.rows[0], max(len(r.cols), len(r.rows[0])))
+	r.rows = r.rows[1:]
+	return row, nil
+}
+
+func (r *xlsxReader) Close() error { return nil }
@@ -0,0 +1,176 @@
+// Package output writes the rows of job results in one of the
+// supported formats: CSV, JSON Lines, a SQLite table or an XLSX workbook.
+package output
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Format is the format of a job output.
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+	FormatSQLite Format = "sqlite"
+	FormatXLSX   Format = "xlsx"
+)
+
+// Formats are all supported formats, CSV first.
+var Formats = []Format{FormatCSV, FormatNDJSON, FormatSQLite, FormatXLSX}
+
+// ParseFormat returns the format named s, an empty s is CSV.
+func ParseFormat(s string) (Format, error) {
+	if s == "" {
+		return FormatCSV, nil
+	}
+	for _, f := range Formats {
+		if string(f) == strings.ToLower(s) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q", s)
+}
+
+// Ext returns the file extension of the format, e.g. ".csv".
+func (f Format) Ext() string {
+	switch f {
+	case FormatNDJSON:
+		return ".ndjson"
+	case FormatSQLite:
+		return ".sqlite"
+	case FormatXLSX:
+		return ".xlsx"
+	}
+	return ".csv"
+}
+
+// FormatOf returns the format of the file at path by its extension,
+// CSV if the extension is unknown.
+func FormatOf(path string) Format {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".jsonl":
+		return FormatNDJSON
+	case ".db", ".sqlite3":
+		return FormatSQLite
+	}
+	for _, f := range Formats {
+		if f.Ext() == ext {
+			return f
+		}
+	}
+	return FormatCSV
+}
+
+// Sink receives the rows of a job output. Values are strings,
+// as the scripts write them to CSV.
+type Sink interface {
+	// Columns is called once, before the rows.
+	Columns(cols []string) error
+	Write(row []string) error
+	// Flush makes the rows written so far durable,
+	// it is called before a checkpoint is saved.
+	Flush() error
+	Close() error
+}
+
+// keyReader is a sink, that can read the first column of the rows
+// already in an output it appends to. It is called after Columns.
+type keyReader interface {
+	keys() ([]string, error)
+}
+
+// Open opens a sink of format writing to path. The rows go to table,
+// if the format has tables (SQLite, XLSX sheets). With appendTo the
+// rows are added to an existing output, otherwise it is overwritten.
+//
+// With appendTo a row which non-empty first value is already in the
+// output, e.g. written before a job was resumed, is skipped.
+func Open(format Format, path, table string, appendTo bool) (Sink, error) {
+	var (
+		s   Sink
+		err error
+	)
+	switch format {
+	case FormatCSV, "":
+		s, err = openCSV(path, appendTo)
+	case FormatNDJSON:
+		s, err = openNDJSON(path, appendTo)
+	case FormatSQLite:
+		s, err = openSQLite(path, table, appendTo)
+	case FormatXLSX:
+		s, err = openXLSX(path, table, appendTo)
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !appendTo {
+		return s, nil
+	}
+	return &uniqueSink{Sink: s, seen: map[string]struct{}{}}, nil
+}
+
+// uniqueSink skips rows which first value is in a row the output had
+// before it was opened to append, e.g. rows written again by a resumed job.
+type uniqueSink struct {
+	Sink
+	seen map[string]struct{}
+}
+
+func (s *uniqueSink) Columns(cols []string) error {
+	if err := s.Sink.Columns(cols); err != nil {
+		return err
+	}
+	kr, ok := s.Sink.(keyReader)
+	if !ok {
+		return nil
+	}
+	keys, err := kr.keys()
+	if err != nil {
+		return fmt.Errorf("read written rows: %w", err)
+	}
+	for _, k := range keys {
+		s.seen[k] = struct{}{}
+	}
+	return nil
+}
+
+func (s *uniqueSink) Write(row []string) error {
+	if len(row) > 0 && row[0] != "" {
+		if _, ok := s.seen[row[0]]; ok {
+			return nil
+		}
+	}
+	return s.Sink.Write(row)
+}
+
+// fieldNames returns names for cols usable as keys and SQL columns:
+// empty and repeated names are replaced by column_<n>.
+func fieldNames(cols []string) []string {
+	names := make([]string, len(cols))
+	used := map[string]bool{}
+	for i, c := range cols {
+		if c == "" || used[c] {
+			c = "column_" + strconv.Itoa(i+1)
+		}
+		used[c] = true
+		names[i] = c
+	}
+	return names
+}
+
+// fit pads or cuts row to n values.
+func fit(row []string, n int) []string {
+	if len(row) == n {
+		return row
+	}
+	out := make([]string, n)
+	copy(out, row)
+	return out
+}
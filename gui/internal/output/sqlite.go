@@ -0,0 +1,142 @@
+package output
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSink writes rows to a table of TEXT columns. Rows are written in
+// a transaction, that is committed by Flush.
+type sqliteSink struct {
+	db       *sql.DB
+	tx       *sql.Tx
+	insert   *sql.Stmt // of tx
+	query    string
+	table    string
+	names    []string
+	appendTo bool
+}
+
+func openSQLite(path, table string, appendTo bool) (*sqliteSink, error) {
+	if table == "" {
+		table = "rows"
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// a single connection, the transaction and statements share it
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteSink{db: db, table: table, appendTo: appendTo}, nil
+}
+
+// quoteIdent quotes a table or column name for SQL.
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func (s *sqliteSink) Columns(cols []string) error {
+	s.names = fieldNames(cols)
+	defs := make([]string, len(s.names))
+	marks := make([]string, len(s.names))
+	for i, n := range s.names {
+		defs[i] = quoteIdent(n) + " TEXT"
+		marks[i] = "?"
+	}
+	if !s.appendTo {
+		if _, err := s.db.Exec("DROP TABLE IF EXISTS " + quoteIdent(s.table)); err != nil {
+			return err
+		}
+	}
+	_, err := s.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)",
+		quoteIdent(s.table), strings.Join(defs, ", ")))
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(s.names))
+	for i, n := range s.names {
+		quoted[i] = quoteIdent(n)
+	}
+	s.query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(s.table),
+		strings.Join(quoted, ", "), strings.Join(marks, ", "))
+	return s.begin()
+}
+
+func (s *sqliteSink) begin() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	insert, err := tx.Prepare(s.query)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	s.tx, s.insert = tx, insert
+	return nil
+}
+
+func (s *sqliteSink) Write(row []string) error {
+	if s.tx == nil {
+		return errors.New("sqlite output: no columns")
+	}
+	row = fit(row, len(s.names))
+	args := make([]any, len(row))
+	for i, v := range row {
+		args[i] = v
+	}
+	_, err := s.insert.Exec(args...)
+	return err
+}
+
+func (s *sqliteSink) Flush() error {
+	if s.tx == nil {
+		return nil
+	}
+	err := s.tx.Commit()
+	s.tx = nil
+	if err != nil {
+		return err
+	}
+	return s.begin()
+}
+
+func (s *sqliteSink) Close() error {
+	var err error
+	if s.tx != nil {
+		// the statement of the transaction is closed by Commit
+		err = s.tx.Commit()
+	}
+	return errors.Join(err, s.db.Close())
+}
+
+func (s *sqliteSink) keys() ([]string, error) {
+	if len(s.names) == 0 {
+		return nil, nil
+	}
+	// the transaction holds the only connection
+	rows, err := s.tx.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s <> ''",
+		quoteIdent(s.names[0]), quoteIdent(s.table), quoteIdent(s.names[0])))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return keys, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
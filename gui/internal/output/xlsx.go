@@ -0,0 +1,117 @@
+package output
+
+import (
+	"errors"
+	"os"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxSheetName is the maximum length of a sheet name in excel.
+const maxSheetName = 31
+
+// xlsxSink writes rows to a sheet of a workbook. The workbook is kept in
+// memory and saved by Flush, so every flush rewrites the whole file.
+type xlsxSink struct {
+	f     *excelize.File
+	path  string
+	sheet string
+	// next is the number of the next row, from 1
+	next     int
+	appendTo bool
+	written  bool
+}
+
+func openXLSX(path, table string, appendTo bool) (*xlsxSink, error) {
+	sheet := table
+	if sheet == "" {
+		sheet = "Sheet1"
+	}
+	if len(sheet) > maxSheetName {
+		sheet = sheet[:maxSheetName]
+	}
+
+	s := &xlsxSink{path: path, sheet: sheet, next: 1, appendTo: appendTo}
+	if appendTo {
+		if _, err := os.Stat(path); err == nil {
+			f, err := excelize.OpenFile(path)
+			if err != nil {
+				return nil, err
+			}
+			s.f = f
+			return s, nil
+		}
+	}
+	s.f = excelize.NewFile()
+	return s, nil
+}
+
+func (s *xlsxSink) Columns(cols []string) error {
+	idx, err := s.f.GetSheetIndex(s.sheet)
+	if err != nil {
+		return err
+	}
+	if idx >= 0 && s.appendTo {
+		rows, err := s.f.GetRows(s.sheet)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			s.next = len(rows) + 1
+			return nil
+		}
+	}
+	if idx < 0 {
+		if idx, err = s.f.NewSheet(s.sheet); err != nil {
+			return err
+		}
+		s.f.SetActiveSheet(idx)
+		// a new workbook has the default sheet
+		if s.sheet != "Sheet1" && !s.appendTo {
+			if err := s.f.DeleteSheet("Sheet1"); err != nil {
+				return err
+			}
+		}
+	}
+	return s.Write(cols)
+}
+
+func (s *xlsxSink) Write(row []string) error {
+	cell, err := excelize.CoordinatesToCellName(1, s.next)
+	if err != nil {
+		return err
+	}
+	if err := s.f.SetSheetRow(s.sheet, cell, &row); err != nil {
+		return err
+	}
+	s.next++
+	s.written = true
+	return nil
+}
+
+func (s *xlsxSink) Flush() error {
+	if !s.written {
+		return nil
+	}
+	s.written = false
+	return s.f.SaveAs(s.path)
+}
+
+func (s *xlsxSink) Close() error {
+	return errors.Join(s.Flush(), s.f.Close())
+}
+
+func (s *xlsxSink) keys() ([]string, error) {
+	rows, err := s.f.GetRows(s.sheet)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	// the first row is the header
+	for _, r := range rows[min(1, len(rows)):] {
+		if len(r) > 0 && r[0] != "" {
+			keys = append(keys, r[0])
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,125 @@
+package preferences
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// FileStore is a SettingsStore that keeps values in a flat JSON or TOML
+// file, chosen by the extension (.toml, everything else is JSON).
+// The JSON layout is the same as fyne's preferences.json, so the file
+// can be copied from the GUI app storage.
+//
+// Every Set writes the whole file. Write errors are returned by [FileStore.Err].
+type FileStore struct {
+	path string
+
+	mu     sync.RWMutex
+	values map[string]any
+	err    error
+}
+
+// NewFileStore loads the store from path. Missing file is an empty store,
+// it is created on the first Set.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, values: map[string]any{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return s, nil
+	}
+	if s.isTOML() {
+		err = toml.Unmarshal(data, &s.values)
+	} else {
+		err = json.Unmarshal(data, &s.values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse settings file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *FileStore) Path() string { return s.path }
+
+// Err returns the last error of saving the file.
+func (s *FileStore) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+func (s *FileStore) String(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, _ := s.values[key].(string)
+	return v
+}
+
+func (s *FileStore) SetString(key string, value string) {
+	s.set(key, value)
+}
+
+func (s *FileStore) Bool(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, _ := s.values[key].(bool)
+	return v
+}
+
+func (s *FileStore) SetBool(key string, value bool) {
+	s.set(key, value)
+}
+
+func (s *FileStore) RemoveValue(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	s.err = s.save()
+}
+
+func (s *FileStore) set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.err = s.save()
+}
+
+func (s *FileStore) isTOML() bool {
+	return strings.EqualFold(filepath.Ext(s.path), ".toml")
+}
+
+// save must be called with mu held.
+func (s *FileStore) save() error {
+	var (
+		data []byte
+		err  error
+	)
+	if s.isTOML() {
+		data, err = toml.Marshal(s.values)
+	} else {
+		data, err = json.MarshalIndent(s.values, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	// values may hold credentials
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
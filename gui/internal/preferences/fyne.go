@@ -0,0 +1,18 @@
+package preferences
+
+import "fyne.io/fyne/v2"
+
+// FyneStore is a SettingsStore backed by fyne app preferences.
+type FyneStore struct {
+	prefs fyne.Preferences
+}
+
+func NewFyneStore(prefs fyne.Preferences) *FyneStore {
+	return &FyneStore{prefs: prefs}
+}
+
+func (s *FyneStore) String(key string) string           { return s.prefs.String(key) }
+func (s *FyneStore) SetString(key string, value string) { s.prefs.SetString(key, value) }
+func (s *FyneStore) Bool(key string) bool               { return s.prefs.Bool(key) }
+func (s *FyneStore) SetBool(key string, value bool)     { s.prefs.SetBool(key, value) }
+func (s *FyneStore) RemoveValue(key string)             { s.prefs.RemoveValue(key) }
@@ -5,9 +5,13 @@ const (
 	KeyTGAPIHash = "tg.api_hash" // string
 	KeyTGPhone   = "tg.phone"    // string
 
+	KeyTGAccounts       = "tg.accounts"        // string, JSON list, see accounts.Registry
+	KeyTGCurrentAccount = "tg.current_account" // string
+
 	KeyUIMembersMenuChat      = "ui.members_m.chat"       // string
 	KeyUIMembersMenuLimit     = "ui.members_m.limit"      // string
 	KeyUIMembersMenuOutput    = "ui.members_m.output"     // string
+	KeyUIMembersMenuFormat    = "ui.members_m.format"     // string
 	KeyUIMembersMenuParseMsgs = "ui.members_m.parse_msgs" // bool
 	KeyUIMembersMenuMsgLimit  = "ui.members_m.msg_limit"  // string
 	KeyUIMembersMenuParseBio  = "ui.members_m.parse_bio"  // bool
@@ -16,12 +20,14 @@ const (
 	KeyUIMsgSearcherMenuChat     = "ui.msg_searcher_m.chat"      // string
 	KeyUIMsgSearcherMenuUsername = "ui.msg_searcher_m.username"  // string
 	KeyUIMsgSearcherMenuOutput   = "ui.msg_searcher_m.output"    // string
+	KeyUIMsgSearcherMenuFormat   = "ui.msg_searcher_m.format"    // string
 	KeyUIMsgSearcherMenuFromDate = "ui.msg_searcher_m.from_date" // string
 	KeyUIMsgSearcherMenuToDate   = "ui.msg_searcher_m.to_date"   // string
 
 	KeyUIChatStatsMenuChat   = "ui.chat_stats_m.chat"   // string
 	KeyUIChatStatsMenuLimit  = "ui.chat_stats_m.limit"  // string
 	KeyUIChatStatsMenuOutput = "ui.chat_stats_m.output" // string
+	KeyUIChatStatsMenuFormat = "ui.chat_stats_m.format" // string
 )
 
 const (
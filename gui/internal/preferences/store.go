@@ -0,0 +1,58 @@
+package preferences
+
+import "sync"
+
+// SettingsStore keeps credentials and other settings by key (see Key* constants).
+// Missing keys return zero values.
+//
+// fyne.Preferences satisfies it, see [NewFyneStore].
+type SettingsStore interface {
+	String(key string) string
+	SetString(key string, value string)
+	Bool(key string) bool
+	SetBool(key string, value bool)
+	RemoveValue(key string)
+}
+
+// MemoryStore is a SettingsStore that keeps values in memory only.
+// Used for tests and runs that must not persist anything.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	values map[string]any
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: map[string]any{}}
+}
+
+func (s *MemoryStore) String(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, _ := s.values[key].(string)
+	return v
+}
+
+func (s *MemoryStore) SetString(key string, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+func (s *MemoryStore) Bool(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, _ := s.values[key].(bool)
+	return v
+}
+
+func (s *MemoryStore) SetBool(key string, value bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+func (s *MemoryStore) RemoveValue(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+}
@@ -0,0 +1,237 @@
+// Package results reads the CSV outputs of jobs page by page,
+// without loading the whole file into memory.
+package results
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// File is an opened job output. Only the offsets of the rows are kept
+// in memory, rows are read from the file when needed.
+//
+// It is safe for concurrent use.
+type File struct {
+	Path    string
+	Kind    string
+	Header  []string
+	Columns []Column
+
+	mu      sync.Mutex
+	f       *os.File
+	offsets []int64
+}
+
+// Open opens the output at path and indexes its rows. An empty kind is
+// detected by the header, see [DetectKind].
+func Open(path, kind string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rf := &File{Path: path, Kind: kind, f: f}
+	if err := rf.index(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if rf.Kind == "" {
+		rf.Kind = DetectKind(rf.Header)
+	}
+	rf.Columns = Columns(rf.Kind, rf.Header)
+	return rf, nil
+}
+
+func newReader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	return cr
+}
+
+// index reads the header and the offset of every row.
+func (rf *File) index() error {
+	cr := newReader(rf.f)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read header of %s: %w", rf.Path, err)
+	}
+	rf.Header = header
+	for {
+		off := cr.InputOffset()
+		_, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", rf.Path, err)
+		}
+		rf.offsets = append(rf.offsets, off)
+	}
+}
+
+// Close closes the file.
+func (rf *File) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.f.Close()
+}
+
+// Len returns the number of rows without the header.
+func (rf *File) Len() int {
+	return len(rf.offsets)
+}
+
+// Rows reads the rows with the indexes, in the same order.
+// A row has as many fields as the header.
+func (rf *File) Rows(indexes []int) ([][]string, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	rows := make([][]string, 0, len(indexes))
+	for _, i := range indexes {
+		if i < 0 || i >= len(rf.offsets) {
+			return rows, fmt.Errorf("row %d out of range", i)
+		}
+		if _, err := rf.f.Seek(rf.offsets[i], io.SeekStart); err != nil {
+			return rows, err
+		}
+		rec, err := newReader(rf.f).Read()
+		if err != nil {
+			return rows, fmt.Errorf("read row %d of %s: %w", i, rf.Path, err)
+		}
+		rows = append(rows, rf.fit(rec))
+	}
+	return rows, nil
+}
+
+// fit pads or cuts rec to the header.
+func (rf *File) fit(rec []string) []string {
+	if len(rec) == len(rf.Header) {
+		return rec
+	}
+	row := make([]string, len(rf.Header))
+	copy(row, rec)
+	return row
+}
+
+// each calls f for every row in the file order.
+func (rf *File) each(f func(i int, row []string)) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if len(rf.offsets) == 0 {
+		return nil
+	}
+	if _, err := rf.f.Seek(rf.offsets[0], io.SeekStart); err != nil {
+		return err
+	}
+	cr := newReader(rf.f)
+	cr.ReuseRecord = true
+	for i := range rf.offsets {
+		rec, err := cr.Read()
+		if err != nil {
+			return fmt.Errorf("read row %d of %s: %w", i, rf.Path, err)
+		}
+		f(i, rf.fit(rec))
+	}
+	return nil
+}
+
+// Query selects and orders rows of a [File].
+type Query struct {
+	// Filters are the texts, that the values of the columns with the
+	// keys must contain, case-insensitively.
+	Filters map[int]string
+	// SortColumn is the column to sort by, -1 keeps the file order.
+	SortColumn int
+	Desc       bool
+}
+
+// Select returns the indexes of the rows matching q in its order.
+// Only the values of the sort column are kept in memory.
+func (rf *File) Select(q Query) ([]int, error) {
+	filters := make(map[int]string, len(q.Filters))
+	for col, text := range q.Filters {
+		if text = strings.ToLower(strings.TrimSpace(text)); text != "" {
+			filters[col] = text
+		}
+	}
+	sorted := q.SortColumn >= 0 && q.SortColumn < len(rf.Columns)
+
+	var (
+		indexes []int
+		keys    []string
+	)
+	err := rf.each(func(i int, row []string) {
+		for col, text := range filters {
+			if col >= len(row) || !strings.Contains(strings.ToLower(row[col]), text) {
+				return
+			}
+		}
+		indexes = append(indexes, i)
+		if sorted {
+			keys = append(keys, row[q.SortColumn])
+		}
+	})
+	if err != nil || !sorted {
+		return indexes, err
+	}
+
+	order := make([]int, len(indexes))
+	for i := range order {
+		order[i] = i
+	}
+	col := rf.Columns[q.SortColumn]
+	slices.SortStableFunc(order, func(a, b int) int {
+		c := col.Compare(keys[a], keys[b])
+		if q.Desc {
+			return -c
+		}
+		return c
+	})
+	for i, o := range order {
+		order[i] = indexes[o]
+	}
+	return order, nil
+}
+
+// Export writes the header and the rows with the indexes to a CSV file at path.
+func (rf *File) Export(path string, indexes []int) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(out)
+	if err := w.Write(rf.Header); err != nil {
+		out.Close()
+		return err
+	}
+	// rows are read by pages to keep the memory flat
+	const page = 1000
+	for from := 0; from < len(indexes); from += page {
+		rows, err := rf.Rows(indexes[from:min(from+page, len(indexes))])
+		if err != nil {
+			out.Close()
+			return err
+		}
+		if err := w.WriteAll(rows); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
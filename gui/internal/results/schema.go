@@ -0,0 +1,156 @@
+package results
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/client"
+)
+
+// ColumnType says how the values of a column are compared.
+type ColumnType int
+
+const (
+	ColumnText ColumnType = iota
+	ColumnNumber
+	ColumnTime
+)
+
+// Column is a column of a job output.
+type Column struct {
+	// Name is the name in the CSV header, it may be empty.
+	Name  string
+	Title string
+	Type  ColumnType
+	// Layout is the time layout of a ColumnTime column.
+	Layout string
+}
+
+// schemas are the known columns of the outputs of every job kind,
+// as written by the COLUMNS of the scripts. The members output has
+// optional columns, so a header is matched by the names.
+var schemas = map[string][]Column{
+	client.KindGetMembers: {
+		{Name: "user_id", Title: "User ID", Type: ColumnNumber},
+		{Name: "username", Title: "Username"},
+		{Name: "first_name", Title: "First name"},
+		{Name: "last_name", Title: "Last name"},
+		{Name: "is_member", Title: "Member"},
+		{Name: "is_bot", Title: "Bot"},
+		{Name: "bio", Title: "Bio"},
+		{Name: "premium_status", Title: "Premium"},
+		{Name: "is_deleted", Title: "Deleted"},
+		{Name: "is_scam", Title: "Scam"},
+		{Name: "is_verified", Title: "Verified"},
+		{Name: "phone_number", Title: "Phone"},
+	},
+	client.KindGetChatStats: {
+		{Name: "title", Title: "Title"},
+		{Name: "username", Title: "Username"},
+		{Name: "public_members_count", Title: "Members", Type: ColumnNumber},
+		{Name: "bio", Title: "Bio"},
+		{Name: "is_verified", Title: "Verified"},
+		{Name: "is_fake", Title: "Fake"},
+		{Name: "is_scam", Title: "Scam"},
+		{Name: "can_forward", Title: "Can forward"},
+		{Name: "invite_link", Title: "Invite link"},
+		{Name: "total_messages", Title: "Messages", Type: ColumnNumber},
+		{Name: "day_median", Title: "Day median", Type: ColumnNumber},
+		{Name: "week_median", Title: "Week median", Type: ColumnNumber},
+		{Name: "weekday_median", Title: "Weekday median", Type: ColumnNumber},
+		// the top 5 senders are written in the last two columns of the next rows
+		{Name: "top5", Title: "Top sender"},
+		{Name: "msg_senders", Title: "Sent", Type: ColumnNumber},
+	},
+	client.KindSearchMessages: {
+		{Name: "message_id", Title: "Message ID", Type: ColumnNumber},
+		{Name: "text", Title: "Text"},
+		{Name: "date", Title: "Date", Type: ColumnTime, Layout: client.SearchMessagesDateLayout},
+	},
+	client.KindPrintDialogs: {
+		{Name: "chat_id", Title: "Chat ID", Type: ColumnNumber},
+		{Name: "type", Title: "Type"},
+		{Name: "title", Title: "Title"},
+		{Name: "username", Title: "Username"},
+	},
+}
+
+// DetectKind guesses the job kind of an output by its header,
+// it returns "" if the header is not known.
+func DetectKind(header []string) string {
+	if len(header) == 0 {
+		return ""
+	}
+	switch header[0] {
+	case "user_id":
+		return client.KindGetMembers
+	case "message_id":
+		return client.KindSearchMessages
+	case "chat_id":
+		return client.KindPrintDialogs
+	case "title":
+		if slices.Contains(header, "total_messages") {
+			return client.KindGetChatStats
+		}
+	}
+	return ""
+}
+
+// Columns returns the columns of header for the job kind. Columns
+// unknown to the kind are text titled by their name.
+func Columns(kind string, header []string) []Column {
+	known := schemas[kind]
+	cols := make([]Column, len(header))
+	for i, name := range header {
+		j := slices.IndexFunc(known, func(c Column) bool { return c.Name == name })
+		switch {
+		case name != "" && j >= 0:
+			cols[i] = known[j]
+		case name == "":
+			cols[i] = Column{Title: "#" + strconv.Itoa(i+1)}
+		default:
+			cols[i] = Column{Name: name, Title: name}
+		}
+	}
+	return cols
+}
+
+// Compare compares the values a and b of the column. Numbers and times
+// that can't be parsed are less than the ones that can.
+func (c Column) Compare(a, b string) int {
+	switch c.Type {
+	case ColumnNumber:
+		x, errX := strconv.ParseFloat(a, 64)
+		y, errY := strconv.ParseFloat(b, 64)
+		if errX == nil && errY == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+		return compareParsed(errX == nil, errY == nil, a, b)
+	case ColumnTime:
+		x, errX := time.Parse(c.Layout, a)
+		y, errY := time.Parse(c.Layout, b)
+		if errX == nil && errY == nil {
+			return x.Compare(y)
+		}
+		return compareParsed(errX == nil, errY == nil, a, b)
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func compareParsed(okA, okB bool, a, b string) int {
+	switch {
+	case okA:
+		return 1
+	case okB:
+		return -1
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
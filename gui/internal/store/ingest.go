@@ -0,0 +1,337 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	"github.com/mauzec/tdsoft/gui/internal/output"
+)
+
+// ingest is the ingest of a single job in a transaction.
+type ingest struct {
+	ctx  context.Context
+	tx   *sql.Tx
+	job  Job
+	seen string
+}
+
+// read calls fn with every row of the job output.
+// cols maps the names of the columns to their indexes.
+func (in *ingest) read(fn func(cols map[string]int, row []string) error) (int, error) {
+	req := in.job.Request
+	r, err := output.OpenReader(req.OutputFormat(), req.OutputPath(), req.Kind())
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	cols := make(map[string]int)
+	for i, c := range r.Columns() {
+		if _, ok := cols[c]; !ok && c != "" {
+			cols[c] = i
+		}
+	}
+	n := 0
+	for {
+		row, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := in.ctx.Err(); err != nil {
+			return n, err
+		}
+		if err := fn(cols, row); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// value returns the value of the column name in row, "" if there is none.
+func value(cols map[string]int, row []string, name string) string {
+	i, ok := cols[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
+
+// flag returns 1 if the value of column name is yes, 0 if it is not,
+// and NULL if the column is missing or the value is unknown.
+func flag(cols map[string]int, row []string, name, yes, no string) any {
+	switch value(cols, row, name) {
+	case yes:
+		return 1
+	case no:
+		return 0
+	}
+	return nil
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// number returns s as a number, or NULL if it is not one, e.g. UNKNOWN.
+func number(s string) any {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return nil
+}
+
+// newer is true in an upsert of users when the row is of a newer job.
+const newer = "excluded.updated_at >= users.updated_at"
+
+// latest returns the value of the users column col of the newer job,
+// or of the older one if the newer job does not have it.
+func latest(col string) string {
+	return fmt.Sprintf("CASE WHEN %[2]s THEN COALESCE(excluded.%[1]s, users.%[1]s) "+
+		"ELSE COALESCE(users.%[1]s, excluded.%[1]s) END", col, newer)
+}
+
+func (in *ingest) members(chat string) (int, error) {
+	upsertUser, err := in.tx.PrepareContext(in.ctx, `INSERT INTO users
+		(user_id, username, first_name, last_name, is_bot, bio, is_premium,
+		 is_deleted, is_scam, is_verified, phone, updated_at, job_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			username = CASE WHEN `+newer+` THEN excluded.username ELSE users.username END,
+			first_name = CASE WHEN `+newer+` THEN excluded.first_name ELSE users.first_name END,
+			last_name = CASE WHEN `+newer+` THEN excluded.last_name ELSE users.last_name END,
+			is_bot = `+latest("is_bot")+`,
+			bio = `+latest("bio")+`,
+			is_premium = `+latest("is_premium")+`,
+			is_deleted = `+latest("is_deleted")+`,
+			is_scam = `+latest("is_scam")+`,
+			is_verified = `+latest("is_verified")+`,
+			phone = `+latest("phone")+`,
+			job_id = CASE WHEN `+newer+` THEN excluded.job_id ELSE users.job_id END,
+			updated_at = MAX(users.updated_at, excluded.updated_at)`)
+	if err != nil {
+		return 0, err
+	}
+	defer upsertUser.Close()
+
+	// an older job only moves first_seen back, a newer one sets the rest
+	upsertMembership, err := in.tx.PrepareContext(in.ctx, `INSERT INTO memberships
+		(chat, user_id, is_member, first_seen, last_seen, first_job_id, last_job_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat, user_id) DO UPDATE SET
+			is_member = CASE WHEN excluded.last_seen >= memberships.last_seen
+				THEN excluded.is_member ELSE memberships.is_member END,
+			first_job_id = CASE WHEN excluded.first_seen < memberships.first_seen
+				THEN excluded.first_job_id ELSE memberships.first_job_id END,
+			first_seen = MIN(memberships.first_seen, excluded.first_seen),
+			last_job_id = CASE WHEN excluded.last_seen >= memberships.last_seen
+				THEN excluded.last_job_id ELSE memberships.last_job_id END,
+			last_seen = MAX(memberships.last_seen, excluded.last_seen)`)
+	if err != nil {
+		return 0, err
+	}
+	defer upsertMembership.Close()
+
+	if _, err := in.tx.ExecContext(in.ctx,
+		"DELETE FROM member_snapshots WHERE job_id = ?", in.job.ID); err != nil {
+		return 0, err
+	}
+	insertSnapshot, err := in.tx.PrepareContext(in.ctx, `INSERT OR REPLACE INTO member_snapshots
+		(job_id, user_id, username, first_name, last_name, is_premium, is_scam)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertSnapshot.Close()
+
+	return in.read(func(cols map[string]int, row []string) error {
+		id, err := strconv.ParseInt(value(cols, row, "user_id"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad user_id %q", value(cols, row, "user_id"))
+		}
+		var bio any
+		if _, ok := cols["bio"]; ok {
+			bio = value(cols, row, "bio")
+		}
+		var phone any
+		if _, ok := cols["phone_number"]; ok {
+			phone = value(cols, row, "phone_number")
+		}
+		_, err = upsertUser.ExecContext(in.ctx, id,
+			value(cols, row, "username"),
+			value(cols, row, "first_name"),
+			value(cols, row, "last_name"),
+			flag(cols, row, "is_bot", "bot", "user"),
+			bio,
+			flag(cols, row, "premium_status", "premium", "not premium"),
+			flag(cols, row, "is_deleted", "is_deleted", "not deleted"),
+			flag(cols, row, "is_scam", "scam", "not scam"),
+			flag(cols, row, "is_verified", "verified", "not verified"),
+			phone, in.seen, in.job.ID)
+		if err != nil {
+			return err
+		}
+		isMember := flag(cols, row, "is_member", "member", "not member")
+		_, err = upsertMembership.ExecContext(in.ctx, chat, id, isMember,
+			in.seen, in.seen, in.job.ID, in.job.ID)
+		if err != nil || isMember == 0 {
+			return err
+		}
+		_, err = insertSnapshot.ExecContext(in.ctx, in.job.ID, id,
+			value(cols, row, "username"),
+			value(cols, row, "first_name"),
+			value(cols, row, "last_name"),
+			flag(cols, row, "premium_status", "premium", "not premium"),
+			flag(cols, row, "is_scam", "scam", "not scam"))
+		return err
+	})
+}
+
+// topSender is an item of stats_snapshots.top_senders.
+type topSender struct {
+	Username string `json:"username"`
+	Count    int64  `json:"count"`
+}
+
+// stats stores the stats output: the first row has the stats, the next
+// rows have a top sender and their count in the last two columns.
+func (in *ingest) stats(chat string) (int, error) {
+	var (
+		first   []string
+		cols    map[string]int
+		senders []topSender
+	)
+	n, err := in.read(func(c map[string]int, row []string) error {
+		if first == nil {
+			first, cols = row, c
+			return nil
+		}
+		if len(row) < 2 {
+			return nil
+		}
+		count, _ := strconv.ParseInt(row[len(row)-1], 10, 64)
+		senders = append(senders, topSender{Username: row[len(row)-2], Count: count})
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if first == nil {
+		return 0, errors.New("no stats in the output")
+	}
+
+	known := func(name string) string {
+		v := value(cols, first, name)
+		if v == "UNKNOWN" {
+			return ""
+		}
+		return v
+	}
+	top, err := json.Marshal(senders)
+	if err != nil {
+		return 0, err
+	}
+	_, err = in.tx.ExecContext(in.ctx, `INSERT OR REPLACE INTO stats_snapshots
+		(job_id, chat, taken_at, title, username, members, bio, is_verified, is_fake,
+		 is_scam, can_forward, invite_link, total_messages, day_median, week_median,
+		 weekday_median, top_senders)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		in.job.ID, chat, in.seen,
+		nullString(known("title")), nullString(known("username")),
+		number(value(cols, first, "public_members_count")),
+		nullString(value(cols, first, "bio")),
+		flag(cols, first, "is_verified", "yes", "no"),
+		flag(cols, first, "is_fake", "yes", "no"),
+		flag(cols, first, "is_scam", "yes", "no"),
+		flag(cols, first, "can_forward", "yes", "no"),
+		nullString(known("invite_link")),
+		number(value(cols, first, "total_messages")),
+		number(value(cols, first, "day_median")),
+		number(value(cols, first, "week_median")),
+		number(value(cols, first, "weekday_median")),
+		string(top))
+	if err != nil {
+		return 0, err
+	}
+	return n, in.upsertChat(chat, nil, "", known("title"), known("username"))
+}
+
+func (in *ingest) messages(chat, sender string) (int, error) {
+	upsert, err := in.tx.PrepareContext(in.ctx, `INSERT INTO messages
+		(chat, message_id, sender, text, date, job_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat, message_id) DO UPDATE SET
+			sender = excluded.sender,
+			text = excluded.text,
+			date = excluded.date,
+			job_id = excluded.job_id`)
+	if err != nil {
+		return 0, err
+	}
+	defer upsert.Close()
+
+	return in.read(func(cols map[string]int, row []string) error {
+		id, err := strconv.ParseInt(value(cols, row, "message_id"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad message_id %q", value(cols, row, "message_id"))
+		}
+		var date any
+		if t, err := time.Parse(client.SearchMessagesDateLayout, value(cols, row, "date")); err == nil {
+			date = t.Format(timeLayout)
+		}
+		_, err = upsert.ExecContext(in.ctx, chat, id, sender,
+			value(cols, row, "text"), date, in.job.ID)
+		return err
+	})
+}
+
+// dialogs stores the dialogs as chats, by username if they have one.
+func (in *ingest) dialogs() (int, error) {
+	return in.read(func(cols map[string]int, row []string) error {
+		id := value(cols, row, "chat_id")
+		username := value(cols, row, "username")
+		key := ChatKey(username)
+		if key == "" {
+			key = id
+		}
+		if key == "" {
+			return nil
+		}
+		return in.upsertChat(key, number(id), value(cols, row, "type"),
+			value(cols, row, "title"), username)
+	})
+}
+
+// upsertChat updates the chat, empty values keep the stored ones.
+func (in *ingest) upsertChat(chat string, chatID any, typ, title, username string) error {
+	_, err := in.tx.ExecContext(in.ctx, `INSERT INTO chats
+		(chat, chat_id, type, title, username, updated_at, job_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat) DO UPDATE SET
+			chat_id = COALESCE(excluded.chat_id, chats.chat_id),
+			type = COALESCE(excluded.type, chats.type),
+			title = COALESCE(excluded.title, chats.title),
+			username = COALESCE(excluded.username, chats.username),
+			updated_at = excluded.updated_at,
+			job_id = excluded.job_id
+		WHERE excluded.updated_at >= chats.updated_at`,
+		chat, chatID, nullString(typ), nullString(title),
+		nullString(strings.TrimPrefix(username, "@")), in.seen, in.job.ID)
+	return err
+}
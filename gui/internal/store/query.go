@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	"github.com/mauzec/tdsoft/gui/internal/members"
+)
+
+// ErrNoSnapshot is returned for a job without stored members, e.g. not
+// a members job, or one ingested before member snapshots were kept.
+var ErrNoSnapshot = errors.New("no stored members of the job")
+
+// JobInfo is an ingested job.
+type JobInfo struct {
+	ID         string
+	Kind       string
+	Account    string
+	Chat       string
+	Output     string
+	FinishedAt time.Time
+	IngestedAt time.Time
+	Rows       int
+}
+
+// Jobs returns the ingested jobs of kind, all if kind is empty,
+// the latest first.
+func (s *Store) Jobs(ctx context.Context, kind string) ([]JobInfo, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, kind, account, COALESCE(chat, ''),
+		output, finished_at, ingested_at, row_count FROM jobs
+		WHERE ? = '' OR kind = ? ORDER BY finished_at DESC, id DESC`, kind, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []JobInfo
+	for rows.Next() {
+		var (
+			j                  JobInfo
+			finished, ingested string
+		)
+		err := rows.Scan(&j.ID, &j.Kind, &j.Account, &j.Chat, &j.Output,
+			&finished, &ingested, &j.Rows)
+		if err != nil {
+			return nil, err
+		}
+		j.FinishedAt, _ = time.Parse(timeLayout, finished)
+		j.IngestedAt, _ = time.Parse(timeLayout, ingested)
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+// User is a row of the users table.
+type User struct {
+	ID        int64
+	Username  string
+	FirstName string
+	LastName  string
+}
+
+// CommonUsers returns the users seen in every one of chats,
+// see [ChatKey] for the references.
+func (s *Store) CommonUsers(ctx context.Context, chats ...string) ([]User, error) {
+	if len(chats) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(chats))
+	marks := make([]string, len(chats))
+	for i, c := range chats {
+		args[i] = ChatKey(c)
+		marks[i] = "?"
+	}
+	args = append(args, len(chats))
+	rows, err := s.db.QueryContext(ctx, `SELECT u.user_id, COALESCE(u.username, ''),
+		COALESCE(u.first_name, ''), COALESCE(u.last_name, '')
+		FROM users u JOIN memberships m ON m.user_id = u.user_id
+		WHERE m.chat IN (`+strings.Join(marks, ", ")+`)
+		GROUP BY u.user_id HAVING COUNT(DISTINCT m.chat) = ?
+		ORDER BY u.user_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanUsers(rows)
+}
+
+func scanUsers(rows *sql.Rows) ([]User, error) {
+	defer rows.Close()
+	var out []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.FirstName, &u.LastName); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// MemberSnapshot returns the members stored by the members job id,
+// sorted by user ID.
+func (s *Store) MemberSnapshot(ctx context.Context, id string) ([]members.Member, error) {
+	var (
+		kind  string
+		count int
+	)
+	err := s.db.QueryRowContext(ctx, "SELECT kind, row_count FROM jobs WHERE id = ?", id).
+		Scan(&kind, &count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoSnapshot
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id, COALESCE(username, ''),
+		COALESCE(first_name, ''), COALESCE(last_name, ''), is_premium, is_scam
+		FROM member_snapshots WHERE job_id = ? ORDER BY user_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []members.Member
+	for rows.Next() {
+		var (
+			m             members.Member
+			premium, scam sql.NullBool
+		)
+		err := rows.Scan(&m.UserID, &m.Username, &m.FirstName, &m.LastName, &premium, &scam)
+		if err != nil {
+			return nil, err
+		}
+		if premium.Valid {
+			m.Premium = &premium.Bool
+		}
+		if scam.Valid {
+			m.Scam = &scam.Bool
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if kind != client.KindGetMembers || (len(out) == 0 && count > 0) {
+		return nil, ErrNoSnapshot
+	}
+	return out, nil
+}
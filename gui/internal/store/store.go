@@ -0,0 +1,325 @@
+// Package store keeps the results of jobs in a local SQLite database,
+// so outputs of different jobs can be queried together:
+//
+//	jobs            a row per ingested job, by job ID
+//	chats           chats by the reference used in requests, see [ChatKey]
+//	users           the latest known data of every user
+//	memberships     users seen in a chat, with first_seen and last_seen
+//	messages        messages found by search jobs
+//	stats_snapshots a row per stats job
+//	member_snapshots the members of every members job
+//
+// Every row keeps the ID of the job it comes from.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	_ "modernc.org/sqlite"
+)
+
+// timeLayout is the layout times are stored with, it sorts as text.
+const timeLayout = "2006-01-02 15:04:05"
+
+// migrations create the schema, the database keeps the number of
+// applied ones in user_version. Only append to it.
+var migrations = []string{
+	`CREATE TABLE jobs (
+		id          TEXT PRIMARY KEY,
+		kind        TEXT NOT NULL,
+		account     TEXT NOT NULL DEFAULT '',
+		chat        TEXT,
+		output      TEXT NOT NULL,
+		finished_at TEXT NOT NULL,
+		ingested_at TEXT NOT NULL,
+		row_count   INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE chats (
+		chat       TEXT PRIMARY KEY,
+		chat_id    INTEGER,
+		type       TEXT,
+		title      TEXT,
+		username   TEXT,
+		updated_at TEXT NOT NULL,
+		job_id     TEXT NOT NULL
+	);
+	CREATE TABLE users (
+		user_id     INTEGER PRIMARY KEY,
+		username    TEXT,
+		first_name  TEXT,
+		last_name   TEXT,
+		is_bot      INTEGER,
+		bio         TEXT,
+		is_premium  INTEGER,
+		is_deleted  INTEGER,
+		is_scam     INTEGER,
+		is_verified INTEGER,
+		phone       TEXT,
+		updated_at  TEXT NOT NULL,
+		job_id      TEXT NOT NULL
+	);
+	CREATE TABLE memberships (
+		chat         TEXT NOT NULL,
+		user_id      INTEGER NOT NULL,
+		is_member    INTEGER,
+		first_seen   TEXT NOT NULL,
+		last_seen    TEXT NOT NULL,
+		first_job_id TEXT NOT NULL,
+		last_job_id  TEXT NOT NULL,
+		PRIMARY KEY (chat, user_id)
+	);
+	CREATE INDEX memberships_user ON memberships (user_id);
+	CREATE TABLE messages (
+		chat       TEXT NOT NULL,
+		message_id INTEGER NOT NULL,
+		sender     TEXT NOT NULL,
+		text       TEXT,
+		date       TEXT,
+		job_id     TEXT NOT NULL,
+		PRIMARY KEY (chat, message_id)
+	);
+	CREATE TABLE stats_snapshots (
+		job_id         TEXT PRIMARY KEY,
+		chat           TEXT NOT NULL,
+		taken_at       TEXT NOT NULL,
+		title          TEXT,
+		username       TEXT,
+		members        INTEGER,
+		bio            TEXT,
+		is_verified    INTEGER,
+		is_fake        INTEGER,
+		is_scam        INTEGER,
+		can_forward    INTEGER,
+		invite_link    TEXT,
+		total_messages INTEGER,
+		day_median     REAL,
+		week_median    REAL,
+		weekday_median REAL,
+		top_senders    TEXT
+	);
+	CREATE INDEX stats_snapshots_chat ON stats_snapshots (chat, taken_at);`,
+
+	// members of every members job, to compare the lists of two jobs
+	`CREATE TABLE member_snapshots (
+		job_id     TEXT NOT NULL,
+		user_id    INTEGER NOT NULL,
+		username   TEXT,
+		first_name TEXT,
+		last_name  TEXT,
+		is_premium INTEGER,
+		is_scam    INTEGER,
+		PRIMARY KEY (job_id, user_id)
+	);`,
+}
+
+// Store is an opened database. It is safe for concurrent use,
+// ingests run one at a time.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it and its directory
+// if needed, and brings the schema up to date.
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// a single connection serializes writes
+	db.SetMaxOpenConns(1)
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// DB returns the database, e.g. to run own queries.
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than %d", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Job is a finished job which output is ingested.
+type Job struct {
+	ID      string
+	Account string
+	Request client.Request
+	// FinishedAt is the time the rows were seen, the ingest time if zero.
+	FinishedAt time.Time
+}
+
+// JobFromJournal returns the job of a journal entry. Entries written
+// before job IDs have an ID made of the start time.
+func JobFromJournal(e client.JournalEntry) (Job, error) {
+	req, err := e.DecodeRequest()
+	if err != nil {
+		return Job{}, err
+	}
+	id := e.JobID
+	if id == "" {
+		id = "journal-" + e.StartedAt.Format("20060102-150405.000000")
+	}
+	account := e.Account
+	if account == "" {
+		account = filepath.Base(e.Session)
+	}
+	return Job{ID: id, Account: account, Request: req, FinishedAt: e.EndedAt}, nil
+}
+
+// Has reports whether the job id is ingested.
+func (s *Store) Has(ctx context.Context, id string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM jobs WHERE id = ?", id).Scan(&n)
+	return n > 0, err
+}
+
+// Ingest reads the output of job and stores its rows. Ingesting a job
+// again replaces what it stored before, memberships keep the earliest
+// first_seen and the latest last_seen.
+func (s *Store) Ingest(ctx context.Context, job Job) (rows int, err error) {
+	if job.ID == "" {
+		return 0, errors.New("job without ID")
+	}
+	if job.Request == nil {
+		return 0, errors.New("job without request")
+	}
+	seen := job.FinishedAt
+	if seen.IsZero() {
+		seen = time.Now()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	in := &ingest{ctx: ctx, tx: tx, job: job, seen: seen.UTC().Format(timeLayout)}
+	var chat string
+	switch req := job.Request.(type) {
+	case *client.GetMembersRequest:
+		chat = ChatKey(req.ChatID)
+		rows, err = in.members(chat)
+	case *client.GetChatStatsRequest:
+		chat = ChatKey(req.ChatID)
+		rows, err = in.stats(chat)
+	case *client.SearchMessagesRequest:
+		chat = ChatKey(req.ChatID)
+		rows, err = in.messages(chat, ChatKey(req.Username))
+	case *client.PrintDialogsRequest:
+		rows, err = in.dialogs()
+	default:
+		return 0, fmt.Errorf("unknown request kind %q", job.Request.Kind())
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ingest %s: %w", job.Request.OutputPath(), err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO jobs
+		(id, kind, account, chat, output, finished_at, ingested_at, row_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Request.Kind(), job.Account, nullString(chat),
+		job.Request.OutputPath(), in.seen, time.Now().UTC().Format(timeLayout), rows)
+	if err != nil {
+		return 0, err
+	}
+	return rows, tx.Commit()
+}
+
+// IngestJournal ingests the jobs of done entries that are not in the store.
+// Entries which output is removed are skipped. A failed entry does not
+// stop the rest, errors are joined.
+func (s *Store) IngestJournal(ctx context.Context, entries []client.JournalEntry) (jobs int, err error) {
+	var errs []error
+	for _, e := range entries {
+		if e.Status != client.RunStatusDone {
+			continue
+		}
+		job, err := JobFromJournal(e)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ok, err := s.Has(ctx, job.ID)
+		if err != nil {
+			return jobs, err
+		}
+		if ok {
+			continue
+		}
+		if _, err := os.Stat(job.Request.OutputPath()); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if _, err := s.Ingest(ctx, job); err != nil {
+			if ctx.Err() != nil {
+				return jobs, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("job %s: %w", job.ID, err))
+			continue
+		}
+		jobs++
+	}
+	return jobs, errors.Join(errs...)
+}
+
+// ChatKey returns the key of a chat reference: a username in lower case
+// without @ and t.me/, or the chat ID as is.
+func ChatKey(ref string) string {
+	ref = strings.TrimSpace(ref)
+	for _, p := range []string{"https://", "http://", "www.", "t.me/", "telegram.me/", "@"} {
+		if len(ref) >= len(p) && strings.EqualFold(ref[:len(p)], p) {
+			ref = ref[len(p):]
+		}
+	}
+	return strings.ToLower(strings.TrimRight(ref, "/"))
+}
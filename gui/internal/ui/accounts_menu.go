@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"errors"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"go.uber.org/zap"
+)
+
+// newAccountSelect returns a select of accounts to run a job with,
+// the current account is selected.
+func newAccountSelect(cl *client.Client) *widget.Select {
+	var names []string
+	for _, a := range cl.Accounts() {
+		names = append(names, a.Name)
+	}
+	sel := widget.NewSelect(names, nil)
+	sel.SetSelected(cl.CurrentAccount().Name)
+	return sel
+}
+
+// switchAccount makes name current and shows the login screen
+// if the account needs login.
+func switchAccount(r *Router, cl *client.Client, name string) {
+	err := cl.SwitchAccount(name)
+	switch {
+	case err == nil:
+		_ = cl.UserLog(1, "Switched to account "+name)
+	case errors.Is(err, apperrors.ErrNeedAuth):
+		r.ClearScreenAndShow(ScreenLogin)
+	default:
+		cl.ExtLog.Error("failed to switch account", zap.String("account", name), zap.Error(err))
+		_ = cl.UserLog(3, "failed to switch account: "+err.Error())
+	}
+}
+
+// accountBar switches, adds and signs out accounts, and shows their sessions.
+// It is the part of mainScreen.
+//
+//	Services: *client.Client, fyne.Window
+func accountBar(r *Router) fyne.CanvasObject {
+	var (
+		cl *client.Client
+		w  fyne.Window
+	)
+	_ = r.GetServiceAs(&cl)
+	_ = r.GetServiceAs(&w)
+
+	sel := newAccountSelect(cl)
+	sel.OnChanged = func(name string) {
+		if name == cl.CurrentAccount().Name {
+			return
+		}
+		switchAccount(r, cl, name)
+	}
+
+	addButton := widget.NewButton("Add account", func() {
+		nameEntry := widget.NewEntry()
+		nameEntry.SetPlaceHolder("letters, digits, - and _")
+		dialog.ShowForm("Add account", "Add", "Cancel",
+			[]*widget.FormItem{widget.NewFormItem("Name", nameEntry)},
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				a, err := cl.AddAccount(nameEntry.Text)
+				if err != nil {
+					cl.ExtLog.Warn("failed to add account", zap.Error(err))
+					dialog.ShowError(err, w)
+					return
+				}
+				switchAccount(r, cl, a.Name)
+			}, w)
+	})
+
+	sessionsButton := widget.NewButton("Sessions", func() {
+		showSessions(cl, w)
+	})
+	signOutButton := widget.NewButton("Sign out", func() {
+		signOut(r, cl, w, cl.CurrentAccount().Name)
+	})
+
+	return container.NewHBox(widget.NewLabel("Account:"), sel, addButton, sessionsButton, signOutButton)
+}
@@ -0,0 +1,105 @@
+package custom
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ProgressView shows progress of a running job: a determinate bar with
+// counters and ETA, or an infinite bar while the total is unknown.
+//
+// All methods must be called on the fyne goroutine (see fyne.Do).
+type ProgressView struct {
+	Container *fyne.Container
+
+	bar      *widget.ProgressBar
+	infinite *widget.ProgressBarInfinite
+	label    *widget.Label
+
+	phase      string
+	phaseStart time.Time
+	phaseFrom  int
+}
+
+func NewProgressView() *ProgressView {
+	pv := &ProgressView{
+		bar:      widget.NewProgressBar(),
+		infinite: widget.NewProgressBarInfinite(),
+		label:    widget.NewLabel(""),
+	}
+	pv.label.Alignment = fyne.TextAlignCenter
+	pv.Container = container.NewVBox(
+		container.NewStack(pv.bar, pv.infinite),
+		pv.label,
+	)
+	pv.infinite.Stop()
+	pv.Container.Hide()
+	return pv
+}
+
+// Start shows the view in the waiting state.
+func (pv *ProgressView) Start() {
+	pv.phase = ""
+	pv.bar.Hide()
+	pv.infinite.Show()
+	pv.infinite.Start()
+	pv.label.SetText("Waiting...")
+	pv.Container.Show()
+}
+
+// Set updates the view. Total <= 0 means unknown total.
+func (pv *ProgressView) Set(phase string, current, total int) {
+	now := time.Now()
+	if phase != pv.phase {
+		pv.phase = phase
+		pv.phaseStart = now
+		pv.phaseFrom = current
+	}
+
+	if total <= 0 {
+		pv.bar.Hide()
+		pv.infinite.Show()
+		pv.infinite.Start()
+		pv.label.SetText(fmt.Sprintf("%s: %d", phase, current))
+		return
+	}
+
+	pv.infinite.Stop()
+	pv.infinite.Hide()
+	pv.bar.Show()
+	pv.bar.Max = float64(total)
+	pv.bar.SetValue(float64(min(current, total)))
+
+	text := fmt.Sprintf("%s: %d/%d", phase, current, total)
+	if eta, ok := pv.eta(now, current, total); ok {
+		text += ", ETA " + eta.String()
+	}
+	pv.label.SetText(text)
+}
+
+// Finish stops the view and shows msg.
+func (pv *ProgressView) Finish(msg string) {
+	pv.infinite.Stop()
+	pv.infinite.Hide()
+	pv.bar.Show()
+	pv.label.SetText(msg)
+}
+
+func (pv *ProgressView) Hide() {
+	pv.infinite.Stop()
+	pv.Container.Hide()
+}
+
+func (pv *ProgressView) eta(now time.Time, current, total int) (time.Duration, bool) {
+	done := current - pv.phaseFrom
+	elapsed := now.Sub(pv.phaseStart)
+	if done <= 0 || elapsed <= 0 || current >= total {
+		return 0, false
+	}
+	perItem := elapsed / time.Duration(done)
+	return (perItem * time.Duration(total-current)).Round(time.Second), true
+}
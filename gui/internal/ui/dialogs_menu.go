@@ -0,0 +1,354 @@
+package ui
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	"github.com/mauzec/tdsoft/gui/internal/jobs"
+	"github.com/mauzec/tdsoft/gui/internal/ui/custom"
+	"github.com/mauzec/tdsoft/gui/internal/utils"
+	"go.uber.org/zap"
+)
+
+const defaultDialogsLimit = "100"
+
+// dialogsTypeAll and others are the options of the type filter of dialogsMenu.
+const (
+	dialogsTypeAll     = "All"
+	dialogsTypeGroup   = "Group"
+	dialogsTypeChannel = "Channel"
+	dialogsTypePrivate = "Private"
+	dialogsTypeBot     = "Bot"
+)
+
+// dialogsColumns are the columns of the dialogs table, the last one has the actions.
+var dialogsColumns = []string{"Chat ID", "Type", "Title", "Username", ""}
+
+const dialogsActionsColumn = 4
+
+// dialogsMenu loads the dialogs of an account and shows them in a table,
+// that can be searched, filtered by type and sorted by a column. A chat can
+// be opened in the members, chat stats or search messages menus with
+// showMenu of mainScreen. It is the part of mainScreen.
+//
+//	Services: *client.Client, *jobs.Manager
+func dialogsMenu(r *Router, showMenu func(menu MenuID, chat string)) fyne.CanvasObject {
+	var (
+		cl *client.Client
+		jm *jobs.Manager
+	)
+	_ = r.GetServiceAs(&cl)
+	_ = r.GetServiceAs(&jm)
+
+	header := widget.NewLabelWithStyle("Dialogs",
+		fyne.TextAlignCenter, fyne.TextStyle{Bold: true},
+	)
+
+	accountSelect := newAccountSelect(cl)
+
+	limitEntry := custom.NewNumericalEntry()
+	limitEntry.SetPlaceHolder("1..∞")
+	limitEntry.Validator = nil
+	limitEntry.SetText(defaultDialogsLimit)
+
+	outputEntry := widget.NewEntry()
+	outputEntry.SetPlaceHolder("e.g. dialogs.csv")
+	outputEntry.Validator = nil
+
+	var (
+		all      []client.Dialog
+		shown    []client.Dialog
+		sortCol  = -1
+		sortDesc bool
+	)
+
+	searchEntry := widget.NewEntry()
+	searchEntry.SetPlaceHolder("Search by id, title or username")
+	typeSelect := widget.NewSelect([]string{
+		dialogsTypeAll, dialogsTypeGroup, dialogsTypeChannel, dialogsTypePrivate, dialogsTypeBot,
+	}, nil)
+	typeSelect.SetSelected(dialogsTypeAll)
+	countLabel := widget.NewLabel("")
+
+	table := widget.NewTable(
+		func() (int, int) { return len(shown), len(dialogsColumns) },
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			actions := container.NewHBox(
+				widget.NewButton("Members", nil),
+				widget.NewButton("Stats", nil),
+				widget.NewButton("Search", nil),
+			)
+			return container.NewStack(label, actions)
+		},
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			if id.Row >= len(shown) {
+				return
+			}
+			d := shown[id.Row]
+			stack := o.(*fyne.Container)
+			label := stack.Objects[0].(*widget.Label)
+			actions := stack.Objects[1].(*fyne.Container)
+			if id.Col != dialogsActionsColumn {
+				actions.Hide()
+				label.Show()
+				label.SetText(dialogCell(d, id.Col))
+				return
+			}
+			label.Hide()
+			actions.Show()
+			membersButton := actions.Objects[0].(*widget.Button)
+			statsButton := actions.Objects[1].(*widget.Button)
+			searchButton := actions.Objects[2].(*widget.Button)
+			membersButton.OnTapped = func() { showMenu(MenuMembers, d.Chat()) }
+			statsButton.OnTapped = func() { showMenu(MenuChatStats, d.Chat()) }
+			searchButton.OnTapped = func() { showMenu(MenuSearchMessages, d.Chat()) }
+			// members and statistics exist only for groups and channels
+			if d.IsGroup() || d.Type == client.ChatTypeChannel {
+				membersButton.Enable()
+				statsButton.Enable()
+			} else {
+				membersButton.Disable()
+				statsButton.Disable()
+			}
+		},
+	)
+
+	update := func() {
+		query := strings.ToLower(strings.TrimSpace(searchEntry.Text))
+		shown = shown[:0]
+		for _, d := range all {
+			if dialogMatches(d, query, typeSelect.Selected) {
+				shown = append(shown, d)
+			}
+		}
+		if sortCol >= 0 {
+			slices.SortStableFunc(shown, func(a, b client.Dialog) int {
+				c := compareDialogs(a, b, sortCol)
+				if sortDesc {
+					return -c
+				}
+				return c
+			})
+		}
+		countLabel.SetText(strconv.Itoa(len(shown)) + " of " + strconv.Itoa(len(all)))
+		table.Refresh()
+	}
+	searchEntry.OnChanged = func(string) { update() }
+	typeSelect.OnChanged = func(string) { update() }
+
+	table.ShowHeaderRow = true
+	table.CreateHeader = func() fyne.CanvasObject {
+		b := widget.NewButton("", nil)
+		b.Importance = widget.LowImportance
+		return b
+	}
+	table.UpdateHeader = func(id widget.TableCellID, o fyne.CanvasObject) {
+		b := o.(*widget.Button)
+		text := dialogsColumns[id.Col]
+		if id.Col == sortCol {
+			if sortDesc {
+				text += " ▼"
+			} else {
+				text += " ▲"
+			}
+		}
+		b.SetText(text)
+		if id.Col == dialogsActionsColumn {
+			b.OnTapped = nil
+			return
+		}
+		b.OnTapped = func() {
+			if sortCol == id.Col {
+				sortDesc = !sortDesc
+			} else {
+				sortCol, sortDesc = id.Col, false
+			}
+			update()
+		}
+	}
+	table.OnSelected = func(id widget.TableCellID) {
+		table.Unselect(id)
+		if id.Row < 0 || id.Row >= len(shown) || id.Col == dialogsActionsColumn {
+			return
+		}
+		fyne.CurrentApp().Clipboard().SetContent(strconv.FormatInt(shown[id.Row].ChatID, 10))
+		countLabel.SetText("Chat ID copied")
+	}
+	table.SetColumnWidth(0, 130)
+	table.SetColumnWidth(1, 90)
+	table.SetColumnWidth(2, 200)
+	table.SetColumnWidth(3, 130)
+	table.SetColumnWidth(4, 260)
+
+	loadButton := widget.NewButton("Load", nil)
+	stopButton := widget.NewButton("Stop", nil)
+	stopButton.Disable()
+	progress := custom.NewProgressView()
+	loadButton.OnTapped = func() {
+		accountSelect.Disable()
+		limitEntry.Disable()
+		outputEntry.Disable()
+		loadButton.Disable()
+		enableAll := func() {
+			fyne.Do(func() {
+				accountSelect.Enable()
+				limitEntry.Enable()
+				outputEntry.Enable()
+				loadButton.Enable()
+				stopButton.Disable()
+			})
+		}
+
+		req := &client.PrintDialogsRequest{}
+
+		if limitEntry.Text == "" {
+			limitEntry.SetText(defaultDialogsLimit)
+		}
+		limit, err := utils.ValidateAndGetNumeric(limitEntry.Text, 1, math.MaxInt32)
+		if err != nil {
+			cl.ExtLog.Warn("bad dialogs limit",
+				zap.String("value", limitEntry.Text),
+				zap.Error(err),
+			)
+			enableAll()
+			return
+		}
+		req.Limit = limit
+
+		if outputEntry.Text == "" {
+			outputEntry.SetText(
+				"dialogs-" + time.Now().Format("20060102-150405") + ".csv",
+			)
+		}
+		req.Output = outputEntry.Text
+
+		if err := req.Validate(); err != nil {
+			cl.ExtLog.Error("validating print dialogs request failed",
+				zap.Error(err),
+			)
+			enableAll()
+			return
+		}
+
+		progress.Start()
+		job, err := jm.Submit(context.Background(), req,
+			client.WithAccount(accountSelect.Selected),
+			client.WithProgress(func(p client.Progress) {
+				fyne.Do(func() { progress.Set(p.Phase, p.Current, p.Total) })
+			}))
+		if err != nil {
+			cl.ExtLog.Error("failed to submit job", zap.Error(err))
+			progress.Hide()
+			enableAll()
+			return
+		}
+		stopButton.OnTapped = func() { _ = jm.Cancel(job.ID) }
+		stopButton.Enable()
+
+		go func() {
+			<-job.Done()
+			var dialogs []client.Dialog
+			if job.Status() == jobs.StatusDone {
+				var err error
+				if dialogs, err = client.ReadDialogs(req.Output); err != nil {
+					cl.ExtLog.Error("failed to read dialogs", zap.Error(err))
+				}
+			}
+			fyne.Do(func() {
+				progress.Finish(jobResultText(job))
+				if job.Status() == jobs.StatusDone {
+					all = dialogs
+					update()
+				}
+			})
+			enableAll()
+		}()
+	}
+
+	form := container.New(layout.NewFormLayout(),
+		widget.NewLabel("Account"), accountSelect,
+		widget.NewLabel("Dialogs limit"), limitEntry,
+		widget.NewLabel("Output CSV"), outputEntry,
+	)
+	actions := container.NewCenter(container.New(
+		layout.NewGridWrapLayout(func() fyne.Size {
+			sz := loadButton.MinSize()
+			return fyne.Size{Width: sz.Width + 25.0, Height: sz.Height}
+		}()), loadButton, stopButton,
+	))
+	filters := container.NewBorder(nil, nil, nil,
+		container.NewHBox(typeSelect, countLabel), searchEntry,
+	)
+	return container.NewVBox(header, widget.NewSeparator(), form, actions, progress.Container,
+		filters,
+		container.New(layout.NewGridWrapLayout(fyne.NewSize(780, 300)), table),
+	)
+}
+
+// dialogCell returns the text of the column col of d.
+func dialogCell(d client.Dialog, col int) string {
+	switch col {
+	case 0:
+		return strconv.FormatInt(d.ChatID, 10)
+	case 1:
+		return d.Type
+	case 2:
+		return d.Title
+	case 3:
+		if d.Username == "" {
+			return ""
+		}
+		return "@" + d.Username
+	}
+	return ""
+}
+
+// compareDialogs compares a and b by the column col, ids as numbers,
+// the rest case-insensitively.
+func compareDialogs(a, b client.Dialog, col int) int {
+	if col == 0 {
+		return cmp.Compare(a.ChatID, b.ChatID)
+	}
+	return cmp.Compare(strings.ToLower(dialogCell(a, col)), strings.ToLower(dialogCell(b, col)))
+}
+
+// dialogMatches reports whether d has the type chosen by typ and contains
+// query (lower case) in its id, title or username.
+func dialogMatches(d client.Dialog, query, typ string) bool {
+	switch typ {
+	case dialogsTypeGroup:
+		if !d.IsGroup() {
+			return false
+		}
+	case dialogsTypeChannel:
+		if d.Type != client.ChatTypeChannel {
+			return false
+		}
+	case dialogsTypePrivate:
+		if d.Type != client.ChatTypePrivate {
+			return false
+		}
+	case dialogsTypeBot:
+		if d.Type != client.ChatTypeBot {
+			return false
+		}
+	}
+	if query == "" {
+		return true
+	}
+	return strings.Contains(strconv.FormatInt(d.ChatID, 10), query) ||
+		strings.Contains(strings.ToLower(d.Title), query) ||
+		strings.Contains(strings.ToLower(d.Username), query)
+}
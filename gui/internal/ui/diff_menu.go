@@ -0,0 +1,323 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	"github.com/mauzec/tdsoft/gui/internal/members"
+	"github.com/mauzec/tdsoft/gui/internal/output"
+	"github.com/mauzec/tdsoft/gui/internal/store"
+	"go.uber.org/zap"
+)
+
+// diffChangeAll is the option of the change filter of membersDiffMenu
+// showing all changes, the others are the change types.
+const diffChangeAll = "All"
+
+// diffColumns are the columns of the members diff table.
+var diffColumns = []string{"Change", "User ID", "Username", "First name", "Last name", "Changes"}
+
+// diffExtensions are the extensions of the outputs a member list is read from.
+var diffExtensions = []string{".csv", ".ndjson", ".jsonl", ".sqlite", ".db", ".xlsx"}
+
+// diffSource picks a member list: an output file, or the members
+// stored by a job if the store is configured.
+type diffSource struct {
+	pathEntry *widget.Entry
+	jobSelect *widget.Select
+	jobs      []store.JobInfo
+}
+
+func newDiffSource(st *store.Store) *diffSource {
+	s := &diffSource{pathEntry: widget.NewEntry()}
+	s.pathEntry.SetPlaceHolder("Members output, e.g. chat-members.csv")
+	if st != nil {
+		s.jobSelect = widget.NewSelect(nil, func(string) {
+			if s.jobSelect.SelectedIndex() >= 0 {
+				s.pathEntry.SetText("")
+			}
+		})
+		s.jobSelect.PlaceHolder = "(stored job)"
+		s.pathEntry.OnChanged = func(text string) {
+			if text != "" {
+				s.jobSelect.ClearSelected()
+			}
+		}
+	}
+	return s
+}
+
+// object returns the widgets of the source: the file with a browse
+// button, and the stored jobs.
+func (s *diffSource) object(w fyne.Window) fyne.CanvasObject {
+	browseButton := widget.NewButton("Browse...", func() {
+		d := dialog.NewFileOpen(func(rc fyne.URIReadCloser, err error) {
+			if err != nil || rc == nil {
+				return
+			}
+			s.pathEntry.SetText(rc.URI().Path())
+			_ = rc.Close()
+		}, w)
+		d.SetFilter(storage.NewExtensionFileFilter(diffExtensions))
+		d.Show()
+	})
+	right := container.NewHBox(browseButton)
+	if s.jobSelect != nil {
+		right.Add(s.jobSelect)
+	}
+	return container.NewBorder(nil, nil, nil, right, s.pathEntry)
+}
+
+// setJobs fills the stored jobs, the latest first.
+func (s *diffSource) setJobs(jobs []store.JobInfo) {
+	if s.jobSelect == nil {
+		return
+	}
+	s.jobs = jobs
+	options := make([]string, len(jobs))
+	for i, j := range jobs {
+		options[i] = fmt.Sprintf("%s, %s, %d rows (%s)", j.Chat,
+			j.FinishedAt.Local().Format("2006-01-02 15:04"), j.Rows, j.ID)
+	}
+	s.jobSelect.SetOptions(options)
+}
+
+// picked reports whether a file or a job is chosen.
+func (s *diffSource) picked() bool {
+	return s.pathEntry.Text != "" || (s.jobSelect != nil && s.jobSelect.SelectedIndex() >= 0)
+}
+
+// loader returns a func reading the chosen list, it can be called off the UI goroutine.
+func (s *diffSource) loader(r *Router, st *store.Store) func() ([]members.Member, error) {
+	if s.jobSelect != nil {
+		if i := s.jobSelect.SelectedIndex(); i >= 0 && i < len(s.jobs) {
+			id := s.jobs[i].ID
+			ctx := r.ScreenContext()
+			return func() ([]members.Member, error) { return st.MemberSnapshot(ctx, id) }
+		}
+	}
+	path := s.pathEntry.Text
+	return func() ([]members.Member, error) { return members.ReadFile(path) }
+}
+
+func (s *diffSource) disable() {
+	s.pathEntry.Disable()
+	if s.jobSelect != nil {
+		s.jobSelect.Disable()
+	}
+}
+
+func (s *diffSource) enable() {
+	s.pathEntry.Enable()
+	if s.jobSelect != nil {
+		s.jobSelect.Enable()
+	}
+}
+
+// membersDiffMenu compares two member lists of a chat by user ID and
+// shows who joined, left or changed their username, name or flags.
+// The lists are outputs of members jobs, or the members stored by jobs
+// if the store is configured. The diff can be exported.
+// It is the part of mainScreen.
+//
+//	Services: *client.Client, fyne.Window, *store.Store (optional)
+func membersDiffMenu(r *Router) fyne.CanvasObject {
+	var (
+		cl *client.Client
+		w  fyne.Window
+		st *store.Store
+	)
+	_ = r.GetServiceAs(&cl)
+	_ = r.GetServiceAs(&w)
+	_ = r.GetServiceAs(&st)
+
+	header := widget.NewLabelWithStyle("Members Diff",
+		fyne.TextAlignCenter, fyne.TextStyle{Bold: true},
+	)
+
+	oldSource := newDiffSource(st)
+	newSource := newDiffSource(st)
+	if st != nil {
+		ctx := r.ScreenContext()
+		go func() {
+			jobs, err := st.Jobs(ctx, client.KindGetMembers)
+			if err != nil {
+				cl.ExtLog.Error("failed to list stored members jobs", zap.Error(err))
+				return
+			}
+			fyne.Do(func() {
+				oldSource.setJobs(jobs)
+				newSource.setJobs(jobs)
+			})
+		}()
+	}
+
+	var (
+		diff  members.Diff
+		shown []members.Change
+	)
+	summaryLabel := widget.NewLabel("")
+	changeSelect := widget.NewSelect([]string{
+		diffChangeAll, string(members.Joined), string(members.Left), string(members.Changed),
+	}, nil)
+	changeSelect.SetSelected(diffChangeAll)
+
+	table := widget.NewTable(
+		func() (int, int) { return len(shown), len(diffColumns) },
+		func() fyne.CanvasObject {
+			l := widget.NewLabel("")
+			l.Truncation = fyne.TextTruncateEllipsis
+			return l
+		},
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			if id.Row >= len(shown) {
+				return
+			}
+			o.(*widget.Label).SetText(diffCell(shown[id.Row], id.Col))
+		},
+	)
+	table.ShowHeaderRow = true
+	table.CreateHeader = func() fyne.CanvasObject {
+		return widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	}
+	table.UpdateHeader = func(id widget.TableCellID, o fyne.CanvasObject) {
+		o.(*widget.Label).SetText(diffColumns[id.Col])
+	}
+	table.OnSelected = func(id widget.TableCellID) {
+		table.Unselect(id)
+		if id.Row < 0 || id.Row >= len(shown) {
+			return
+		}
+		fyne.CurrentApp().Clipboard().SetContent(diffCell(shown[id.Row], id.Col))
+		summaryLabel.SetText("Copied")
+	}
+	for col, width := range []float32{80, 120, 130, 120, 120, 300} {
+		table.SetColumnWidth(col, width)
+	}
+
+	update := func() {
+		shown = shown[:0]
+		for _, c := range diff.Changes {
+			if changeSelect.Selected == diffChangeAll || string(c.Type) == changeSelect.Selected {
+				shown = append(shown, c)
+			}
+		}
+		table.Refresh()
+		table.ScrollToTop()
+	}
+	changeSelect.OnChanged = func(string) { update() }
+
+	compareButton := widget.NewButton("Compare", nil)
+	exportButton := widget.NewButton("Export...", nil)
+	exportButton.Disable()
+
+	compareButton.OnTapped = func() {
+		if !oldSource.picked() || !newSource.picked() {
+			summaryLabel.SetText("Choose the old and the new members")
+			return
+		}
+		loadOld := oldSource.loader(r, st)
+		loadNew := newSource.loader(r, st)
+		compareButton.Disable()
+		exportButton.Disable()
+		oldSource.disable()
+		newSource.disable()
+		summaryLabel.SetText("Comparing...")
+
+		go func() {
+			before, err := loadOld()
+			var after []members.Member
+			if err == nil {
+				after, err = loadNew()
+			}
+			var d members.Diff
+			if err == nil {
+				d = members.Compare(before, after)
+			}
+			fyne.Do(func() {
+				compareButton.Enable()
+				oldSource.enable()
+				newSource.enable()
+				if err != nil {
+					cl.ExtLog.Error("failed to read members", zap.Error(err))
+					summaryLabel.SetText("Failed to read members: " + err.Error())
+					return
+				}
+				diff = d
+				summaryLabel.SetText(fmt.Sprintf("%d joined, %d left, %d changed (%d -> %d members)",
+					d.Count(members.Joined), d.Count(members.Left), d.Count(members.Changed), d.Old, d.New))
+				if len(d.Changes) > 0 {
+					exportButton.Enable()
+				}
+				update()
+			})
+		}()
+	}
+
+	exportButton.OnTapped = func() {
+		d := dialog.NewFileSave(func(wc fyne.URIWriteCloser, err error) {
+			if err != nil || wc == nil {
+				return
+			}
+			out := wc.URI().Path()
+			_ = wc.Close()
+			exported := diff
+			go func() {
+				err := exported.Export(output.FormatOf(out), out)
+				fyne.Do(func() {
+					if err != nil {
+						cl.ExtLog.Error("failed to export members diff", zap.String("path", out), zap.Error(err))
+						dialog.ShowError(err, w)
+						return
+					}
+					summaryLabel.SetText(fmt.Sprintf("%d changes exported to %s",
+						len(exported.Changes), filepath.Base(out)))
+				})
+			}()
+		}, w)
+		d.SetFileName("members-diff-" + time.Now().Format("20060102-150405") + ".csv")
+		d.Show()
+	}
+
+	form := container.New(layout.NewFormLayout(),
+		widget.NewLabel("Old members"), oldSource.object(w),
+		widget.NewLabel("New members"), newSource.object(w),
+	)
+	actions := container.NewCenter(container.NewHBox(compareButton, exportButton))
+	filters := container.NewBorder(nil, nil, nil, changeSelect, summaryLabel)
+	return container.NewVBox(header, widget.NewSeparator(), form, actions, filters,
+		container.New(layout.NewGridWrapLayout(fyne.NewSize(780, 300)), table),
+	)
+}
+
+// diffCell returns the text of the column col of c.
+func diffCell(c members.Change, col int) string {
+	m := c.Member
+	switch col {
+	case 0:
+		return string(c.Type)
+	case 1:
+		return strconv.FormatInt(m.UserID, 10)
+	case 2:
+		if m.Username == "" {
+			return ""
+		}
+		return "@" + m.Username
+	case 3:
+		return m.FirstName
+	case 4:
+		return m.LastName
+	case 5:
+		return c.FieldsText()
+	}
+	return ""
+}
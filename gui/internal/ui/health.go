@@ -0,0 +1,123 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"github.com/mauzec/tdsoft/gui/internal/jobs"
+)
+
+// healthCheckTimeout limits a session check, starting a client may be slow.
+const healthCheckTimeout = 30 * time.Second
+
+// connectionStatus shows whether the session of the current account works.
+// It is checked every [client.Client.HealthCheckInterval] and when tapped,
+// a revoked session goes to the login screen. It is the part of mainScreen.
+//
+//	Services: *client.Client, *jobs.Manager, fyne.Window
+func connectionStatus(r *Router) fyne.CanvasObject {
+	var (
+		cl *client.Client
+		jm *jobs.Manager
+		w  fyne.Window
+	)
+	_ = r.GetServiceAs(&cl)
+	_ = r.GetServiceAs(&jm)
+	_ = r.GetServiceAs(&w)
+	ctx := r.ScreenContext()
+
+	status := widget.NewButton("Checking connection...", nil)
+	status.Importance = widget.LowImportance
+
+	checking := false
+	check := func() {
+		if checking {
+			return
+		}
+		checking = true
+		status.Disable()
+		go func() {
+			cctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			h, err := cl.CheckConnection(cctx)
+			cancel()
+			fyne.Do(func() {
+				checking = false
+				status.Enable()
+				if ctx.Err() != nil {
+					return
+				}
+				if errors.Is(err, apperrors.ErrSessionRevoked) {
+					r.ClearScreenAndShow(ScreenLogin)
+					dialog.ShowInformation("Session revoked",
+						"The session was logged out in another app, log in again.", w)
+					return
+				}
+				status.SetText(healthText(h, err))
+				status.Importance = healthImportance(h, err)
+				status.Refresh()
+			})
+		}()
+	}
+	status.OnTapped = check
+
+	go func() {
+		t := time.NewTicker(cl.HealthCheckInterval())
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			// a running job shows whether the session works,
+			// and a script can't use the session file meanwhile
+			if jobsRunning(jm) {
+				continue
+			}
+			fyne.Do(check)
+		}
+	}()
+	check()
+
+	return status
+}
+
+func jobsRunning(jm *jobs.Manager) bool {
+	if jm == nil {
+		return false
+	}
+	for _, j := range jm.Jobs() {
+		if !j.Status().Finished() {
+			return true
+		}
+	}
+	return false
+}
+
+// healthText returns e.g. "● @user, 120 ms".
+func healthText(h *client.Health, err error) string {
+	switch {
+	case errors.Is(err, apperrors.ErrConnectionFailed), errors.Is(err, context.DeadlineExceeded):
+		return "● Offline"
+	case err != nil:
+		return "● Check failed"
+	}
+	return fmt.Sprintf("● %s, %d ms", h.Name(), h.Latency.Milliseconds())
+}
+
+func healthImportance(h *client.Health, err error) widget.Importance {
+	if err != nil {
+		return widget.DangerImportance
+	}
+	if h.Latency > time.Second {
+		return widget.WarningImportance
+	}
+	return widget.SuccessImportance
+}
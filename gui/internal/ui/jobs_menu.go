@@ -0,0 +1,229 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	"github.com/mauzec/tdsoft/gui/internal/jobs"
+	"github.com/mauzec/tdsoft/gui/internal/output"
+	"go.uber.org/zap"
+)
+
+// jobsMenu lists past and running jobs and lets open, view, re-run, resume or cancel them.
+// It is the part of mainScreen.
+//
+//	Services: *client.Client, *jobs.Manager, fyne.App
+func jobsMenu(r *Router) fyne.CanvasObject {
+	var (
+		cl *client.Client
+		jm *jobs.Manager
+		a  fyne.App
+	)
+	_ = r.GetServiceAs(&cl)
+	_ = r.GetServiceAs(&jm)
+	_ = r.GetServiceAs(&a)
+
+	header := widget.NewLabelWithStyle("Jobs",
+		fyne.TextAlignCenter, fyne.TextStyle{Bold: true},
+	)
+
+	var (
+		list     []*jobs.Job
+		selected string
+	)
+
+	detailsLabel := widget.NewLabel("Select a job")
+	detailsLabel.Wrapping = fyne.TextWrapWord
+	eventsGrid := widget.NewTextGrid()
+	eventsScroll := container.NewVScroll(eventsGrid)
+	eventsScroll.SetMinSize(fyne.NewSize(0, 150))
+
+	openButton := widget.NewButton("Open output", nil)
+	viewButton := widget.NewButton("View", nil)
+	rerunButton := widget.NewButton("Re-run", nil)
+	resumeButton := widget.NewButton("Resume", nil)
+	cancelButton := widget.NewButton("Cancel", nil)
+	openButton.Disable()
+	viewButton.Disable()
+	rerunButton.Disable()
+	resumeButton.Disable()
+	cancelButton.Disable()
+
+	showDetails := func() {
+		j, ok := jm.Get(selected)
+		if !ok {
+			detailsLabel.SetText("Select a job")
+			eventsGrid.SetText("")
+			openButton.Disable()
+			viewButton.Disable()
+			rerunButton.Disable()
+			resumeButton.Disable()
+			cancelButton.Disable()
+			return
+		}
+		s := j.Snapshot()
+		detailsLabel.SetText(formatJobDetails(s))
+		eventsGrid.SetText(formatJobEvents(s.Events))
+
+		openButton.Enable()
+		// the viewer reads CSV only
+		if j.Request.OutputFormat() == output.FormatCSV || j.Request.OutputFormat() == "" {
+			viewButton.Enable()
+		} else {
+			viewButton.Disable()
+		}
+		rerunButton.Enable()
+		if s.Status.Finished() && s.Status != jobs.StatusDone && client.HasCheckpoint(s.Output) {
+			resumeButton.Enable()
+		} else {
+			resumeButton.Disable()
+		}
+		if s.Status.Finished() {
+			cancelButton.Disable()
+		} else {
+			cancelButton.Enable()
+		}
+	}
+
+	jobsList := widget.NewList(
+		func() int { return len(list) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			if id >= len(list) {
+				return
+			}
+			s := list[id].Snapshot()
+			o.(*widget.Label).SetText(fmt.Sprintf("%s  %s  [%s]", s.ID, s.Kind, s.Status))
+		},
+	)
+	jobsList.OnSelected = func(id widget.ListItemID) {
+		if id >= len(list) {
+			return
+		}
+		selected = list[id].ID
+		showDetails()
+	}
+
+	refresh := func() {
+		list = jm.Jobs()
+		jobsList.Refresh()
+		showDetails()
+	}
+
+	openButton.OnTapped = func() {
+		j, ok := jm.Get(selected)
+		if !ok {
+			return
+		}
+		abs, err := filepath.Abs(j.Request.OutputPath())
+		if err != nil {
+			cl.ExtLog.Warn("bad job output path", zap.Error(err))
+			return
+		}
+		if err := a.OpenURL(&url.URL{Scheme: "file", Path: abs}); err != nil {
+			cl.ExtLog.Warn("failed to open job output", zap.Error(err))
+		}
+	}
+	viewButton.OnTapped = func() {
+		j, ok := jm.Get(selected)
+		if !ok {
+			return
+		}
+		showResults(r, j.Request.OutputPath(), j.Request.Kind())
+	}
+	rerunButton.OnTapped = func() {
+		j, err := jm.Rerun(context.Background(), selected)
+		if err != nil {
+			cl.ExtLog.Warn("failed to re-run job", zap.String("id", selected), zap.Error(err))
+			return
+		}
+		selected = j.ID
+		refresh()
+	}
+	resumeButton.OnTapped = func() {
+		j, err := jm.Resume(context.Background(), selected)
+		if err != nil {
+			cl.ExtLog.Warn("failed to resume job", zap.String("id", selected), zap.Error(err))
+			return
+		}
+		selected = j.ID
+		refresh()
+	}
+	cancelButton.OnTapped = func() {
+		if err := jm.Cancel(selected); err != nil {
+			cl.ExtLog.Warn("failed to cancel job", zap.String("id", selected), zap.Error(err))
+		}
+	}
+
+	unsubscribe := jm.Subscribe(func(*jobs.Job) {
+		fyne.Do(refresh)
+	})
+	ctx := r.ScreenContext()
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+	}()
+
+	refresh()
+
+	actions := container.NewHBox(layout.NewSpacer(),
+		openButton, viewButton, rerunButton, resumeButton, cancelButton,
+	)
+	details := container.NewBorder(
+		container.NewVBox(detailsLabel, actions, widget.NewSeparator()),
+		nil, nil, nil,
+		eventsScroll,
+	)
+	split := container.NewHSplit(jobsList, details)
+	split.Offset = 0.4
+
+	return container.NewBorder(
+		container.NewVBox(header, widget.NewSeparator()), nil, nil, nil,
+		container.New(layout.NewGridWrapLayout(fyne.NewSize(780, 300)), split),
+	)
+}
+
+func formatJobDetails(s jobs.Snapshot) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ID: %s\nKind: %s\nStatus: %s\nAccount: %s\n", s.ID, s.Kind, s.Status, s.Account)
+	fmt.Fprintf(&b, "Queued: %s\n", formatJobTime(s.QueuedAt))
+	fmt.Fprintf(&b, "Started: %s\n", formatJobTime(s.StartedAt))
+	fmt.Fprintf(&b, "Ended: %s\n", formatJobTime(s.EndedAt))
+	if p := s.Progress; p.Phase != "" {
+		fmt.Fprintf(&b, "Progress: %s %d/%d\n", p.Phase, p.Current, p.Total)
+	}
+	fmt.Fprintf(&b, "Output: %s\n", s.Output)
+	if s.Err != nil {
+		fmt.Fprintf(&b, "Error: %s\n", s.Err)
+	}
+	if req, err := json.Marshal(s.Request); err == nil {
+		fmt.Fprintf(&b, "Request: %s", req)
+	}
+	return b.String()
+}
+
+func formatJobEvents(events []jobs.Event) string {
+	var b strings.Builder
+	for _, e := range events {
+		details, _ := json.Marshal(e.Msg.Details)
+		fmt.Fprintf(&b, "%s %-5s %s %s\n", e.Time.Format("15:04:05"), e.Level, e.Msg.Code, details)
+	}
+	return b.String()
+}
+
+func formatJobTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
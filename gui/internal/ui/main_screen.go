@@ -1,7 +1,10 @@
 package ui
 
 import (
+	"context"
 	"math"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -9,6 +12,8 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 	"github.com/mauzec/tdsoft/gui/internal/client"
+	"github.com/mauzec/tdsoft/gui/internal/jobs"
+	"github.com/mauzec/tdsoft/gui/internal/output"
 	"github.com/mauzec/tdsoft/gui/internal/preferences"
 	"github.com/mauzec/tdsoft/gui/internal/ui/custom"
 	"github.com/mauzec/tdsoft/gui/internal/utils"
@@ -19,15 +24,30 @@ const (
 	ScreenMain ScreenID = "main"
 )
 
-// chatStatsMenu gets chat statistics. It is the part of mainScreen
+// MenuID is a menu of mainScreen.
+type MenuID string
+
+const (
+	MenuMembers        MenuID = "members"
+	MenuChatStats      MenuID = "chat_stats"
+	MenuSearchMessages MenuID = "search_messages"
+	MenuDialogs        MenuID = "dialogs"
+	MenuJobs           MenuID = "jobs"
+	MenuMembersDiff    MenuID = "members_diff"
+)
+
+// chatStatsMenu gets chat statistics. It is the part of mainScreen.
+// chat, if not empty, is filled in instead of the last one.
 //
-//	Services: *client.Client, fyne.App
-func chatStatsMenu(r *Router) fyne.CanvasObject {
+//	Services: *client.Client, *jobs.Manager, fyne.App
+func chatStatsMenu(r *Router, chat string) fyne.CanvasObject {
 	var (
 		cl *client.Client
+		jm *jobs.Manager
 		a  fyne.App
 	)
 	_ = r.GetServiceAs(&cl)
+	_ = r.GetServiceAs(&jm)
 	_ = r.GetServiceAs(&a)
 	prefs := a.Preferences()
 
@@ -36,10 +56,15 @@ func chatStatsMenu(r *Router) fyne.CanvasObject {
 	)
 
 	chatNameLabel := widget.NewLabel("Channel or group")
+	accountSelect := newAccountSelect(cl)
+
 	chatNameEntry := widget.NewEntry()
 	chatNameEntry.SetPlaceHolder("@chat or t.me/username or id")
 	chatNameEntry.Validator = nil
 	chatNameEntry.SetText(prefs.String(preferences.KeyUIChatStatsMenuChat))
+	if chat != "" {
+		chatNameEntry.SetText(chat)
+	}
 
 	limitMessagesLabel := widget.NewLabel("Messages limit")
 	limitMessagesEntry := custom.NewNumericalEntry()
@@ -47,28 +72,37 @@ func chatStatsMenu(r *Router) fyne.CanvasObject {
 	limitMessagesEntry.Validator = nil
 	limitMessagesEntry.SetText(prefs.String(preferences.KeyUIChatStatsMenuLimit))
 
-	outputLabel := widget.NewLabel("Output CSV")
+	outputLabel := widget.NewLabel("Output")
 	outputEntry := widget.NewEntry()
 	outputEntry.SetPlaceHolder("e.g. stats.csv")
 	outputEntry.Validator = nil
 	outputEntry.SetText(prefs.String(preferences.KeyUIChatStatsMenuOutput))
+	formatSelect := newFormatSelect(prefs, preferences.KeyUIChatStatsMenuFormat, outputEntry)
 
 	parseButton := widget.NewButton("Parse", nil)
+	stopButton := widget.NewButton("Stop", nil)
+	stopButton.Disable()
+	progress := custom.NewProgressView()
 	parseButton.OnTapped = func() {
 		func() {
 			fyne.Do(func() {
+				accountSelect.Disable()
 				chatNameEntry.Disable()
 				limitMessagesEntry.Disable()
 				outputEntry.Disable()
+				formatSelect.Disable()
 				parseButton.Disable()
 			})
 		}()
 		enableAll := func() {
 			fyne.Do(func() {
+				accountSelect.Enable()
 				chatNameEntry.Enable()
 				limitMessagesEntry.Enable()
 				outputEntry.Enable()
+				formatSelect.Enable()
 				parseButton.Enable()
+				stopButton.Disable()
 			})
 		}
 
@@ -103,10 +137,11 @@ func chatStatsMenu(r *Router) fyne.CanvasObject {
 
 		if outputEntry.Text == "" {
 			outputEntry.SetText(
-				"chat-stats-" + time.Now().Format("20060102-150405") + ".csv",
+				"chat-stats-" + time.Now().Format("20060102-150405") + selectedFormat(formatSelect).Ext(),
 			)
 		}
 		req.Output = outputEntry.Text
+		req.Format = selectedFormat(formatSelect)
 
 		if err := req.Validate(); err != nil {
 			cl.ExtLog.Error("validating get chat stats request failed",
@@ -120,36 +155,57 @@ func chatStatsMenu(r *Router) fyne.CanvasObject {
 		prefs.SetString(preferences.KeyUIChatStatsMenuLimit, limitMessagesEntry.Text)
 		prefs.SetString(preferences.KeyUIChatStatsMenuOutput, outputEntry.Text)
 
-		errCh := make(chan error, 1)
+		progress.Start()
+		// the job outlives the screen, it is stopped by jm.Cancel or jm.CancelAll
+		job, err := jm.Submit(context.Background(), req,
+			client.WithAccount(accountSelect.Selected),
+			client.WithProgress(func(p client.Progress) {
+				fyne.Do(func() { progress.Set(p.Phase, p.Current, p.Total) })
+			}))
+		if err != nil {
+			cl.ExtLog.Error("failed to submit job", zap.Error(err))
+			progress.Hide()
+			enableAll()
+			return
+		}
+		stopButton.OnTapped = func() { _ = jm.Cancel(job.ID) }
+		stopButton.Enable()
+
 		go func() {
-			errCh <- cl.GetChatStats(req, false)
+			<-job.Done()
+			fyne.Do(func() { progress.Finish(jobResultText(job)) })
 			enableAll()
 		}()
 	}
 
 	form := container.New(layout.NewFormLayout(),
+		widget.NewLabel("Account"), accountSelect,
 		chatNameLabel, chatNameEntry,
 		limitMessagesLabel, limitMessagesEntry,
 		outputLabel, outputEntry,
+		widget.NewLabel("Format"), formatSelect,
 	)
 	actions := container.NewCenter(container.New(
 		layout.NewGridWrapLayout(func() fyne.Size {
 			sz := parseButton.MinSize()
 			return fyne.Size{Width: sz.Width + 25.0, Height: sz.Height}
-		}()), parseButton,
+		}()), parseButton, stopButton,
 	))
-	return container.NewVBox(header, widget.NewSeparator(), form, actions)
+	return container.NewVBox(header, widget.NewSeparator(), form, actions, progress.Container)
 }
 
 // membersMenu parses members. It is the part of mainScreen.
+// chat, if not empty, is filled in instead of the last one.
 //
-//	Services: *client.Client, fyne.App
-func membersMenu(r *Router) fyne.CanvasObject {
+//	Services: *client.Client, *jobs.Manager, fyne.App
+func membersMenu(r *Router, chat string) fyne.CanvasObject {
 	var (
 		cl *client.Client
+		jm *jobs.Manager
 		a  fyne.App
 	)
 	_ = r.GetServiceAs(&cl)
+	_ = r.GetServiceAs(&jm)
 	_ = r.GetServiceAs(&a)
 	prefs := a.Preferences()
 
@@ -159,10 +215,15 @@ func membersMenu(r *Router) fyne.CanvasObject {
 	)
 
 	chatNameLabel := widget.NewLabel("Channel or group")
+	accountSelect := newAccountSelect(cl)
+
 	chatNameEntry := widget.NewEntry()
 	chatNameEntry.SetPlaceHolder("@chat")
 	chatNameEntry.Validator = nil
 	chatNameEntry.SetText(prefs.String(preferences.KeyUIMembersMenuChat))
+	if chat != "" {
+		chatNameEntry.SetText(chat)
+	}
 
 	limitMembersLabel := widget.NewLabel("Members limit")
 	limitMembersEntry := custom.NewNumericalEntry()
@@ -170,11 +231,12 @@ func membersMenu(r *Router) fyne.CanvasObject {
 	limitMembersEntry.Validator = nil
 	limitMembersEntry.SetText(prefs.String(preferences.KeyUIMembersMenuLimit))
 
-	outputLabel := widget.NewLabel("Output CSV")
+	outputLabel := widget.NewLabel("Output")
 	outputEntry := widget.NewEntry()
 	outputEntry.SetPlaceHolder("Optional")
 	outputEntry.Validator = nil
 	outputEntry.SetText(prefs.String(preferences.KeyUIMembersMenuOutput))
+	formatSelect := newFormatSelect(prefs, preferences.KeyUIMembersMenuFormat, outputEntry)
 
 	limitMessagesEntry := custom.NewNumericalEntry()
 	limitMessagesEntry.Disable()
@@ -203,13 +265,18 @@ func membersMenu(r *Router) fyne.CanvasObject {
 	addInfoCheck.SetChecked(prefs.Bool(preferences.KeyUIMembersMenuAddInfo))
 
 	parseButton := widget.NewButton("Parse", nil)
+	stopButton := widget.NewButton("Stop", nil)
+	stopButton.Disable()
+	progress := custom.NewProgressView()
 
 	parseButton.OnTapped = func() {
 		func() {
 			fyne.Do(func() {
+				accountSelect.Disable()
 				chatNameEntry.Disable()
 				limitMembersEntry.Disable()
 				outputEntry.Disable()
+				formatSelect.Disable()
 				parseFromMessagesCheck.Disable()
 				limitMessagesEntry.Disable()
 				parseBioCheck.Disable()
@@ -219,9 +286,11 @@ func membersMenu(r *Router) fyne.CanvasObject {
 		}()
 		enableAll := func() {
 			fyne.Do(func() {
+				accountSelect.Enable()
 				chatNameEntry.Enable()
 				limitMembersEntry.Enable()
 				outputEntry.Enable()
+				formatSelect.Enable()
 				parseFromMessagesCheck.Enable()
 				if parseFromMessagesCheck.Checked {
 					limitMessagesEntry.Enable()
@@ -229,6 +298,7 @@ func membersMenu(r *Router) fyne.CanvasObject {
 				parseBioCheck.Enable()
 				addInfoCheck.Enable()
 				parseButton.Enable()
+				stopButton.Disable()
 			})
 		}
 
@@ -263,10 +333,11 @@ func membersMenu(r *Router) fyne.CanvasObject {
 
 		if outputEntry.Text == "" {
 			outputEntry.SetText(
-				"chat-members-" + time.Now().Format("20060102-150405") + ".csv",
+				"chat-members-" + time.Now().Format("20060102-150405") + selectedFormat(formatSelect).Ext(),
 			)
 		}
 		req.Output = outputEntry.Text
+		req.Format = selectedFormat(formatSelect)
 
 		if parseFromMessagesCheck.Checked {
 			var msgLimit int
@@ -306,17 +377,34 @@ func membersMenu(r *Router) fyne.CanvasObject {
 		prefs.SetBool(preferences.KeyUIMembersMenuParseBio, parseBioCheck.Checked)
 		prefs.SetBool(preferences.KeyUIMembersMenuAddInfo, addInfoCheck.Checked)
 
-		errCh := make(chan error, 1)
+		progress.Start()
+		job, err := jm.Submit(context.Background(), req,
+			client.WithAccount(accountSelect.Selected),
+			client.WithProgress(func(p client.Progress) {
+				fyne.Do(func() { progress.Set(p.Phase, p.Current, p.Total) })
+			}))
+		if err != nil {
+			cl.ExtLog.Error("failed to submit job", zap.Error(err))
+			progress.Hide()
+			enableAll()
+			return
+		}
+		stopButton.OnTapped = func() { _ = jm.Cancel(job.ID) }
+		stopButton.Enable()
+
 		go func() {
-			errCh <- cl.GetMembers(req, false)
+			<-job.Done()
+			fyne.Do(func() { progress.Finish(jobResultText(job)) })
 			enableAll()
 		}()
 	}
 
 	form := container.New(layout.NewFormLayout(),
+		widget.NewLabel("Account"), accountSelect,
 		chatNameLabel, chatNameEntry,
 		limitMembersLabel, limitMembersEntry,
 		outputLabel, outputEntry,
+		widget.NewLabel("Format"), formatSelect,
 	)
 
 	msgRow := container.New(layout.NewFormLayout(),
@@ -327,7 +415,7 @@ func membersMenu(r *Router) fyne.CanvasObject {
 		layout.NewGridWrapLayout(func() fyne.Size {
 			sz := parseButton.MinSize()
 			return fyne.Size{Width: sz.Width + 25.0, Height: sz.Height}
-		}()), parseButton,
+		}()), parseButton, stopButton,
 	))
 
 	return container.NewVBox(
@@ -337,18 +425,25 @@ func membersMenu(r *Router) fyne.CanvasObject {
 		msgRow,
 		options,
 		actions,
+		progress.Container,
 	)
 }
 
+// searchDateLayout is MM/DD/YYYY, the format of dates of scripts/search_messages.py.
+const searchDateLayout = "01/02/2006"
+
 // searchMessagesMenu search messages from username in given chat. It is the part of mainScreen.
+// chat, if not empty, is filled in instead of the last one.
 //
-//	Services: *client.Client, fyne.App
-func searchMessagesMenu(r *Router) fyne.CanvasObject {
+//	Services: *client.Client, *jobs.Manager, fyne.App
+func searchMessagesMenu(r *Router, chat string) fyne.CanvasObject {
 	var (
 		cl *client.Client
+		jm *jobs.Manager
 		a  fyne.App
 	)
 	_ = r.GetServiceAs(&cl)
+	_ = r.GetServiceAs(&jm)
 	_ = r.GetServiceAs(&a)
 	prefs := a.Preferences()
 
@@ -356,10 +451,15 @@ func searchMessagesMenu(r *Router) fyne.CanvasObject {
 		fyne.TextAlignCenter, fyne.TextStyle{Bold: true},
 	)
 
+	accountSelect := newAccountSelect(cl)
+
 	chatNameEntry := widget.NewEntry()
 	chatNameEntry.SetPlaceHolder("@chat or t.me/username or id")
 	chatNameEntry.Validator = nil
 	chatNameEntry.SetText(prefs.String(preferences.KeyUIMsgSearcherMenuChat))
+	if chat != "" {
+		chatNameEntry.SetText(chat)
+	}
 
 	usernameEntry := widget.NewEntry()
 	usernameEntry.SetPlaceHolder("@username")
@@ -370,25 +470,28 @@ func searchMessagesMenu(r *Router) fyne.CanvasObject {
 	outputEntry.SetPlaceHolder("Optional")
 	outputEntry.Validator = nil
 	outputEntry.SetText(prefs.String(preferences.KeyUIMsgSearcherMenuOutput))
+	formatSelect := newFormatSelect(prefs, preferences.KeyUIMsgSearcherMenuFormat, outputEntry)
 
 	form := container.New(layout.NewFormLayout(),
+		widget.NewLabel("Account"), accountSelect,
 		widget.NewLabel("Channel or group"), chatNameEntry,
 		widget.NewLabel("Username"), usernameEntry,
-		widget.NewLabel("Output CSV"), outputEntry,
+		widget.NewLabel("Output"), outputEntry,
+		widget.NewLabel("Format"), formatSelect,
 	)
 	t := time.Now()
 	fromDateEntry, toDateEntry := widget.NewDateEntry(), widget.NewDateEntry()
 	if fd, err := time.Parse(
+		searchDateLayout,
 		prefs.String(preferences.KeyUIMsgSearcherMenuFromDate),
-		"01/02/2006",
 	); err == nil {
 		fromDateEntry.SetDate(&fd)
 	} else {
 		fromDateEntry.SetDate(&t)
 	}
 	if fd, err := time.Parse(
+		searchDateLayout,
 		prefs.String(preferences.KeyUIMsgSearcherMenuToDate),
-		"01/02/2006",
 	); err == nil {
 		toDateEntry.SetDate(&fd)
 	} else {
@@ -422,19 +525,24 @@ func searchMessagesMenu(r *Router) fyne.CanvasObject {
 	)
 
 	searchButton := widget.NewButton("Search", nil)
+	stopButton := widget.NewButton("Stop", nil)
+	stopButton.Disable()
+	progress := custom.NewProgressView()
 	actions := container.NewCenter(container.New(
 		layout.NewGridWrapLayout(func() fyne.Size {
 			sz := searchButton.MinSize()
 			return fyne.Size{Width: sz.Width + 27.0, Height: sz.Height}
-		}()), searchButton,
+		}()), searchButton, stopButton,
 	))
 
 	searchButton.OnTapped = func() {
 		func() {
 			fyne.Do(func() {
+				accountSelect.Disable()
 				chatNameEntry.Disable()
 				usernameEntry.Disable()
 				outputEntry.Disable()
+				formatSelect.Disable()
 				fromDateEntry.Disable()
 				toDateEntry.Disable()
 				searchButton.Disable()
@@ -442,12 +550,15 @@ func searchMessagesMenu(r *Router) fyne.CanvasObject {
 		}()
 		enableAll := func() {
 			fyne.Do(func() {
+				accountSelect.Enable()
 				chatNameEntry.Enable()
 				usernameEntry.Enable()
 				outputEntry.Enable()
+				formatSelect.Enable()
 				fromDateEntry.Enable()
 				toDateEntry.Enable()
 				searchButton.Enable()
+				stopButton.Disable()
 			})
 		}
 
@@ -473,10 +584,11 @@ func searchMessagesMenu(r *Router) fyne.CanvasObject {
 
 		if outputEntry.Text == "" {
 			outputEntry.SetText(
-				"chat-members-" + time.Now().Format("20060102-150405") + ".csv",
+				"search-messages-" + time.Now().Format("20060102-150405") + selectedFormat(formatSelect).Ext(),
 			)
 		}
 		req.Output = outputEntry.Text
+		req.Format = selectedFormat(formatSelect)
 
 		if !utils.ValidateTime(fromDateEntry.Date) {
 			cl.ExtLog.Warn("bad from date",
@@ -491,8 +603,8 @@ func searchMessagesMenu(r *Router) fyne.CanvasObject {
 			return
 		}
 
-		req.FromDate = fromDateEntry.Date.Format("2006/01/02")
-		req.ToDate = toDateEntry.Date.Format("2006/01/02")
+		req.FromDate = fromDateEntry.Date.Format(searchDateLayout)
+		req.ToDate = toDateEntry.Date.Format(searchDateLayout)
 
 		if err := req.Validate(); err != nil {
 			cl.ExtLog.Error("validating search messages request failed",
@@ -508,9 +620,24 @@ func searchMessagesMenu(r *Router) fyne.CanvasObject {
 		prefs.SetString(preferences.KeyUIMsgSearcherMenuFromDate, req.FromDate)
 		prefs.SetString(preferences.KeyUIMsgSearcherMenuToDate, req.ToDate)
 
-		errCh := make(chan error, 1)
+		progress.Start()
+		job, err := jm.Submit(context.Background(), req,
+			client.WithAccount(accountSelect.Selected),
+			client.WithProgress(func(p client.Progress) {
+				fyne.Do(func() { progress.Set(p.Phase, p.Current, p.Total) })
+			}))
+		if err != nil {
+			cl.ExtLog.Error("failed to submit job", zap.Error(err))
+			progress.Hide()
+			enableAll()
+			return
+		}
+		stopButton.OnTapped = func() { _ = jm.Cancel(job.ID) }
+		stopButton.Enable()
+
 		go func() {
-			errCh <- cl.SearchMessages(req, false)
+			<-job.Done()
+			fyne.Do(func() { progress.Finish(jobResultText(job)) })
 			enableAll()
 		}()
 	}
@@ -521,29 +648,62 @@ func searchMessagesMenu(r *Router) fyne.CanvasObject {
 		form,
 		dateRow,
 		actions,
+		progress.Container,
 	)
 }
 
-// TODO:
-func printDialogsMenu(r *Router) fyne.CanvasObject {
-	printButton := widget.NewButton("Print dialogs", nil)
-	printButton.OnTapped = func() {
+// newFormatSelect selects the output format of a menu, saved to prefs with key.
+// The extension of the output in outputEntry follows the selected format.
+func newFormatSelect(prefs fyne.Preferences, key string, outputEntry *widget.Entry) *widget.Select {
+	names := make([]string, len(output.Formats))
+	for i, f := range output.Formats {
+		names[i] = string(f)
+	}
+	sel := widget.NewSelect(names, nil)
+	format, err := output.ParseFormat(prefs.String(key))
+	if err != nil {
+		format = output.FormatCSV
+	}
+	sel.SetSelected(string(format))
+	sel.OnChanged = func(s string) {
+		prefs.SetString(key, s)
+		format := selectedFormat(sel)
+		ext := filepath.Ext(outputEntry.Text)
+		for _, f := range output.Formats {
+			if ext != "" && ext == f.Ext() {
+				outputEntry.SetText(strings.TrimSuffix(outputEntry.Text, ext) + format.Ext())
+				return
+			}
+		}
+	}
+	return sel
+}
 
+func selectedFormat(sel *widget.Select) output.Format {
+	f, err := output.ParseFormat(sel.Selected)
+	if err != nil {
+		return output.FormatCSV
 	}
-	return container.NewVBox()
+	return f
 }
 
-// TODO:
-func loadingScreen() fyne.CanvasObject {
-	return container.NewVBox(
-		widget.NewLabel("Loading..."),
-		widget.NewProgressBarInfinite(),
-	)
+// jobResultText returns a short text about how the finished job ended.
+func jobResultText(j *jobs.Job) string {
+	switch j.Status() {
+	case jobs.StatusDone:
+		return "Done"
+	case jobs.StatusCancelled:
+		return "Stopped"
+	default:
+		return "Failed"
+	}
 }
 
 // mainScreen is the main application screen, that shows after login.
+// The session is checked periodically, a revoked one goes to the login screen.
 //
-//	Services: *client.Client, fyne.Window, fyne.App(not used here, but need)
+//	Services: *client.Client, *jobs.Manager, fyne.Window, fyne.App(not used here, but need),
+//	*store.Store (optional)
 func mainScreen(r *Router) fyne.CanvasObject {
 	var w fyne.Window
 	_ = r.GetServiceAs(&w)
@@ -558,6 +718,35 @@ func mainScreen(r *Router) fyne.CanvasObject {
 		content.Refresh()
 	}
 
+	// jobs view is built once, it keeps a subscription to the manager
+	var jobsView fyne.CanvasObject
+	// the dialogs are kept while the screen is shown
+	var dialogsView fyne.CanvasObject
+
+	var showMenu func(menu MenuID, chat string)
+	showMenu = func(menu MenuID, chat string) {
+		switch menu {
+		case MenuMembers:
+			setContent(membersMenu(r, chat))
+		case MenuChatStats:
+			setContent(chatStatsMenu(r, chat))
+		case MenuSearchMessages:
+			setContent(searchMessagesMenu(r, chat))
+		case MenuDialogs:
+			if dialogsView == nil {
+				dialogsView = dialogsMenu(r, showMenu)
+			}
+			setContent(dialogsView)
+		case MenuMembersDiff:
+			setContent(membersDiffMenu(r))
+		case MenuJobs:
+			if jobsView == nil {
+				jobsView = jobsMenu(r)
+			}
+			setContent(jobsView)
+		}
+	}
+
 	logGrid := custom.NewLogGrid(widget.TextGridStyleDefault)
 	cl.SetUserLogger(logGrid.Pushback)
 	// logGrid.Scroll.Hide()
@@ -566,27 +755,35 @@ func mainScreen(r *Router) fyne.CanvasObject {
 		layout.NewSpacer(),
 
 		widget.NewButton("Members", func() {
-			setContent(membersMenu(r))
+			showMenu(MenuMembers, "")
 			// logGrid.Scroll.Show()
 		}),
 		widget.NewButton("Chat Stats", func() {
-			setContent(chatStatsMenu(r))
+			showMenu(MenuChatStats, "")
 			// logGrid.Scroll.Show()
 		}),
 		widget.NewButton("Search Messages", func() {
-			setContent(searchMessagesMenu(r))
+			showMenu(MenuSearchMessages, "")
 			// logGrid.Scroll.Show()
 		}),
-		widget.NewButton("TODO", func() {
-			setContent(widget.NewLabel("todo"))
-			// logGrid.Scroll.Show()
+		widget.NewButton("Dialogs", func() {
+			showMenu(MenuDialogs, "")
+		}),
+		widget.NewButton("Members Diff", func() {
+			showMenu(MenuMembersDiff, "")
+		}),
+		widget.NewButton("Jobs", func() {
+			showMenu(MenuJobs, "")
+		}),
+		widget.NewButton("Results", func() {
+			openResults(r)
 		}),
 
 		layout.NewSpacer(),
+		connectionStatus(r),
+		accountBar(r),
 	)
 
-	cl.CheckConnection()
-
 	return container.NewBorder(
 		menu, nil, nil, nil,
 		container.NewBorder(
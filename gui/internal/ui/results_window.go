@@ -0,0 +1,318 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	"github.com/mauzec/tdsoft/gui/internal/results"
+	"go.uber.org/zap"
+)
+
+// resultsPageSize is the number of rows shown at once by the results viewer.
+const resultsPageSize = 100
+
+// resultsColumnWidth is the initial width of a column of the results table.
+const resultsColumnWidth = 150
+
+// openResults asks for a CSV file and shows it in the results viewer.
+//
+//	Services: *client.Client, fyne.App, fyne.Window
+func openResults(r *Router) {
+	var w fyne.Window
+	_ = r.GetServiceAs(&w)
+	d := dialog.NewFileOpen(func(rc fyne.URIReadCloser, err error) {
+		if err != nil || rc == nil {
+			return
+		}
+		path := rc.URI().Path()
+		_ = rc.Close()
+		showResults(r, path, "")
+	}, w)
+	d.SetFilter(storage.NewExtensionFileFilter([]string{".csv"}))
+	d.Show()
+}
+
+// showResults opens a window with the output of a job at path: the rows
+// are shown by pages, can be sorted by a column, filtered by the texts of
+// the columns, copied and exported. An empty kind is detected by the header.
+// The window doesn't depend on the current screen, jobs keep running.
+//
+//	Services: *client.Client, fyne.App
+func showResults(r *Router, path, kind string) {
+	var (
+		cl *client.Client
+		a  fyne.App
+	)
+	_ = r.GetServiceAs(&cl)
+	_ = r.GetServiceAs(&a)
+
+	w := a.NewWindow("Results - " + filepath.Base(path))
+	w.Resize(fyne.NewSize(900, 600))
+
+	var (
+		rf       *results.File
+		query    = results.Query{Filters: map[int]string{}, SortColumn: -1}
+		selected []int
+		page     int
+		rows     [][]string
+		cell     = widget.TableCellID{Row: -1, Col: -1}
+	)
+
+	infoLabel := widget.NewLabel("Loading " + path + "...")
+	infoLabel.Truncation = fyne.TextTruncateEllipsis
+	statusLabel := widget.NewLabel("")
+	pageLabel := widget.NewLabel("")
+	prevButton := widget.NewButton("<", nil)
+	nextButton := widget.NewButton(">", nil)
+	copyCellButton := widget.NewButton("Copy cell", nil)
+	copyRowButton := widget.NewButton("Copy row", nil)
+	exportButton := widget.NewButton("Export...", nil)
+	for _, b := range []*widget.Button{prevButton, nextButton, copyCellButton, copyRowButton, exportButton} {
+		b.Disable()
+	}
+
+	table := widget.NewTable(
+		func() (int, int) {
+			if rf == nil {
+				return 0, 0
+			}
+			return len(rows), len(rf.Columns)
+		},
+		func() fyne.CanvasObject {
+			l := widget.NewLabel("")
+			l.Truncation = fyne.TextTruncateEllipsis
+			return l
+		},
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			if id.Row >= len(rows) || id.Col >= len(rows[id.Row]) {
+				o.(*widget.Label).SetText("")
+				return
+			}
+			o.(*widget.Label).SetText(rows[id.Row][id.Col])
+		},
+	)
+
+	showPage := func() {
+		pages := max(1, (len(selected)+resultsPageSize-1)/resultsPageSize)
+		page = min(page, pages-1)
+		from := page * resultsPageSize
+		var err error
+		rows, err = rf.Rows(selected[from:min(from+resultsPageSize, len(selected))])
+		if err != nil {
+			cl.ExtLog.Error("failed to read results", zap.String("path", path), zap.Error(err))
+			statusLabel.SetText("Failed to read the file")
+		}
+		pageLabel.SetText(fmt.Sprintf("Page %d of %d", page+1, pages))
+		prevButton.Disable()
+		nextButton.Disable()
+		if page > 0 {
+			prevButton.Enable()
+		}
+		if page < pages-1 {
+			nextButton.Enable()
+		}
+		if len(selected) > 0 {
+			exportButton.Enable()
+		} else {
+			exportButton.Disable()
+		}
+		cell = widget.TableCellID{Row: -1, Col: -1}
+		table.UnselectAll()
+		copyCellButton.Disable()
+		copyRowButton.Disable()
+		table.Refresh()
+		table.ScrollToTop()
+	}
+
+	// apply selects the rows by the query off the UI goroutine, it reads
+	// the whole file. A query changed meanwhile is applied after it.
+	var (
+		applying bool
+		pending  bool
+		apply    func()
+	)
+	apply = func() {
+		if rf == nil {
+			return
+		}
+		if applying {
+			pending = true
+			return
+		}
+		applying = true
+		statusLabel.SetText("Filtering...")
+		q := results.Query{Filters: map[int]string{}, SortColumn: query.SortColumn, Desc: query.Desc}
+		for col, text := range query.Filters {
+			q.Filters[col] = text
+		}
+		go func() {
+			sel, err := rf.Select(q)
+			fyne.Do(func() {
+				applying = false
+				if pending {
+					pending = false
+					apply()
+					return
+				}
+				if err != nil {
+					cl.ExtLog.Error("failed to filter results", zap.String("path", path), zap.Error(err))
+					statusLabel.SetText("Failed to read the file")
+					return
+				}
+				selected, page = sel, 0
+				statusLabel.SetText(fmt.Sprintf("%d of %d rows", len(selected), rf.Len()))
+				showPage()
+			})
+		}()
+	}
+
+	table.ShowHeaderRow = true
+	table.CreateHeader = func() fyne.CanvasObject {
+		sortButton := widget.NewButton("", nil)
+		sortButton.Importance = widget.LowImportance
+		filterEntry := widget.NewEntry()
+		filterEntry.SetPlaceHolder("Filter")
+		return container.NewVBox(sortButton, filterEntry)
+	}
+	table.UpdateHeader = func(id widget.TableCellID, o fyne.CanvasObject) {
+		if rf == nil || id.Col < 0 || id.Col >= len(rf.Columns) {
+			return
+		}
+		box := o.(*fyne.Container)
+		sortButton := box.Objects[0].(*widget.Button)
+		filterEntry := box.Objects[1].(*widget.Entry)
+
+		text := rf.Columns[id.Col].Title
+		if id.Col == query.SortColumn {
+			if query.Desc {
+				text += " ▼"
+			} else {
+				text += " ▲"
+			}
+		}
+		sortButton.SetText(text)
+		sortButton.OnTapped = func() {
+			if query.SortColumn == id.Col {
+				query.Desc = !query.Desc
+			} else {
+				query.SortColumn, query.Desc = id.Col, false
+			}
+			apply()
+		}
+
+		// the header is reused for other columns, the entry shows the filter of id
+		filterEntry.OnSubmitted = nil
+		if filterEntry.Text != query.Filters[id.Col] {
+			filterEntry.SetText(query.Filters[id.Col])
+		}
+		filterEntry.OnSubmitted = func(s string) {
+			query.Filters[id.Col] = s
+			apply()
+		}
+	}
+	table.OnSelected = func(id widget.TableCellID) {
+		cell = id
+		copyCellButton.Enable()
+		copyRowButton.Enable()
+	}
+
+	prevButton.OnTapped = func() {
+		page--
+		showPage()
+	}
+	nextButton.OnTapped = func() {
+		page++
+		showPage()
+	}
+	copyCellButton.OnTapped = func() {
+		if cell.Row < 0 || cell.Row >= len(rows) || cell.Col >= len(rows[cell.Row]) {
+			return
+		}
+		a.Clipboard().SetContent(rows[cell.Row][cell.Col])
+	}
+	copyRowButton.OnTapped = func() {
+		if cell.Row < 0 || cell.Row >= len(rows) {
+			return
+		}
+		// tab separated, it is pasted into cells of a spreadsheet
+		a.Clipboard().SetContent(strings.Join(rows[cell.Row], "\t"))
+	}
+	exportButton.OnTapped = func() {
+		d := dialog.NewFileSave(func(wc fyne.URIWriteCloser, err error) {
+			if err != nil || wc == nil {
+				return
+			}
+			out := wc.URI().Path()
+			_ = wc.Close()
+			indexes := selected
+			go func() {
+				err := rf.Export(out, indexes)
+				fyne.Do(func() {
+					if err != nil {
+						cl.ExtLog.Error("failed to export results", zap.String("path", out), zap.Error(err))
+						dialog.ShowError(err, w)
+						return
+					}
+					statusLabel.SetText(fmt.Sprintf("%d rows exported to %s", len(indexes), out))
+				})
+			}()
+		}, w)
+		d.SetFileName(strings.TrimSuffix(filepath.Base(path), ".csv") + "-filtered.csv")
+		d.Show()
+	}
+
+	closed := false
+	w.SetOnClosed(func() {
+		closed = true
+		if rf != nil {
+			_ = rf.Close()
+		}
+	})
+
+	bar := container.NewHBox(
+		prevButton, pageLabel, nextButton,
+		layout.NewSpacer(),
+		statusLabel,
+		layout.NewSpacer(),
+		copyCellButton, copyRowButton, exportButton,
+	)
+	w.SetContent(container.NewBorder(
+		container.NewVBox(infoLabel, widget.NewSeparator()), bar, nil, nil,
+		table,
+	))
+	w.Show()
+
+	// indexing reads the whole file once
+	go func() {
+		f, err := results.Open(path, kind)
+		fyne.Do(func() {
+			if err == nil && closed {
+				_ = f.Close()
+				return
+			}
+			if err != nil {
+				cl.ExtLog.Error("failed to open results", zap.String("path", path), zap.Error(err))
+				infoLabel.SetText("Failed to open " + path + ": " + err.Error())
+				return
+			}
+			rf = f
+			kindText := rf.Kind
+			if kindText == "" {
+				kindText = "unknown output"
+			}
+			infoLabel.SetText(fmt.Sprintf("%s (%s)", path, kindText))
+			for i := range rf.Columns {
+				table.SetColumnWidth(i, resultsColumnWidth)
+			}
+			apply()
+		})
+	}()
+}
@@ -126,6 +126,17 @@ func (r *Router) ParamAs(id ScreenID, targetPtr any) (ret bool) {
 	return true
 }
 
+// TakeParamAs is [Router.ParamAs], the param is removed if it is assigned.
+func (r *Router) TakeParamAs(id ScreenID, targetPtr any) bool {
+	if !r.ParamAs(id, targetPtr) {
+		return false
+	}
+	r.mu.Lock()
+	delete(r.params, id)
+	r.mu.Unlock()
+	return true
+}
+
 // PutService regiesters a dependency (service) by its statis type
 func (r *Router) PutService(v any) {
 	if v == nil {
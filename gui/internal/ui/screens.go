@@ -2,13 +2,19 @@ package ui
 
 import (
 	"errors"
+	"fmt"
+	"image"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/widget"
+	"github.com/mauzec/tdsoft/gui/internal/auth"
 	"github.com/mauzec/tdsoft/gui/internal/client"
-	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"github.com/mauzec/tdsoft/gui/internal/creator"
+	"github.com/skip2/go-qrcode"
 	"go.uber.org/zap"
 )
 
@@ -20,30 +26,64 @@ const (
 
 // RegisterDefaultScreens registers the default screens.
 func RegisterDefaultScreens(r *Router) {
+	r.Register(ScreenUnlock, unlockScreen)
 	r.Register(ScreenLogin, loginScreen)
 	r.Register(ScreenMain, mainScreen)
 
 	r.Register(ScreenTODO, TODOScreen)
 }
 
-// loginScreen is the screen for logging in.
+// loginScreen is the screen for logging in the current account.
 //
 //	Services: *client.Client
 func loginScreen(r *Router) fyne.CanvasObject {
 	var cl *client.Client
 	_ = r.GetServiceAs(&cl)
-	// ctx := r.ScreenContext()
+	ctx := r.ScreenContext()
+
+	// another account may be chosen instead, the screen is rebuilt
+	// so the creator server targets it
+	accountSelect := newAccountSelect(cl)
+	accountSelect.OnChanged = func(name string) {
+		if name == cl.CurrentAccount().Name {
+			return
+		}
+		_ = cl.StopCreatorServer()
+		if err := cl.SwitchAccount(name); err == nil {
+			r.ClearScreenAndShow(ScreenMain)
+			return
+		}
+		r.ClearScreenAndShow(ScreenLogin)
+	}
+
+	// the state of the login server, it is restarted if it dies
+	serverLabel := widget.NewLabel("")
+	showServerState := func(state client.CreatorState) {
+		serverLabel.SetText("Login server: " + state.String())
+	}
+	unwatch := cl.WatchCreatorState(func(state client.CreatorState) {
+		fyne.Do(func() { showServerState(state) })
+	})
+	go func() {
+		<-ctx.Done()
+		unwatch()
+	}()
 
 	err := cl.StartCreatorServer()
 	if err != nil {
 		cl.ExtLog.Error("creator server start failed", zap.Error(err))
 	}
+	showServerState(cl.CreatorState())
 
-	apiIDEntry, apiHashEntry := widget.NewEntry(), widget.NewEntry()
+	flow := auth.NewFlow(auth.NewClientBackend(cl))
 
+	apiIDEntry, apiHashEntry := widget.NewEntry(), widget.NewEntry()
 	phoneEntry, codeEntry := widget.NewEntry(), widget.NewEntry()
 	phoneEntry.SetPlaceHolder("+12345678987")
 	codeEntry.SetPlaceHolder("123456")
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("password")
+
 	phoneRow := container.NewBorder(nil, nil,
 		widget.NewLabel("Phone:"), nil,
 		phoneEntry,
@@ -52,145 +92,175 @@ func loginScreen(r *Router) fyne.CanvasObject {
 		widget.NewLabel("Code:"), nil,
 		codeEntry,
 	)
-	phoneEntry.Disable()
-	phoneRow.Hide()
-	codeEntry.Disable()
-	codeRow.Hide()
-
-	passwordEntry := widget.NewEntry()
-	passwordEntry.SetPlaceHolder("password")
 	passwordRow := container.NewBorder(nil, nil,
 		widget.NewLabel("Password:"), nil,
 		passwordEntry,
 	)
-	passwordEntry.Disable()
-	passwordEntry.Password = true
-	passwordRow.Hide()
-
-	authStep := 0
-
-	backButton := widget.NewButton("Back", func() {})
-	nextButton := widget.NewButton("Next", func() {})
-
-	nextButton.OnTapped = func() {
-		switch authStep {
-		case 0:
-			if apiIDEntry.Text == "" || apiHashEntry.Text == "" {
-				return
-			}
-			apiIDEntry.Text = strings.TrimSpace(apiIDEntry.Text)
-			apiHashEntry.Text = strings.TrimSpace(apiHashEntry.Text)
-			cl.APIID = apiIDEntry.Text
-			cl.APIHash = apiHashEntry.Text
-
-			err := cl.SendAPIData()
-			if err != nil {
-				cl.ExtLog.Error("failed to send api data", zap.Error(err))
-				return
-			}
-
-			apiIDEntry.Disable()
-			apiHashEntry.Disable()
-
-			phoneEntry.Enable()
-			phoneRow.Show()
-
-			backButton.Enable()
-
-			authStep = 1
-
-		case 1:
-
-			if phoneEntry.Text == "" {
-				return
-			}
-
-			err := cl.SendPhone(phoneEntry.Text)
-			if err != nil {
-				cl.ExtLog.Error("failed to send phone", zap.Error(err))
-				return
-			}
-
-			phoneEntry.Disable()
-
-			codeEntry.Enable()
-			codeRow.Show()
-			authStep = 2
-
-		case 2:
-			if codeEntry.Text == "" {
-				return
-			}
-
-			codeEntry.Disable()
-
-			err := cl.SignIn(phoneEntry.Text, codeEntry.Text)
-			if err != nil {
-				if !errors.Is(err, apperrors.ErrPasswordNeeded) {
-					cl.ExtLog.Error("failed to sign in", zap.Error(err))
-					return
-				}
-
-				passwordEntry.Enable()
-				passwordRow.Show()
-				authStep = 3
-				return
-			}
+	codeInfo := widget.NewLabel("")
+	// the login token, it is replaced when it expires
+	qrImage := canvas.NewImageFromImage(nil)
+	qrImage.FillMode = canvas.ImageFillContain
+	qrImage.SetMinSize(fyne.NewSquareSize(256))
+	qrInfo := widget.NewLabel("")
+	qrInfo.Alignment = fyne.TextAlignCenter
+	qrToken := ""
+	hintLabel := widget.NewLabel("")
+	errorLabel := widget.NewLabel("")
+	errorLabel.Importance = widget.DangerImportance
+	errorLabel.Wrapping = fyne.TextWrapWord
+
+	backButton := widget.NewButton("Back", nil)
+	resendButton := widget.NewButton("Resend code", nil)
+	qrButton := widget.NewButton("Log in with QR code", nil)
+	nextButton := widget.NewButton("Next", nil)
+
+	busy := false
+
+	// render shows the widgets of the flow state
+	render := func() {
+		state := flow.State()
+		setEnabled(apiIDEntry, state == auth.StateAPIData)
+		setEnabled(apiHashEntry, state == auth.StateAPIData)
+		setEnabled(phoneEntry, state == auth.StatePhone)
+		setEnabled(codeEntry, state == auth.StateCode)
+		setEnabled(passwordEntry, state == auth.StatePassword)
+		setVisible(phoneRow, state >= auth.StatePhone && state != auth.StateQR)
+		setVisible(codeRow, state == auth.StateCode)
+		setVisible(codeInfo, state == auth.StateCode)
+		setVisible(passwordRow, state == auth.StatePassword)
+		setVisible(resendButton, state == auth.StateCode)
+		setVisible(qrButton, state == auth.StatePhone)
+		setVisible(qrImage, state == auth.StateQR)
+		setVisible(qrInfo, state == auth.StateQR)
+
+		qr := flow.QRToken()
+		if qr != nil && qr.Token != qrToken {
+			qrToken = qr.Token
+			qrImage.Image = qrCodeImage(qr.URL())
+			qrImage.Refresh()
+		}
+		qrInfo.SetText(qrInfoText(qr, time.Now()))
 
-			if err := cl.SaveAPIConfig(); err != nil {
-				cl.ExtLog.Error("failed to save api config; deleting session; need restart")
+		hint := flow.PasswordHint()
+		hintLabel.SetText("Hint: " + hint)
+		setVisible(hintLabel, state == auth.StatePassword && hint != "")
 
-				_ = cl.DeleteSession()
+		wait := flow.ResendIn()
+		codeInfo.SetText(codeInfoText(flow.SentCode(), flow.CodeExpired(), wait))
+		resendButton.SetText(resendText(flow.SentCode()))
 
-				return
-			}
+		setEnabled(backButton, !busy && state != auth.StateAPIData && state != auth.StateDone)
+		setEnabled(resendButton, !busy && wait == 0)
+		setEnabled(qrButton, !busy)
+		// the QR code is polled, there is nothing to submit
+		setEnabled(nextButton, !busy && state != auth.StateDone && state != auth.StateQR)
+	}
 
+	// finish shows the result of a step
+	finish := func(err error) {
+		done := flow.State() == auth.StateDone
+		if err != nil {
+			cl.ExtLog.Error("login step failed", zap.Stringer("state", flow.State()), zap.Error(err))
+			errorLabel.SetText(loginErrorText(err))
+		}
+		render()
+		if done && err == nil {
 			_ = cl.StopCreatorServer()
-
 			r.ClearScreenAndShow(ScreenMain)
+		}
+	}
 
-		case 3:
-			if passwordEntry.Text == "" {
-				return
-			}
-
-			passwordEntry.Disable()
-
-			err := cl.CheckPassword(passwordEntry.Text)
-			if err != nil {
-				cl.ExtLog.Error("failed to check password", zap.Error(err))
-				return
-			}
-
-			if err := cl.SaveAPIConfig(); err != nil {
-				cl.ExtLog.Error("failed to save api config; deleting session...", zap.Error(err))
-				_ = cl.DeleteSession()
-				return
-			}
-
-			_ = cl.StopCreatorServer()
-			r.ClearScreenAndShow(ScreenMain)
+	// run does a step of the flow off the UI goroutine
+	run := func(step func() error) {
+		if busy {
+			return
 		}
+		busy = true
+		errorLabel.SetText("")
+		render()
+		go func() {
+			err := step()
+			fyne.Do(func() {
+				busy = false
+				finish(err)
+			})
+		}()
 	}
 
-	backButton.Disable()
+	nextButton.OnTapped = func() {
+		switch flow.State() {
+		case auth.StateAPIData:
+			id, hash := apiIDEntry.Text, apiHashEntry.Text
+			run(func() error { return flow.SubmitAPIData(id, hash) })
+		case auth.StatePhone:
+			phone := phoneEntry.Text
+			run(func() error { return flow.SubmitPhone(phone) })
+		case auth.StateCode:
+			code := codeEntry.Text
+			run(func() error { return flow.SubmitCode(code) })
+		case auth.StatePassword:
+			password := passwordEntry.Text
+			run(func() error { return flow.SubmitPassword(password) })
+		}
+	}
+	resendButton.OnTapped = func() {
+		run(flow.ResendCode)
+	}
+	qrButton.OnTapped = func() {
+		run(flow.StartQR)
+	}
 	backButton.OnTapped = func() {
-		switch authStep {
-		case 1:
-			apiIDEntry.Enable()
-			apiHashEntry.Enable()
-			backButton.Disable()
-
-			phoneEntry.Disable()
-			phoneRow.Hide()
-
-		case 2:
-
+		if busy {
+			return
+		}
+		if err := flow.Back(); err != nil {
+			cl.ExtLog.Warn("login back failed", zap.Error(err))
 		}
-		authStep -= 1
+		errorLabel.SetText("")
+		codeEntry.SetText("")
+		passwordEntry.SetText("")
+		render()
 	}
 
+	// the resend countdown and the QR polling
+	go func() {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			switch flow.State() {
+			case auth.StateCode:
+				fyne.Do(render)
+			case auth.StateQR:
+				if i%qrPollTicks != 0 {
+					fyne.Do(render)
+					continue
+				}
+				// a step of the buttons, e.g. Back, goes first
+				err := flow.PollQR()
+				if errors.Is(err, auth.ErrWrongState) {
+					continue
+				}
+				fyne.Do(func() {
+					if err == nil {
+						errorLabel.SetText("")
+					}
+					finish(err)
+				})
+			}
+		}
+	}()
+	render()
+
 	return container.NewVBox(
+		container.NewBorder(nil, nil,
+			widget.NewLabel("Account:"), nil,
+			accountSelect,
+		),
 		container.NewBorder(nil, nil,
 			widget.NewLabel("API ID:"), nil,
 			apiIDEntry,
@@ -199,14 +269,103 @@ func loginScreen(r *Router) fyne.CanvasObject {
 			widget.NewLabel("API Hash:"), nil,
 			apiHashEntry,
 		),
-		phoneRow, codeRow, passwordRow,
+		phoneRow, codeRow, codeInfo, passwordRow, hintLabel,
+		qrImage, qrInfo,
+		errorLabel,
 
 		container.NewBorder(
 			nil, nil, backButton, nextButton,
+			container.NewHBox(resendButton, qrButton),
 		),
+		serverLabel,
 	)
 }
 
+// loginErrorText returns the message of a login step error for the user.
+func loginErrorText(err error) string {
+	var ae *auth.Error
+	if errors.As(err, &ae) {
+		return ae.Message
+	}
+	return err.Error()
+}
+
+// codeInfoText describes how the code was sent and when it may be resent.
+func codeInfoText(sent *creator.SendCodeResponse, expired bool, wait time.Duration) string {
+	if sent == nil {
+		return ""
+	}
+	if expired {
+		return "The code has expired, resend it"
+	}
+	text := "The code was sent " + codeTypeText(sent.Type)
+	if wait > 0 {
+		text += fmt.Sprintf(", resend in %d s", int(wait.Round(time.Second).Seconds()))
+	}
+	return text
+}
+
+func resendText(sent *creator.SendCodeResponse) string {
+	if sent == nil || sent.NextType == "" {
+		return "Resend code"
+	}
+	return "Resend code " + codeTypeText(sent.NextType)
+}
+
+// codeTypeText returns e.g. "by SMS" for SMS and "to the telegram app" for APP.
+func codeTypeText(t string) string {
+	switch t {
+	case "APP":
+		return "to the telegram app"
+	case "SMS":
+		return "by SMS"
+	case "":
+		return ""
+	}
+	return "by " + strings.ToLower(strings.ReplaceAll(t, "_", " "))
+}
+
+// qrPollTicks is how many seconds pass between the QR login polls.
+const qrPollTicks = 2
+
+// qrCodeImage returns the QR code of url, nil if it can't be encoded.
+func qrCodeImage(url string) image.Image {
+	q, err := qrcode.New(url, qrcode.Medium)
+	if err != nil {
+		return nil
+	}
+	return q.Image(256)
+}
+
+// qrInfoText tells where to scan the QR code and when it is renewed.
+func qrInfoText(qr *creator.QRLoginResponse, now time.Time) string {
+	text := "Scan it in telegram: Settings > Devices > Link Desktop Device"
+	if qr == nil {
+		return text
+	}
+	left := qr.ExpiresAt().Sub(now)
+	if left <= 0 {
+		return text + "\nThe code has expired, a new one is coming"
+	}
+	return text + fmt.Sprintf("\nThe code is renewed in %d s", int(left.Round(time.Second).Seconds()))
+}
+
+func setEnabled(w fyne.Disableable, enabled bool) {
+	if enabled {
+		w.Enable()
+	} else {
+		w.Disable()
+	}
+}
+
+func setVisible(o fyne.CanvasObject, visible bool) {
+	if visible {
+		o.Show()
+	} else {
+		o.Hide()
+	}
+}
+
 // TODOScreen is a placeholder screen for future implement.
 //
 //	Parameters: msg string
@@ -0,0 +1,158 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/mauzec/tdsoft/gui/internal/client"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+)
+
+// sessionsTimeout limits a call of the sessions script.
+const sessionsTimeout = 30 * time.Second
+
+// runWithProgress runs f off the UI goroutine showing an infinite progress
+// dialog, then calls done on the UI goroutine.
+func runWithProgress(w fyne.Window, title string, f func(ctx context.Context) error, done func(error)) {
+	d := dialog.NewCustomWithoutButtons(title, widget.NewProgressBarInfinite(), w)
+	d.Show()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sessionsTimeout)
+		err := f(ctx)
+		cancel()
+		fyne.Do(func() {
+			d.Hide()
+			done(err)
+		})
+	}()
+}
+
+// signOut asks to confirm and logs out the account on telegram, then
+// shows the login screen. If telegram can't be reached, the session may
+// be deleted on this device only.
+func signOut(r *Router, cl *client.Client, w fyne.Window, name string) {
+	dialog.ShowConfirm("Sign out",
+		"Sign out of account "+name+"? The session will be logged out on telegram and deleted here.",
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			runWithProgress(w, "Signing out", func(ctx context.Context) error {
+				return cl.SignOut(ctx, name)
+			}, func(err error) {
+				if err == nil {
+					r.ClearScreenAndShow(ScreenLogin)
+					return
+				}
+				dialog.ShowConfirm("Sign out failed",
+					sessionsErrorText(err)+"\n\nDelete the session on this device anyway? It stays active on telegram.",
+					func(ok bool) {
+						if !ok {
+							return
+						}
+						if err := cl.Logout(name); err != nil {
+							dialog.ShowError(err, w)
+							return
+						}
+						r.ClearScreenAndShow(ScreenLogin)
+					}, w)
+			})
+		}, w)
+}
+
+// showSessions shows the active sessions of the current account,
+// stale ones can be terminated.
+func showSessions(cl *client.Client, w fyne.Window) {
+	list := container.NewVBox(widget.NewLabel("Loading..."))
+	othersButton := widget.NewButton("Sign out all other sessions", nil)
+	othersButton.Importance = widget.DangerImportance
+	othersButton.Disable()
+
+	var load func()
+	terminate := func(title, question string, f func(ctx context.Context) error) {
+		dialog.ShowConfirm(title, question, func(ok bool) {
+			if !ok {
+				return
+			}
+			runWithProgress(w, "Terminating", f, func(err error) {
+				if err != nil {
+					dialog.ShowError(errors.New(sessionsErrorText(err)), w)
+				}
+				load()
+			})
+		}, w)
+	}
+
+	load = func() {
+		othersButton.Disable()
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), sessionsTimeout)
+			auths, err := cl.Authorizations(ctx)
+			cancel()
+			fyne.Do(func() {
+				list.RemoveAll()
+				if err != nil {
+					list.Add(widget.NewLabel(sessionsErrorText(err)))
+					return
+				}
+				for _, a := range auths {
+					info := widget.NewLabel(authorizationText(a))
+					var action fyne.CanvasObject = widget.NewLabel("This device")
+					if !a.Current {
+						action = widget.NewButton("Terminate", func() {
+							terminate("Terminate session",
+								"Terminate the session of "+a.DeviceModel+"?",
+								func(ctx context.Context) error {
+									return cl.TerminateAuthorization(ctx, a.Hash)
+								})
+						})
+					}
+					list.Add(container.NewBorder(nil, nil, nil, action, info))
+				}
+				if len(auths) > 1 {
+					othersButton.Enable()
+				}
+			})
+		}()
+	}
+	othersButton.OnTapped = func() {
+		terminate("Sign out all other sessions",
+			"Terminate all sessions of the account but this one?",
+			func(ctx context.Context) error {
+				return cl.TerminateOtherAuthorizations(ctx)
+			})
+	}
+	load()
+
+	content := container.NewBorder(nil, othersButton, nil, nil, container.NewVScroll(list))
+	d := dialog.NewCustom("Sessions of "+cl.CurrentAccount().Name, "Close", content, w)
+	d.Resize(fyne.NewSize(600, 400))
+	d.Show()
+}
+
+// authorizationText returns the device and app, then where and when it was active.
+func authorizationText(a client.Authorization) string {
+	app := strings.TrimSpace(a.AppName + " " + a.AppVersion)
+	where := strings.TrimSpace(a.IP + " " + a.Country)
+	return fmt.Sprintf("%s, %s\n%s · active %s",
+		a.DeviceModel, app, where, a.Active.Local().Format("2006-01-02 15:04"))
+}
+
+func sessionsErrorText(err error) string {
+	switch {
+	case errors.Is(err, apperrors.ErrFreshResetForbidden):
+		return "Telegram allows to terminate other sessions only from a session older than 24 hours"
+	case errors.Is(err, apperrors.ErrSessionRevoked):
+		return "The session of this device was revoked, log in again"
+	case errors.Is(err, apperrors.ErrConnectionFailed), errors.Is(err, context.DeadlineExceeded):
+		return "Telegram can't be reached, check the connection"
+	}
+	return "Failed: " + err.Error()
+}
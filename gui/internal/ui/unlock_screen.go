@@ -0,0 +1,115 @@
+package ui
+
+import (
+	"errors"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"github.com/mauzec/tdsoft/gui/internal/vault"
+)
+
+const ScreenUnlock ScreenID = "unlock"
+
+// unlockScreen asks the passphrase and unlocks the vault,
+// or creates the vault on the first start.
+//
+//	Services: *vault.Vault
+//	Parameters: onUnlock func(), called after the vault is unlocked
+func unlockScreen(r *Router) fyne.CanvasObject {
+	var (
+		v        *vault.Vault
+		onUnlock func()
+	)
+	_ = r.GetServiceAs(&v)
+	_ = r.ParamAs(ScreenUnlock, &onUnlock)
+
+	creating := !v.Exists()
+
+	header := widget.NewLabelWithStyle("Unlock vault",
+		fyne.TextAlignCenter, fyne.TextStyle{Bold: true},
+	)
+	hint := widget.NewLabel("Enter the passphrase of " + v.Path())
+	if creating {
+		header.SetText("Create vault")
+		hint.SetText("API credentials and the session will be encrypted with this passphrase.\n" +
+			"It can't be recovered, keep it safe.")
+	}
+	hint.Wrapping = fyne.TextWrapWord
+
+	passEntry := widget.NewPasswordEntry()
+	passEntry.SetPlaceHolder("passphrase")
+	confirmEntry := widget.NewPasswordEntry()
+	confirmEntry.SetPlaceHolder("repeat passphrase")
+	confirmRow := container.NewBorder(nil, nil,
+		widget.NewLabel("Repeat:"), nil,
+		confirmEntry,
+	)
+	if !creating {
+		confirmRow.Hide()
+	}
+
+	errLabel := widget.NewLabel("")
+	errLabel.Wrapping = fyne.TextWrapWord
+	errLabel.Hide()
+	showErr := func(msg string) {
+		errLabel.SetText(msg)
+		errLabel.Show()
+	}
+
+	unlockButton := widget.NewButton("Unlock", nil)
+	if creating {
+		unlockButton.SetText("Create")
+	}
+	unlockButton.OnTapped = func() {
+		if creating && passEntry.Text != confirmEntry.Text {
+			showErr("Passphrases don't match")
+			return
+		}
+
+		unlockButton.Disable()
+		passphrase := passEntry.Text
+		go func() {
+			// scrypt takes a while, don't block the UI
+			err := v.Unlock(passphrase)
+			fyne.Do(func() {
+				unlockButton.Enable()
+				switch {
+				case err == nil:
+					passEntry.SetText("")
+					confirmEntry.SetText("")
+					if onUnlock != nil {
+						onUnlock()
+					}
+				case errors.Is(err, apperrors.ErrWrongPassphrase):
+					showErr("Wrong passphrase")
+				case errors.Is(err, apperrors.ErrPassphraseTooShort):
+					showErr("Passphrase is too short, at least 8 characters")
+				default:
+					showErr("Failed to open vault: " + err.Error())
+				}
+			})
+		}()
+	}
+	passEntry.OnSubmitted = func(string) {
+		if creating {
+			r.win.Canvas().Focus(confirmEntry)
+			return
+		}
+		unlockButton.OnTapped()
+	}
+	confirmEntry.OnSubmitted = func(string) { unlockButton.OnTapped() }
+
+	return container.NewVBox(
+		header,
+		hint,
+		container.NewBorder(nil, nil,
+			widget.NewLabel("Passphrase:"), nil,
+			passEntry,
+		),
+		confirmRow,
+		errLabel,
+		unlockButton,
+	)
+}
@@ -57,6 +57,10 @@ func ValidateChatName(chat string) (ChatNameKind, string) {
 		return ChatNameEmpty, ""
 	}
 	if n, err := strconv.Atoi(chat); err == nil && n > 0 {
+		// ids of groups and channels are negative
+		if firstSkip {
+			return ChatNameChatID, "-" + chat
+		}
 		return ChatNameChatID, chat
 	}
 	if firstSkip {
@@ -0,0 +1,150 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+)
+
+// checkout is a decrypted copy of a session, shared by running scripts.
+type checkout struct {
+	dir  string
+	name string
+	refs int
+}
+
+// HasSession reports whether the vault keeps the session name.
+func (v *Vault) HasSession(name string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.data.Sessions[name]) > 0
+}
+
+// AcquireSession decrypts the session name to a 0600 file in a private
+// temp directory and returns the session name to pass to scripts (absolute
+// path without ".session"). If the vault has no such session yet, the
+// directory is empty, so a new session may be created there.
+//
+// The copy is shared while acquired. After the last release the file,
+// possibly updated by pyrogram, is stored back and removed.
+func (v *Vault) AcquireSession(name string) (string, func(), error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.key == nil {
+		return "", nil, apperrors.ErrVaultLocked
+	}
+
+	co, ok := v.checkouts[name]
+	if !ok {
+		var err error
+		if co, err = v.decryptSession(name); err != nil {
+			return "", nil, err
+		}
+		v.checkouts[name] = co
+	}
+	co.refs++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() { v.release(name, co) })
+	}
+	return co.name, release, nil
+}
+
+// decryptSession must be called with mu held.
+func (v *Vault) decryptSession(name string) (*checkout, error) {
+	// MkdirTemp creates the directory with 0700
+	dir, err := os.MkdirTemp("", "tdsoft-session-")
+	if err != nil {
+		return nil, err
+	}
+	co := &checkout{dir: dir, name: filepath.Join(dir, filepath.Base(name))}
+	if data := v.data.Sessions[name]; len(data) > 0 {
+		if err := os.WriteFile(co.name+".session", data, 0o600); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	return co, nil
+}
+
+func (v *Vault) release(name string, co *checkout) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	co.refs--
+	if co.refs > 0 || v.checkouts[name] != co {
+		return
+	}
+	delete(v.checkouts, name)
+	v.err = v.collect(name, co)
+}
+
+// collect stores the session of co back and removes co.
+// Must be called with mu held.
+func (v *Vault) collect(name string, co *checkout) error {
+	defer os.RemoveAll(co.dir)
+
+	data, err := os.ReadFile(co.name + ".session")
+	if errors.Is(err, os.ErrNotExist) || len(data) == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if v.key == nil {
+		return apperrors.ErrVaultLocked
+	}
+	v.data.Sessions[name] = data
+	return v.save()
+}
+
+// DeleteSession forgets the session name.
+func (v *Vault) DeleteSession(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.key == nil {
+		return apperrors.ErrVaultLocked
+	}
+	delete(v.data.Sessions, name)
+	if co, ok := v.checkouts[name]; ok {
+		_ = os.Remove(co.name + ".session")
+	}
+	return v.save()
+}
+
+// ImportSession moves a plaintext session file into the vault as the
+// session name. The file is removed after it is stored. If the vault
+// already has another session with the name, the file is kept and
+// [apperrors.ErrSessionConflict] is returned.
+func (v *Vault) ImportSession(name, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	if v.key == nil {
+		v.mu.Unlock()
+		return apperrors.ErrVaultLocked
+	}
+	switch stored := v.data.Sessions[name]; {
+	case len(stored) == 0:
+		v.data.Sessions[name] = data
+		if err := v.save(); err != nil {
+			delete(v.data.Sessions, name)
+			v.mu.Unlock()
+			return err
+		}
+	case !bytes.Equal(stored, data):
+		v.mu.Unlock()
+		return fmt.Errorf("%w: %s", apperrors.ErrSessionConflict, path)
+	}
+	v.mu.Unlock()
+
+	return os.Remove(path)
+}
@@ -0,0 +1,353 @@
+// Package vault keeps API credentials and the session file encrypted at rest.
+//
+// The vault file holds a JSON header with scrypt parameters and the
+// AES-256-GCM encrypted payload. The key is derived from a passphrase
+// and lives only in memory while the vault is unlocked.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+	"github.com/mauzec/tdsoft/gui/internal/preferences"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	formatVersion = 1
+	kdfScrypt     = "scrypt"
+
+	// scrypt parameters for new vaults, ~100ms on a laptop
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	keyLen  = 32
+	saltLen = 16
+
+	// bounds of the scrypt parameters read from a vault file,
+	// so a broken file can't make the key derivation exhaust memory
+	maxScryptN   = 1 << 20
+	maxScryptR   = 32
+	maxScryptP   = 16
+	maxScryptMem = 1 << 30 // 128 * N * R bytes
+	maxSaltLen   = 64
+
+	MinPassphraseLen = 8
+)
+
+// additional data bound to the ciphertext
+var aad = []byte("tdsoft-vault-v1")
+
+type fileFormat struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// check checks the key derivation parameters of ff.
+func (ff *fileFormat) check() error {
+	if ff.N < 2 || ff.N > maxScryptN || ff.N&(ff.N-1) != 0 {
+		return fmt.Errorf("scrypt N %d", ff.N)
+	}
+	if ff.R < 1 || ff.R > maxScryptR || ff.P < 1 || ff.P > maxScryptP {
+		return fmt.Errorf("scrypt r %d, p %d", ff.R, ff.P)
+	}
+	if 128*ff.N*ff.R > maxScryptMem {
+		return fmt.Errorf("scrypt N %d, r %d need too much memory", ff.N, ff.R)
+	}
+	if len(ff.Salt) < saltLen || len(ff.Salt) > maxSaltLen {
+		return fmt.Errorf("salt of %d bytes", len(ff.Salt))
+	}
+	return nil
+}
+
+type payload struct {
+	Values map[string]any `json:"values"`
+
+	// Sessions by session name
+	Sessions map[string][]byte `json:"sessions,omitempty"`
+
+	// Session is the only session of the first version, it is moved
+	// to Sessions under the default session name on unlock.
+	Session []byte `json:"session,omitempty"`
+}
+
+// Vault is a passphrase protected store. It implements
+// preferences.SettingsStore and keeps session files by session name.
+//
+// While locked, getters return zero values and setters fail (see [Vault.Err]).
+type Vault struct {
+	path           string
+	defaultSession string
+
+	mu        sync.Mutex
+	key       []byte
+	salt      []byte
+	n         int
+	r         int
+	p         int
+	data      payload
+	err       error
+	checkouts map[string]*checkout
+}
+
+var _ preferences.SettingsStore = (*Vault)(nil)
+
+// New returns a locked vault stored at path. defaultSession is the session
+// name (e.g. config/first) a session of the first vault version belongs to.
+func New(path, defaultSession string) *Vault {
+	return &Vault{
+		path:           path,
+		defaultSession: defaultSession,
+		checkouts:      make(map[string]*checkout),
+	}
+}
+
+func (v *Vault) Path() string { return v.path }
+
+// Exists reports whether the vault file was created.
+func (v *Vault) Exists() bool {
+	_, err := os.Stat(v.path)
+	return err == nil
+}
+
+func (v *Vault) Locked() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.key == nil
+}
+
+// Unlock decrypts the vault with passphrase.
+// If the vault file doesn't exist, it is created.
+func (v *Vault) Unlock(passphrase string) error {
+	raw, err := os.ReadFile(v.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return v.create(passphrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	var ff fileFormat
+	if err := json.Unmarshal(raw, &ff); err != nil {
+		return fmt.Errorf("%w: %v", apperrors.ErrVaultFormat, err)
+	}
+	if ff.Version != formatVersion || ff.KDF != kdfScrypt {
+		return fmt.Errorf("%w: version %d, kdf %q", apperrors.ErrVaultFormat, ff.Version, ff.KDF)
+	}
+	if err := ff.check(); err != nil {
+		return fmt.Errorf("%w: %v", apperrors.ErrVaultFormat, err)
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), ff.Salt, ff.N, ff.R, ff.P, keyLen)
+	if err != nil {
+		return fmt.Errorf("%w: %v", apperrors.ErrVaultFormat, err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	if len(ff.Nonce) != gcm.NonceSize() {
+		return fmt.Errorf("%w: nonce of %d bytes", apperrors.ErrVaultFormat, len(ff.Nonce))
+	}
+	plain, err := gcm.Open(nil, ff.Nonce, ff.Data, aad)
+	if err != nil {
+		return apperrors.ErrWrongPassphrase
+	}
+	var data payload
+	if err := json.Unmarshal(plain, &data); err != nil {
+		return fmt.Errorf("%w: %v", apperrors.ErrVaultFormat, err)
+	}
+	if data.Values == nil {
+		data.Values = map[string]any{}
+	}
+	if data.Sessions == nil {
+		data.Sessions = map[string][]byte{}
+	}
+	if len(data.Session) > 0 {
+		if _, ok := data.Sessions[v.defaultSession]; !ok {
+			data.Sessions[v.defaultSession] = data.Session
+		}
+		data.Session = nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.key, v.salt = key, ff.Salt
+	v.n, v.r, v.p = ff.N, ff.R, ff.P
+	v.data = data
+	return nil
+}
+
+func (v *Vault) create(passphrase string) error {
+	if len(passphrase) < MinPassphraseLen {
+		return apperrors.ErrPassphraseTooShort
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keyLen)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.key, v.salt = key, salt
+	v.n, v.r, v.p = scryptN, scryptR, scryptP
+	v.data = payload{Values: map[string]any{}, Sessions: map[string][]byte{}}
+	if err := v.save(); err != nil {
+		v.lock()
+		return err
+	}
+	return nil
+}
+
+// Close stores decrypted sessions back, removes them and locks the vault.
+func (v *Vault) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var errs []error
+	for name, co := range v.checkouts {
+		errs = append(errs, v.collect(name, co))
+		delete(v.checkouts, name)
+	}
+	v.lock()
+	return errors.Join(errs...)
+}
+
+// lock must be called with mu held.
+func (v *Vault) lock() {
+	clear(v.key)
+	v.key = nil
+	v.data = payload{}
+}
+
+// Err returns the last error of a setter.
+func (v *Vault) Err() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.err
+}
+
+func (v *Vault) String(key string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, _ := v.data.Values[key].(string)
+	return s
+}
+
+func (v *Vault) SetString(key string, value string) {
+	v.set(key, value)
+}
+
+func (v *Vault) Bool(key string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	b, _ := v.data.Values[key].(bool)
+	return b
+}
+
+func (v *Vault) SetBool(key string, value bool) {
+	v.set(key, value)
+}
+
+func (v *Vault) RemoveValue(key string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.key == nil {
+		v.err = apperrors.ErrVaultLocked
+		return
+	}
+	delete(v.data.Values, key)
+	v.err = v.save()
+}
+
+func (v *Vault) set(key string, value any) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.key == nil {
+		v.err = apperrors.ErrVaultLocked
+		return
+	}
+	v.data.Values[key] = value
+	v.err = v.save()
+}
+
+// ImportSettings moves string keys from another store into the vault.
+// Keys already set in the vault are kept, but still removed from the store.
+func (v *Vault) ImportSettings(from preferences.SettingsStore, keys ...string) error {
+	for _, key := range keys {
+		if val := from.String(key); val != "" && v.String(key) == "" {
+			v.SetString(key, val)
+			if err := v.Err(); err != nil {
+				return err
+			}
+		}
+		from.RemoveValue(key)
+	}
+	return nil
+}
+
+// save encrypts and writes the vault. Must be called with mu held.
+func (v *Vault) save() error {
+	plain, err := json.Marshal(v.data)
+	if err != nil {
+		return err
+	}
+	defer clear(plain)
+
+	gcm, err := newGCM(v.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(fileFormat{
+		Version: formatVersion,
+		KDF:     kdfScrypt,
+		N:       v.n,
+		R:       v.r,
+		P:       v.p,
+		Salt:    v.salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plain, aad),
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("error when writing temp file: %w", err)
+	}
+	if err := os.Rename(tmp, v.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error when renaming temp file: %w", err)
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,259 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apperrors "github.com/mauzec/tdsoft/gui/internal/errors"
+)
+
+const testPassphrase = "correct horse"
+
+func newTestVault(t *testing.T) *Vault {
+	t.Helper()
+	v := New(filepath.Join(t.TempDir(), "vault.json"), "config/first")
+	if err := v.Unlock(testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// editFile decodes the vault file of v, calls edit and writes it back.
+func editFile(t *testing.T, v *Vault, edit func(m map[string]any)) {
+	t.Helper()
+	raw, err := os.ReadFile(v.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		t.Fatal(err)
+	}
+	edit(m)
+	if raw, err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(v.Path(), raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	v := newTestVault(t)
+	v.SetString("tg.api_hash", "secret-api-hash")
+	v.SetBool("flag", true)
+	if err := v.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Locked() || v.String("tg.api_hash") != "" {
+		t.Fatal("closed vault is readable")
+	}
+
+	raw, err := os.ReadFile(v.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "secret-api-hash") {
+		t.Error("value is stored in plaintext")
+	}
+
+	v = New(v.Path(), "config/first")
+	if err := v.Unlock(testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if v.String("tg.api_hash") != "secret-api-hash" || !v.Bool("flag") {
+		t.Errorf("values = %q, %v", v.String("tg.api_hash"), v.Bool("flag"))
+	}
+}
+
+func TestVaultShortPassphrase(t *testing.T) {
+	v := New(filepath.Join(t.TempDir(), "vault.json"), "config/first")
+	if err := v.Unlock("short"); !errors.Is(err, apperrors.ErrPassphraseTooShort) {
+		t.Errorf("err = %v, want %v", err, apperrors.ErrPassphraseTooShort)
+	}
+	if v.Exists() {
+		t.Error("vault is created")
+	}
+}
+
+func TestVaultWrongPassphrase(t *testing.T) {
+	v := newTestVault(t)
+	_ = v.Close()
+
+	v = New(v.Path(), "config/first")
+	if err := v.Unlock("wrong passphrase"); !errors.Is(err, apperrors.ErrWrongPassphrase) {
+		t.Errorf("err = %v, want %v", err, apperrors.ErrWrongPassphrase)
+	}
+	if !v.Locked() {
+		t.Error("vault is unlocked")
+	}
+}
+
+func TestVaultTampered(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(m map[string]any)
+		want error
+	}{
+		{"data", func(m map[string]any) {
+			data, _ := base64.StdEncoding.DecodeString(m["data"].(string))
+			data[len(data)/2] ^= 1
+			m["data"] = data
+		}, apperrors.ErrWrongPassphrase},
+		{"nonce", func(m map[string]any) {
+			nonce, _ := base64.StdEncoding.DecodeString(m["nonce"].(string))
+			nonce[0] ^= 1
+			m["nonce"] = nonce
+		}, apperrors.ErrWrongPassphrase},
+		{"nonce removed", func(m map[string]any) { delete(m, "nonce") }, apperrors.ErrVaultFormat},
+		{"nonce short", func(m map[string]any) { m["nonce"] = "AAAA" }, apperrors.ErrVaultFormat},
+		{"huge n", func(m map[string]any) { m["n"] = 1 << 40 }, apperrors.ErrVaultFormat},
+		{"n not power of two", func(m map[string]any) { m["n"] = 3 << 10 }, apperrors.ErrVaultFormat},
+		{"huge r", func(m map[string]any) { m["r"] = 1 << 20 }, apperrors.ErrVaultFormat},
+		{"zero p", func(m map[string]any) { m["p"] = 0 }, apperrors.ErrVaultFormat},
+		{"no salt", func(m map[string]any) { delete(m, "salt") }, apperrors.ErrVaultFormat},
+		{"version", func(m map[string]any) { m["version"] = 2 }, apperrors.ErrVaultFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVault(t)
+			_ = v.Close()
+			editFile(t, v, tt.edit)
+
+			err := New(v.Path(), "config/first").Unlock(testPassphrase)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVaultSessionCheckout(t *testing.T) {
+	v := newTestVault(t)
+	if v.HasSession("config/first") {
+		t.Fatal("new vault has a session")
+	}
+
+	// a new session is created by pyrogram in the checkout
+	session, release, err := v.AcquireSession("config/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(session) != "first" {
+		t.Errorf("session = %q", session)
+	}
+	if err := os.WriteFile(session+".session", []byte("session data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the checkout is shared
+	shared, releaseShared, err := v.AcquireSession("config/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared != session {
+		t.Errorf("shared = %q, want %q", shared, session)
+	}
+	release()
+	release()
+	if _, err := os.Stat(session + ".session"); err != nil {
+		t.Errorf("session is removed while acquired: %v", err)
+	}
+	releaseShared()
+	if _, err := os.Stat(filepath.Dir(session)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkout is not removed: %v", err)
+	}
+	if !v.HasSession("config/first") {
+		t.Fatal("session is not stored")
+	}
+
+	if err := v.Close(); err != nil {
+		t.Fatal(err)
+	}
+	v = New(v.Path(), "config/first")
+	if err := v.Unlock(testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	session, release, err = v.AcquireSession("config/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	data, err := os.ReadFile(session + ".session")
+	if err != nil || string(data) != "session data" {
+		t.Errorf("session = %q, %v", data, err)
+	}
+	if fi, err := os.Stat(session + ".session"); err == nil && fi.Mode().Perm() != 0o600 {
+		t.Errorf("session mode = %v", fi.Mode().Perm())
+	}
+}
+
+func TestVaultCloseCollectsSessions(t *testing.T) {
+	v := newTestVault(t)
+	session, _, err := v.AcquireSession("config/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(session+".session", []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Dir(session)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkout is not removed: %v", err)
+	}
+
+	v = New(v.Path(), "config/first")
+	if err := v.Unlock(testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if !v.HasSession("config/first") {
+		t.Error("session is not stored on close")
+	}
+}
+
+func TestVaultImportSession(t *testing.T) {
+	v := newTestVault(t)
+	path := filepath.Join(t.TempDir(), "first.session")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.ImportSession("config/first", path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("imported file is kept: %v", err)
+	}
+
+	// a copy of the stored session is removed
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.ImportSession("config/first", path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("copy is kept: %v", err)
+	}
+
+	// another session is kept
+	if err := os.WriteFile(path, []byte("other"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err := v.ImportSession("config/first", path)
+	if !errors.Is(err, apperrors.ErrSessionConflict) {
+		t.Errorf("err = %v, want %v", err, apperrors.ErrSessionConflict)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file is removed: %v", err)
+	}
+}
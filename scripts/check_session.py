@@ -0,0 +1,56 @@
+'''
+checks that the session is authorized: emits SESSION_OK with the account
+and the latency of a request to telegram, or SESSION_REVOKED if the session
+was logged out elsewhere (terminated in another app, deleted account...)
+'''
+import argparse
+import asyncio
+import time
+from typing import Optional, List, Dict, Any
+from config.config import get_tdlib_options
+from pyrogram import errors, types
+import utils.io as io
+
+
+def parse_args(argv: Optional[List[str]] = None) -> argparse.Namespace:
+    p = argparse.ArgumentParser(description='Check that the session is authorized')
+    p.add_argument(
+        'session', type=str, help='session path (string)'
+    )
+    return p.parse_args(argv)
+
+async def main(argv: Optional[List[str]] = None):
+    io.state().csv_flushed = True
+    args = parse_args(argv)
+    if not args.session:
+        io.message(None, 'error', 'NO_SESSION', when='main')
+
+    options: Dict[str, Any] = get_tdlib_options()
+    api_id: int = options['api_id']
+    api_hash: str = options['api_hash']
+
+    try:
+        # starting the client calls telegram too, a revoked session fails here
+        async with io.client(args.session, api_id, api_hash) as cl:
+            started = time.monotonic()
+            me: types.User = await cl.get_me()
+            latency = time.monotonic() - started
+    except errors.Unauthorized as e:
+        io.message(None, 'error', 'SESSION_REVOKED', when='check session', m=e.ID)
+    except errors.RPCError as e:
+        io.exit_on_rpc(None, e, 'check session')
+    except OSError as e:
+        io.message(None, 'error', 'CONNECTION_FAILED', when='check session', error=str(e))
+
+    io.message(None, 'info', 'SESSION_OK',
+               id=me.id,
+               first_name=me.first_name or '',
+               username=me.username or '',
+               latency_ms=int(latency * 1000))
+
+if __name__ == '__main__':
+    try:
+        asyncio.run(main())
+    except Exception as e:
+        io.message(None, 'error', 'UNEXPECTED_ERROR',
+                    when='main', error=str(e))
@@ -1,13 +1,27 @@
 import os
 from typing import Dict, Any
+from contextvars import ContextVar
 from dotenv import load_dotenv
 
 load_dotenv()
 
+# API_ID and API_HASH of the current worker call, see set_call_env
+_call_env: ContextVar[Dict[str, str]] = ContextVar('call_env', default={})
+
+def set_call_env(env: Dict[str, str]) -> None:
+    '''
+    sets the variables read by get_tdlib_options for the current asyncio
+    task, the worker runs calls of different accounts in one process
+    '''
+    _call_env.set(dict(env))
+
+def getenv(name: str) -> str|None:
+    return _call_env.get().get(name) or os.getenv(name)
+
 def get_tdlib_options() -> Dict[str, Any]:
     try:
-        api_id = int(os.getenv("API_ID"))
-        api_hash = os.getenv("API_HASH")
+        api_id = int(getenv("API_ID"))
+        api_hash = getenv("API_HASH")
     except ValueError:
         raise ValueError("API_ID must be an integer")
     if not api_id or not api_hash:
@@ -1,12 +1,20 @@
 from pyrogram import Client
-from pyrogram.errors import SessionPasswordNeeded, BadRequest
+from pyrogram.errors import SessionPasswordNeeded, FloodWait, RPCError
 from fastapi import FastAPI
+from fastapi.responses import JSONResponse
 from pydantic import BaseModel
-from typing import Optional, Tuple
+from typing import Optional, Any, Dict
 from pyrogram import raw
+from pyrogram.session import Session, Auth
 from os import system
 import uvicorn
 from urllib.parse import urlparse
+import argparse
+import asyncio
+import base64
+import socket
+import time
+import sys
 import os
 try:
     import tomllib as _tomllib
@@ -22,90 +30,256 @@ client: Optional[Client] = None
 sent_code_data: Optional[uvicorn.Server] = None
     
 SESSION = ""
+
+# requests have JSON bodies, so secrets never get to URLs and access logs.
+# errors are {'error': {'code', 'message', 'details'}} with a non 2xx status,
+# see gui/internal/creator
+
+class SessionPathRequest(BaseModel):
+    path: str
+
+class APIDataRequest(BaseModel):
+    api_id: str
+    api_hash: str
+
+class SendCodeRequest(BaseModel):
+    phone: str
+
+class ResendCodeRequest(BaseModel):
+    phone: str
+
+class SignInRequest(BaseModel):
+    phone: str
+    code: str
+
+class CheckPasswordRequest(BaseModel):
+    password: str
+
+
+def error(status: int, code: str, message: str, **details: Any) -> JSONResponse:
+    body: Dict[str, Any] = {'code': code, 'message': message}
+    if details:
+        body['details'] = details
+    return JSONResponse(status_code=status, content={'error': body})
+
+def rpc_error(e: Exception) -> JSONResponse:
+    '''
+    maps pyrogram errors to error codes, e.g. PHONE_CODE_INVALID
+    '''
+    if isinstance(e, SessionPasswordNeeded):
+        return error(401, 'PASSWORD_NEEDED', 'password needed')
+    if isinstance(e, FloodWait):
+        return error(429, 'FLOOD_WAIT', str(e), value=int(getattr(e, 'value', 0)))
+    if isinstance(e, RPCError):
+        # telegram internal errors may be retried, the others may not
+        status = e.CODE if isinstance(e.CODE, int) and 400 <= e.CODE < 500 else 502
+        return error(status, e.ID or 'RPC_ERROR', str(e), rpc_code=e.CODE)
+    return error(500, 'UNEXPECTED_ERROR', str(e))
+
+def enum_name(v: Any) -> str:
+    '''
+    e.g. 'SMS' for SentCodeType.SMS, '' for None
+    '''
+    if v is None:
+        return ''
+    return getattr(v, 'name', None) or str(v)
+
+def sent_code(message: str, sent: Any) -> Dict[str, Any]:
+    '''
+    type is how the code was sent, next_type is how resend_code sends it,
+    timeout is the seconds before resend_code may be called
+    '''
+    return {
+        'message': message,
+        'type': enum_name(getattr(sent, 'type', None)),
+        'next_type': enum_name(getattr(sent, 'next_type', None)),
+        'timeout': getattr(sent, 'timeout', None) or 0,
+    }
+
+async def password_needed() -> JSONResponse:
+    hint = ''
+    try:
+        hint = await client.get_password_hint() or ''
+    except Exception as e:
+        print(f'failed to get password hint: {e}')
+    return error(401, 'PASSWORD_NEEDED', 'password needed', hint=hint)
+
+def not_initialized() -> JSONResponse:
+    return error(409, 'CLIENT_NOT_INITIALIZED', 'client is not initialized')
     
 @app.get('/ping')
 async def ping(message: str = 'ping'):
     return {'message': 'pong' if message == 'ping' else 'saimon'}
 
 @app.post('/session_path')
-async def session_path(path: str):
+async def session_path(req: SessionPathRequest):
     global SESSION
-    SESSION = path
+    SESSION = req.path
     return {'message': f'session path set to {SESSION}'}
     
 @app.post('/api_data')
-async def api_data(api_id: str, api_hash: str):
+async def api_data(req: APIDataRequest):
     global client
-    client = Client(SESSION, api_id, api_hash)
+    client = Client(SESSION, req.api_id, req.api_hash)
     try:
         await client.connect()
     except Exception as e:
-        return {'error': str(e)}
+        return rpc_error(e)
     return {'message': 'client initialized', 'session': SESSION}
         
 
 @app.post('/send_code')
-async def send_code(phone: str):
+async def send_code(req: SendCodeRequest):
     global client
     global sent_code_data
     if client is None:
-        return {'error': 'client is not initialized'}
+        return not_initialized()
+    try:
+        sent_code_data = await client.send_code(req.phone)
+    except Exception as e:
+        return rpc_error(e)
+    return sent_code('code sent', sent_code_data)
+
+@app.post('/resend_code')
+async def resend_code(req: ResendCodeRequest):
+    global client
+    global sent_code_data
+    if client is None:
+        return not_initialized()
+    if sent_code_data is None:
+        return error(409, 'CODE_NOT_SENT', 'code not sent')
     try:
-        sent_code_data = await client.send_code(phone)
+        sent_code_data = await client.resend_code(req.phone, sent_code_data.phone_code_hash)
     except Exception as e:
-        return {'error': str(e)}
-    return {'message': 'code sent'}
+        return rpc_error(e)
+    return sent_code('code resent', sent_code_data)
 
 @app.post('/sign_in')
-async def sign_in(phone: str, code: str):
+async def sign_in(req: SignInRequest):
     global client
     if client is None:
-        return {'error': 'client is not initialized'}
+        return not_initialized()
     if sent_code_data is None:
-        return {'error': 'code not sent'}
+        return error(409, 'CODE_NOT_SENT', 'code not sent')
     try:
-        await client.sign_in(phone, sent_code_data.phone_code_hash, code)
-        
-    except BadRequest as e:
-        return {'error': str(e)}
+        await client.sign_in(req.phone, sent_code_data.phone_code_hash, req.code)
     except SessionPasswordNeeded:
-        return {'error': 'password needed'}
+        return await password_needed()
+    except Exception as e:
+        return rpc_error(e)
 
     return {'message': 'signed in'}
 
+class QRLogin:
+    '''
+    the login token shown as a QR code. it is exported again when it
+    expires or when telegram says it was accepted (updateLoginToken)
+    '''
+    def __init__(self) -> None:
+        self.client: Optional[Client] = None
+        self.token = b''
+        self.expires = 0
+        self.updated = asyncio.Event()
+
+    def watch(self, c: Client) -> None:
+        if self.client is c:
+            return
+        self.client = c
+        self.token, self.expires = b'', 0
+        handle_updates = c.handle_updates
+
+        async def handle(updates):
+            if isinstance(updates, raw.types.UpdateShort) and \
+                    isinstance(updates.update, raw.types.UpdateLoginToken):
+                self.updated.set()
+            return await handle_updates(updates)
+        c.handle_updates = handle
+
+    def pending(self) -> Dict[str, Any]:
+        return {
+            'status': 'pending',
+            'token': base64.urlsafe_b64encode(self.token).decode().rstrip('='),
+            'expires': self.expires,
+        }
+
+qr = QRLogin()
+
+async def import_login_token(r: Any) -> Any:
+    '''
+    the account is on another DC: the session moves there, like
+    pyrogram's send_code does on PHONE_MIGRATE
+    '''
+    await client.session.stop()
+    await client.storage.dc_id(r.dc_id)
+    test_mode = await client.storage.test_mode()
+    await client.storage.auth_key(await Auth(client, r.dc_id, test_mode).create())
+    client.session = Session(client, r.dc_id, await client.storage.auth_key(), test_mode)
+    await client.session.start()
+    return await client.invoke(raw.functions.auth.ImportLoginToken(token=r.token))
+
+@app.post('/qr_login')
+async def qr_login():
+    '''
+    polled while the QR code is shown
+    '''
+    global client
+    if client is None:
+        return not_initialized()
+    qr.watch(client)
+    if qr.token and not qr.updated.is_set() and qr.expires > time.time() + 1:
+        return qr.pending()
+
+    qr.updated.clear()
+    try:
+        r = await client.invoke(raw.functions.auth.ExportLoginToken(
+            api_id=int(client.api_id), api_hash=client.api_hash, except_ids=[]))
+        if isinstance(r, raw.types.auth.LoginTokenMigrateTo):
+            r = await import_login_token(r)
+    except SessionPasswordNeeded:
+        return await password_needed()
+    except Exception as e:
+        return rpc_error(e)
+
+    if isinstance(r, raw.types.auth.LoginTokenSuccess):
+        await client.storage.user_id(r.authorization.user.id)
+        await client.storage.is_bot(False)
+        return {'status': 'success'}
+    qr.token, qr.expires = r.token, r.expires
+    return qr.pending()
+
 @app.post('/check_password')
-async def check_password(password: str):
+async def check_password(req: CheckPasswordRequest):
     global client
     if client is None:
-        return {'error': 'client is not initialized'}
+        return not_initialized()
     try:
-        await client.check_password(password)
-    except BadRequest as e:
-        return {'error': str(e)}
+        await client.check_password(req.password)
+    except Exception as e:
+        return rpc_error(e)
     return {'message': 'signed in'}
 
 @app.get('/get_me')
 async def get_me():
     global client
     if client is None:
-        return {'error': 'client is not initialized'}
+        return not_initialized()
     
     try:
         me = await client.get_me()
     except Exception as e:
-        return {'error': str(e)}
+        return rpc_error(e)
     return {'id': me.id, 'first_name': me.first_name, 'username': me.username}
 
-@app.get('/shutdown')
+@app.post('/shutdown')
 async def shutdown():
     global server
     if server is None:
-        return {'error': 'server is not running'}
+        return error(409, 'SERVER_NOT_RUNNING', 'server is not running')
     server.should_exit = True
     return {'message': 'server shutting down'}
 
 
-def read_host_port(filename: str, *paths: str) -> Tuple[str, int]:
+def read_creator_uri(filename: str, *paths: str) -> str:
     config_paths = [ os.path.join(p, filename) for p in paths ]
     
     conf = {}
@@ -120,18 +294,48 @@ def read_host_port(filename: str, *paths: str) -> Tuple[str, int]:
                 print(f"loaded config from {path}")
                 break
     
-    creator_uri = conf.get("creator_uri", "http://127.0.0.1:9001")
-    parsed = urlparse(creator_uri)
-    host = parsed.hostname or ""
-    port = parsed.port or 9001
-    return host, port
+    return conf.get("creator_uri", "http://127.0.0.1:9001")
+
+
+def unix_socket(path: str) -> socket.socket:
+    '''
+    binds a socket only the user can connect to. uvicorn's uds option
+    makes it 0666, so the socket is bound here
+    '''
+    if os.path.exists(path):
+        # stale socket of a dead server
+        os.unlink(path)
+    sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+    old = os.umask(0o177)
+    try:
+        sock.bind(path)
+    finally:
+        os.umask(old)
+    os.chmod(path, 0o600)
+    return sock
+
+
+def parse_args():
+    parser = argparse.ArgumentParser()
+    # the app passes the uri with a free port, see gui/internal/client/creator_server.go
+    parser.add_argument('--uri', type=str, default='', help='http://host:port or unix:///path to listen on, default is creator_uri of app.toml')
+    return parser.parse_args()
 
 
 if __name__ == '__main__':
-    host, port = read_host_port(
+    args = parse_args()
+    uri = args.uri or read_creator_uri(
         'app.toml', os.getcwd(), os.path.dirname(__file__))
-    config = uvicorn.Config(app, host='127.0.0.1', port=9001, log_level='info')
+    parsed = urlparse(uri)
+
+    sockets = None
+    if parsed.scheme == 'unix':
+        if not parsed.path:
+            sys.exit(f'no socket path in {uri}')
+        config = uvicorn.Config(app, log_level='info')
+        sockets = [unix_socket(parsed.path)]
+    else:
+        config = uvicorn.Config(app, host=parsed.hostname or '127.0.0.1', port=parsed.port or 9001, log_level='info')
     server: uvicorn.Server = uvicorn.Server(config)
     
-    server.run()
-    
\ No newline at end of file
+    server.run(sockets=sockets)
@@ -14,7 +14,7 @@ from datetime import datetime, date
 from collections import defaultdict
 from statistics import median
 
-def parse_args() -> argparse.Namespace:
+def parse_args(argv: Optional[List[str]] = None) -> argparse.Namespace:
     p = argparse.ArgumentParser(
         description='''Get chat statistics. 
         WARNING: without --history-limit it will read all history of the chat. ''')
@@ -31,11 +31,19 @@ def parse_args() -> argparse.Namespace:
         "--output", type=str, default=f'get-statistics-{int(time.time())}.csv',
         help="output csv file path; default is get-chat-statistics-<time>.csv")
     
+    p.add_argument(
+        '--records', action='store_true',
+        help='emit rows as RECORD messages instead of writing the output, the client writes it')
+    
     p.add_argument(
         '--history-limit', type=int, default=0,
         help='limit number of messages to parse from history; default is 0 (all history)')
     
-    return p.parse_args()
+    p.add_argument(
+        '--resume-from', type=str, default=None,
+        help='checkpoint file to resume history parsing from, the output is not truncated')
+    
+    return p.parse_args(argv)
 
 
 COLUMNS=['title', 'username', 'public_members_count', 'bio', 'is_verified',
@@ -56,18 +64,48 @@ class HistoryStatistics:
 async def fetch_history_statistics(
     app: Client,
     chat_id: str,
-    args: argparse.Namespace
+    args: argparse.Namespace,
+    state: Dict[str, Any],
 ) -> HistoryStatistics:
-    total_messages = 0
-    actual_messages = 0
+    '''
+    state is the checkpoint to resume from, may be empty.
+    the checkpoint keeps the counters, so the parsed history is not read again
+    '''
+    total_messages = int(state.get('total_messages', 0))
+    actual_messages = int(state.get('actual_messages', 0))
     page_size = 75
-    offset_id = 0
+    offset_id = int(state.get('offset_id', 0))
     
     msg_per_day: defaultdict[date, int] = defaultdict(int)
     msg_per_week: defaultdict[int, int] = defaultdict(int)
     msg_per_weekday: defaultdict[int, int] = defaultdict(int)
     
     top_msg_senders: defaultdict[str, int] = defaultdict(int)
+    
+    for k, v in state.get('per_day', {}).items():
+        msg_per_day[date.fromisoformat(k)] = v
+    for k, v in state.get('per_week', {}).items():
+        y, w = k.split('-')
+        msg_per_week[(int(y), int(w))] = v
+    for k, v in state.get('per_weekday', {}).items():
+        msg_per_weekday[int(k)] = v
+    top_msg_senders.update(state.get('senders', {}))
+    
+    def _checkpoint(force: bool = False) -> None:
+        io.checkpoint(None, force=force, offset_id=offset_id,
+                      total_messages=total_messages, actual_messages=actual_messages,
+                      per_day={d.isoformat(): n for d, n in msg_per_day.items()},
+                      per_week={f'{y}-{w}': n for (y, w), n in msg_per_week.items()},
+                      per_weekday={str(d): n for d, n in msg_per_weekday.items()},
+                      senders=top_msg_senders)
+    
+    expected = args.history_limit
+    if expected <= 0:
+        try:
+            expected = await app.get_chat_history_count(chat_id)
+        except Exception:
+            expected = 0
+    
     while (total_messages < args.history_limit) or (args.history_limit <= 0):
 
         curr_messages = 0
@@ -108,11 +146,16 @@ async def fetch_history_statistics(
                 total_messages += 1
                 last_msg_id = msg.id
                 curr_messages += 1
+                io.progress('history', total_messages, expected)
                 
                 if (args.history_limit > 0 and total_messages >= args.history_limit):
                     break
         
         except errors.FloodWait as e:
+            # counters include the broken page, continue after it
+            if last_msg_id is not None:
+                offset_id = last_msg_id
+            _checkpoint(force=True)
             await io.flood_wait_or_exit(None, int(getattr(e, 'value', 0)), 'fetching history statistics')
             
         except errors.RPCError as e:
@@ -126,6 +169,9 @@ async def fetch_history_statistics(
         if curr_messages == 0 or last_msg_id is None or last_msg_id <= 1:
             break
         offset_id = last_msg_id   
+        _checkpoint()
+
+    io.progress('history', total_messages, total_messages)
 
     stats = HistoryStatistics()
     stats.total_messages = actual_messages
@@ -141,10 +187,10 @@ async def fetch_history_statistics(
 async def get_statistics(
     app: Client,
     chat_id: str,
-    args: argparse.Namespace
+    args: argparse.Namespace,
+    state: Dict[str, Any],
 ) -> None:
-    with open(args.output, 'a', newline='', encoding='utf-8') as f:
-        writer = csv.writer(f)
+    with io.output(args.output) as (f, writer):
         try:
             chat = await app.get_chat(chat_id)
             row = [
@@ -154,7 +200,7 @@ async def get_statistics(
                 'yes' if chat.has_protected_content else 'no',
                 chat.invite_link or 'UNKNOWN']
 
-            history_stats = await fetch_history_statistics(app, chat_id, args)
+            history_stats = await fetch_history_statistics(app, chat_id, args, state)
             row += [
                 history_stats.total_messages,
                 history_stats.day_median,
@@ -166,7 +212,7 @@ async def get_statistics(
             writer.writerow(row)
             for u, c in history_stats.top5_msg_senders:
                 writer.writerow(['']*(len(COLUMNS)-2) + [u or 'UNKNOWN', c])
-            io.CSV_FLUSHED = False
+            io.state().csv_flushed = False
                         
         except errors.RPCError as e:
             io.exit_on_rpc(f, e, 'getting statistics')
@@ -176,18 +222,19 @@ async def get_statistics(
                         when='getting statistics',
                         error=str(e))
             
-    io.CSV_FLUSHED = True
+    io.state().csv_flushed = True
 
 
-async def main():
+async def main(argv: Optional[List[str]] = None):
     io.message(None, 'info', 'SCRIPT_STARTED', script='get_chat_statistic.py')
     try:
-        args = parse_args()
+        args = parse_args(argv)
     except Exception as e:
         io.message(None, 'error', "ARGPARSE_ERROR", error=str(e))
 
     if not args.session:
         io.message(None, 'error', 'NO_SESSION', when='main')
+    io.state().records = args.records
     
     options: Dict[str, Any] = get_tdlib_options()
     api_id: int = options["api_id"]
@@ -200,13 +247,11 @@ async def main():
     if kind == ChatNameKind.INVITE_LINK:
         io.message(None, 'error', 'INVITE_LINK_NOT_SUPPORTED', name=args.chat)
         
-    with open(args.output, 'w', newline='', encoding='utf-8') as f:
-        writer = csv.writer(f)
-        writer.writerow(COLUMNS)
-    io.CSV_FLUSHED = True
+    state: Dict[str, Any] = io.load_checkpoint(args.resume_from)
+    io.open_output(args.output, COLUMNS, args.resume_from is not None)
         
-    async with Client(args.session, api_id, api_hash) as app:
-        await get_statistics(app, name, args)
+    async with io.client(args.session, api_id, api_hash) as app:
+        await get_statistics(app, name, args, state)
         
         io.message(None, 'info', 'ALL_DONE', output=os.path.abspath(args.output))
         
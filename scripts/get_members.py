@@ -15,7 +15,7 @@ import utils.io as io
 # TODO: need to do something with flood_wait (add, ex, retry button in ui )
 # TODO: add more errors, like chat not found, instead of just rpc error
 
-def parse_args() -> argparse.Namespace:
+def parse_args(argv: Optional[List[str]] = None) -> argparse.Namespace:
     p = argparse.ArgumentParser(description="get public members of a TG chat")
     
     p.add_argument( # for future use
@@ -31,6 +31,10 @@ def parse_args() -> argparse.Namespace:
         "--output", type=str, 
         help="output csv file path; default is get-members-<timestamp>.csv")
     
+    p.add_argument(
+        '--records', action='store_true',
+        help='emit rows as RECORD messages instead of writing the output, the client writes it')
+    
     p.add_argument(
         "--parse-from-messages", action='store_true',
         help="parse members from last --messages-limit messages")
@@ -48,6 +52,16 @@ def parse_args() -> argparse.Namespace:
     p.add_argument(
         '--add-additional-info', action='store_true',
         help= 'add user/bot additional info to the output (bio, premium, scam flag, etc)')
+    
+    p.add_argument(
+        '--append', action='store_true',
+        help='append to existing output, users already written are skipped')
+    p.add_argument(
+        '--max-flood-wait', type=int, default=0,
+        help='stop with FLOOD_WAIT_TOO_LONG if flood wait is longer (seconds); default 0 (always wait)')
+    p.add_argument(
+        '--resume-from', type=str, default=None,
+        help='checkpoint file to resume from, implies --append')
 
     # TODO
     p.add_argument(
@@ -58,7 +72,7 @@ def parse_args() -> argparse.Namespace:
     #     '--members-filter',
     # )
     
-    return p.parse_args()
+    return p.parse_args(argv)
     
 
 def status_is_member(status: enums.ChatMemberStatus) -> bool:
@@ -119,60 +133,73 @@ async def fetch_members(
     app: Client,
     name: str,
     args: argparse.Namespace,
+    
+    seen: Set[int],
 ) -> Dict[int, types.User]:
     '''
     Returns a set of user ids
+    
+    users in seen are already written (--append) and skipped
     '''
     
     users: Dict[int, types.User] = {}
     
     chat = await app.get_chat(name)
+    expected = args.limit
+    if chat.members_count:
+        expected = min(args.limit, chat.members_count)
     
     total = 0
-    with open(args.output, 'a', newline='', encoding='utf-8') as f:
-        writer = csv.writer(f)
+    with io.output(args.output) as (f, writer):
         
         async def _write_members() -> None:
             nonlocal total
-            try:
-                async for m in app.get_chat_members(chat.id, limit=args.limit):
-                    u: types.User = m.user
-                    if int(u.id) in users:
-                        continue
-                    is_member = status_is_member(m.status)
+            while True:
+                try:
+                    async for m in app.get_chat_members(chat.id, limit=args.limit):
+                        u: types.User = m.user
+                        if int(u.id) in users or int(u.id) in seen:
+                            continue
+                        is_member = status_is_member(m.status)
                     
-                    bio: str|None = None
-                    if args.parse_bio:
-                        if not u.is_bot:
-                            bio = await fetch_bio(f, u, app)
-                        else:
-                            bio = ''
+                        bio: str|None = None
+                        if args.parse_bio:
+                            if not u.is_bot:
+                                bio = await fetch_bio(f, u, app)
+                            else:
+                                bio = ''
 
-                    additional_info: List[str]|None = None
-                    if args.add_additional_info:
-                        additional_info = get_additional_info(u)
+                        additional_info: List[str]|None = None
+                        if args.add_additional_info:
+                            additional_info = get_additional_info(u)
                     
-                    write_row(writer, u, is_member, bio, additional_info)
-                    io.CSV_FLUSHED = False                 
+                        write_row(writer, u, is_member, bio, additional_info)
+                        io.state().csv_flushed = False                 
                     
-                    total += 1
-                    users[int(u.id)] = u
+                        total += 1
+                        users[int(u.id)] = u
+                        io.progress('members', total, expected)
+                        io.checkpoint(f, phase='members', members_seen=len(seen)+total)
             
-            # if we get flood wait, we can't wait, because 
-            # there is no offset parameters in get_chat_members
-            # except errors.FloodWait as e:
-            #     value = int(getattr(e, 'value', 0))
-            #     await io.flood_wait_or_exit(f, value, 'fetching members')
-            except errors.RPCError as e:
-                io.exit_on_rpc(f, e, 'fetching members')
-            except Exception as e:
-                io.message(f, 'error', 'UNEXPECTED_ERROR',
-                           when='fetching members', error=str(e))
+                    return
+                
+                # there is no offset parameter in get_chat_members, so after
+                # the wait members are fetched again, written ones are skipped
+                except errors.FloodWait as e:
+                    io.checkpoint(f, force=True, phase='members', members_seen=len(seen)+total)
+                    await io.flood_wait_or_exit(f, int(getattr(e, 'value', 0)),
+                                                'fetching members')
+                except errors.RPCError as e:
+                    io.exit_on_rpc(f, e, 'fetching members')
+                except Exception as e:
+                    io.message(f, 'error', 'UNEXPECTED_ERROR',
+                               when='fetching members', error=str(e))
         
         await _write_members()
+        io.progress('members', total, total)
         io.message(None, 'info', 'MEMBERS_FETCHED', total=total)
         
-    io.CSV_FLUSHED = True
+    io.state().csv_flushed = True
     return users
         
 
@@ -182,16 +209,26 @@ async def fetch_members_from_messages(
     args: argparse.Namespace,
     
     users: Dict[int, types.User],
+    seen: Set[int],
+    state: Dict[str, Any],
 ) -> None:
-    with open(args.output, 'a',newline='', encoding='utf-8') as f:
-        writer = csv.writer(f)
+    '''
+    state is the checkpoint of the messages phase to resume from, may be empty
+    '''
+    with io.output(args.output) as (f, writer):
         
         # FIXME: change to 100 later
         page_size = 100
         
-        offset_id = 0
+        offset_id = int(state.get('message_id', 0))
+        
+        total_messages = int(state.get('messages_parsed', 0))
+        
+        def _checkpoint(force: bool = False) -> None:
+            io.checkpoint(f, force=force, phase='messages',
+                          message_id=offset_id, messages_parsed=total_messages,
+                          members_seen=len(seen)+len(users))
         
-        total_messages = 0
         async def _write_members_from_messages() -> None:
             nonlocal total_messages
             nonlocal offset_id
@@ -211,7 +248,7 @@ async def fetch_members_from_messages(
 
                         u: types.User = m.from_user
 
-                        if int(u.id) in users:
+                        if int(u.id) in users or int(u.id) in seen:
                             continue
                         
                         member: types.ChatMember = await app.get_chat_member(name, u.id)
@@ -229,17 +266,21 @@ async def fetch_members_from_messages(
                             additional_info = get_additional_info(u)
                         
                         write_row(writer, u, is_member, bio, additional_info)
-                        io.CSV_FLUSHED = False  
+                        io.state().csv_flushed = False  
                         
                         users[int(u.id)] = u
                         total_messages += 1
                         last_msg_id = m.id
                         curr_messages += 1
+                        io.progress('messages', total_messages, args.messages_limit)
 
                         if total_messages >= args.messages_limit:
                             break
                         
                 except errors.FloodWait as e:
+                    if last_msg_id is not None:
+                        offset_id = last_msg_id
+                    _checkpoint(force=True)
                     await io.flood_wait_or_exit(f, int(getattr(e, 'value', 0)), 
                                                 'fetching members from messages')
                 except errors.RPCError as e:
@@ -253,23 +294,26 @@ async def fetch_members_from_messages(
                     break
                 
                 offset_id = last_msg_id
+                _checkpoint()
                 
         await _write_members_from_messages()
+        io.progress('messages', total_messages, total_messages)
         io.message(None, 'info', 'MEMBERS_FROM_MESSAGES_FETCHED', 
                    total=total_messages)
         
-    io.CSV_FLUSHED = True
+    io.state().csv_flushed = True
     
 
-async def main():
+async def main(argv: Optional[List[str]] = None):
     io.message(None, 'info', 'SCRIPT_STARTED', script='get_members.py')
     try:
-        args = parse_args()
+        args = parse_args(argv)
     except Exception as e:
         io.message(None, 'error', "ARGPARSE_ERROR", error=str(e))
         
     if not args.session:
         io.message(None, 'error', 'NO_SESSION', when='main')
+    io.state().records = args.records
         
     if args.limit > 50000:
         io.message(None, 'error', 'MEMBERS_LIMIT_TOO_HIGH', 
@@ -298,16 +342,24 @@ async def main():
         columns.append('bio')
     if args.add_additional_info:
         columns.extend(['premium_status', 'is_deleted', 'is_scam', 'is_verified', 'phone_number'])
-    with open(args.output, 'w', newline='', encoding='utf-8') as f:
-        writer = csv.writer(f)
-        writer.writerow(columns)
-    io.CSV_FLUSHED = True
+    io.state().max_flood_wait = args.max_flood_wait
+    state: Dict[str, Any] = io.load_checkpoint(args.resume_from)
+    if args.resume_from:
+        args.append = True
+    seen: Set[int] = set()
+    if args.append:
+        seen = {int(v) for v in io.read_first_column(args.output) if v.isdigit()}
+    io.open_output(args.output, columns, args.append)
 
-    async with Client(args.session, api_id, api_hash) as app:
-        users: Dict[int, types.User] = await fetch_members(app, name, args)
+    async with io.client(args.session, api_id, api_hash) as app:
+        users: Dict[int, types.User] = {}
+        # members are done if the run stopped when parsing messages
+        if state.get('phase') != 'messages':
+            users = await fetch_members(app, name, args, seen)
+            state = {}
     
         if args.parse_from_messages:
-            await fetch_members_from_messages(app, name, args, users)
+            await fetch_members_from_messages(app, name, args, users, seen, state)
     
         io.message(None, 'info', 'ALL_DONE', total=len(users), output=os.path.abspath(args.output))
         
@@ -12,8 +12,9 @@ from typing import AsyncGenerator, TextIO
 import utils.io as io
 from pyrogram import Client, errors, types, enums
 
+COLUMNS = ['chat_id', 'type', 'title', 'username']
 
-def parse_args() -> argparse.Namespace:
+def parse_args(argv: Optional[List[str]] = None) -> argparse.Namespace:
     p = argparse.ArgumentParser(description="Print dialogs to find chat ids")
     p.add_argument( # for future use
         'session', type=str, help='session path (string)'
@@ -24,18 +25,29 @@ def parse_args() -> argparse.Namespace:
     p.add_argument("--output", type=str, default="", 
                    help="path to output CSV file, default ./print-dialogs-<timestamp>.csv")
     
-    return p.parse_args()
+    p.add_argument(
+        '--records', action='store_true',
+        help='emit rows as RECORD messages instead of writing the output, the client writes it')
+    
+    return p.parse_args(argv)
+
+def dialog_title(chat: types.Chat) -> str:
+    if chat.title:
+        return chat.title
+    name = ' '.join(n for n in (chat.first_name, chat.last_name) if n)
+    return name or '(no title)'
 
-async def main():
-    io.CSV_FLUSHED = True
-    io.message(None, 'info', 'SCRIPT_STARTED', script='get_members.py')
+async def main(argv: Optional[List[str]] = None):
+    io.state().csv_flushed = True
+    io.message(None, 'info', 'SCRIPT_STARTED', script='print_dialogs.py')
     try:
-        args = parse_args()
+        args = parse_args(argv)
     except Exception as e:
         io.message(None, 'error', "ARGPARSE_ERROR", error=str(e))
     
     if not args.session:
         io.message(None, 'error', 'NO_SESSION', when='main')
+    io.state().records = args.records
         
     if not args.output:
         args.output = f'./print-dialogs-{int(time.time())}.csv'
@@ -45,15 +57,19 @@ async def main():
     api_id: int = options["api_id"]
     api_hash: str = options["api_hash"]    
 
-    dialogs: List[types.Dialog] = []
-    with open(args.output, 'w', newline='', encoding='utf-8') as f:
-        writer = csv.writer(f)
-        writer.writerow(['chat_id', 'type', 'title', 'username'])
+    count = 0
+    io.open_output(args.output, COLUMNS, False)
+    with io.output(args.output) as (f, writer):
         
-        async with Client(args.session, api_id, api_hash) as cl:
+        async with io.client(args.session, api_id, api_hash) as cl:
             try:
                 async for d in cl.get_dialogs(limit=args.limit):
-                    dialogs.append(d)
+                    chat: types.Chat = d.chat
+                    # type is private, bot, group, supergroup or channel
+                    writer.writerow([chat.id, chat.type.name.lower(), dialog_title(chat), chat.username or ''])
+                    io.state().csv_flushed = False
+                    count += 1
+                    io.progress('dialogs', count, args.limit)
                     
             except errors.RPCError as e:
                 io.exit_on_rpc(f, e, 'get dialogs')
@@ -61,13 +77,7 @@ async def main():
                 io.message(f, 'error', 'UNEXPECTED_ERROR',
                             when='get dialogs',
                             error=str(e))
-    
-        for i, d in enumerate(dialogs):
-            chat: types.Chat = d.chat
-            title = getattr(chat, 'title', None) or getattr(chat, 'first_name', None) or '(no title)'
-            username = getattr(chat, 'username', None)
-            print(f'[{i+1}] id={chat.id}, type={chat.type}, title={title}, username={("@"+username) if username else ""}')
-    io.CSV_FLUSHED = True
+    io.state().csv_flushed = True
     
     io.message(None, 'info', 'ALL_DONE', output=os.path.abspath(args.output))
 
@@ -21,7 +21,7 @@ Search messages in a group/channel/private
 
 COLUMNS = ['message_id', 'text', 'date']
 
-def parse_args() -> argparse.Namespace:
+def parse_args(argv: Optional[List[str]] = None) -> argparse.Namespace:
     p = argparse.ArgumentParser(
         description='''Search messages in a group/channel/private chat by keywords. 
         WARNING: without --limit-history it will read all history of the chat. ''')
@@ -38,6 +38,10 @@ def parse_args() -> argparse.Namespace:
         "--output", type=str,
         help="output csv file path; default is search-messages-username-<time>.csv")
     
+    p.add_argument(
+        '--records', action='store_true',
+        help='emit rows as RECORD messages instead of writing the output, the client writes it')
+    
     p.add_argument(
         '--from-date', type=str, help='date from which to start searching messages, format MM/DD/YYYY')
     p.add_argument(
@@ -47,7 +51,17 @@ def parse_args() -> argparse.Namespace:
     p.add_argument(
         '--keywords', type=str, nargs='+', help='keywords to search for in messages')
     
-    return p.parse_args()
+    p.add_argument(
+        '--append', action='store_true',
+        help='append to existing output, messages already written are skipped')
+    p.add_argument(
+        '--max-flood-wait', type=int, default=0,
+        help='stop with FLOOD_WAIT_TOO_LONG if flood wait is longer (seconds); default 0 (always wait)')
+    p.add_argument(
+        '--resume-from', type=str, default=None,
+        help='checkpoint file to resume from, implies --append')
+    
+    return p.parse_args(argv)
     
   
 def get_media_content(msg: types.Message) -> str:
@@ -85,19 +99,32 @@ def get_media_content(msg: types.Message) -> str:
     
 async def fetch_messages(
     app: Client,
-    args: argparse.Namespace
+    args: argparse.Namespace,
+    seen: Set[str],
+    state: Dict[str, Any],
 ) -> None:
-    with open(args.output, 'a', newline='', encoding='utf-8') as f:
-        writer = csv.writer(f)
+    '''
+    messages with ids in seen are already written (--append) and skipped,
+    state is the checkpoint to resume from, may be empty
+    '''
+    with io.output(args.output) as (f, writer):
         
-        user_messages: int = 0
+        user_messages: int = int(state.get('messages_found', 0))
         page_size: int = 75
-        offset_id: int = 0
+        offset_id: int = int(state.get('offset_id', 0))
 
         to_date = datetime.strptime(args.to_date, '%m/%d/%Y')
         from_date = datetime.strptime(args.from_date, '%m/%d/%Y')
         
         last_offset_date: datetime = to_date
+        if state.get('offset_date'):
+            last_offset_date = datetime.fromisoformat(state['offset_date'])
+        
+        def _checkpoint(force: bool = False) -> None:
+            io.checkpoint(f, force=force, offset_id=offset_id,
+                          offset_date=last_offset_date.isoformat(),
+                          messages_found=user_messages)
+        span_days: int = (to_date - from_date).days + 1
         while last_offset_date >= from_date:
             last_msg_id: Optional[int] = None
             curr_messages: int = 0
@@ -121,20 +148,27 @@ async def fetch_messages(
                         #             msg_id=m.id,
                         #             date=m.date.strftime("%Y-%m-%d %H:%M:%S"),
                         #             username=username,)
-                        if username == args.username:
+                        if username == args.username and str(m.id) not in seen:
                             media = get_media_content(m)
                             text = m.text or media
                             writer.writerow([m.id, text, m.date.strftime("%m.%d.%Y %H:%M:%S")])
-                            io.CSV_FLUSHED = False
+                            io.state().csv_flushed = False
                             user_messages += 1
                         
                         
                     last_msg_id = m.id
                     last_offset_date = m.date
                     curr_messages += 1
+                    io.progress('days', min((to_date - m.date).days, span_days), span_days)
                       
             except errors.FloodWait as e:
-                await io.flood_wait_or_exit(f, int(getattr(e, 'value', 0)), 'fetching messages')
+                # the rest is from_date..last_offset_date, the day
+                # itself is fetched again, written messages are skipped
+                if last_msg_id is not None:
+                    offset_id = last_msg_id
+                _checkpoint(force=True)
+                await io.flood_wait_or_exit(f, int(getattr(e, 'value', 0)), 'fetching messages',
+                                            resume_to_date=last_offset_date.strftime('%m/%d/%Y'))
                 
             except errors.RPCError as e:
                 io.exit_on_rpc(f, e, 'fetching messages')
@@ -147,21 +181,24 @@ async def fetch_messages(
             if curr_messages == 0 or last_msg_id is None or last_msg_id <= 1:
                 break
             offset_id = last_msg_id
+            _checkpoint()
     
+    io.progress('days', span_days, span_days)
     io.message(None, 'info', 'MESSAGES_FETCHED', total=user_messages)  
-    io.CSV_FLUSHED = True                        
+    io.state().csv_flushed = True                        
     
 
-async def main():
+async def main(argv: Optional[List[str]] = None):
     io.message(None, 'info', 'SCRIPT_STARTED', script='search_messages.py')
     
     try:
-        args = parse_args()
+        args = parse_args(argv)
     except Exception as e:
         io.message(None, 'error', "ARGPARSE_ERROR", error=str(e))
     
     if not args.session:
         io.message(None, 'error', 'NO_SESSION', when='main')
+    io.state().records = args.records
         
     if not args.from_date:
         io.message(None, 'error', "FROM_DATE_REQUIRED", error="from_date is required")
@@ -197,13 +234,17 @@ async def main():
         io.message(None, 'error', 'INVALID_USERNAME', name=args.username)
     args.username = name
         
-    with open(args.output, 'w', newline='', encoding='utf-8') as f:
-        writer = csv.writer(f)
-        writer.writerow(COLUMNS)
-    io.CSV_FLUSHED = True
+    io.state().max_flood_wait = args.max_flood_wait
+    state: Dict[str, Any] = io.load_checkpoint(args.resume_from)
+    if args.resume_from:
+        args.append = True
+    seen: Set[str] = set()
+    if args.append:
+        seen = io.read_first_column(args.output)
+    io.open_output(args.output, COLUMNS, args.append)
     
-    async with Client(args.session, api_id=api_id, api_hash=api_hash) as app:
-        await fetch_messages(app, args)
+    async with io.client(args.session, api_id, api_hash) as app:
+        await fetch_messages(app, args, seen, state)
         
         io.message(None, 'info', 'ALL_DONE', output=os.path.abspath(args.output))
 
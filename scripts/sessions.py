@@ -0,0 +1,94 @@
+'''
+manages the authorizations (sessions) of the account on telegram's side:
+
+    list                emits AUTHORIZATION for every authorization
+    log_out             logs out the session, the local files are deleted by the client
+    terminate --hash H  terminates the authorization with hash H
+    terminate_others    terminates all authorizations but the current one
+
+hashes are strings, they don't fit into a JSON number
+'''
+import argparse
+import asyncio
+from typing import Optional, List, Dict, Any
+from config.config import get_tdlib_options
+from pyrogram import Client, errors
+from pyrogram.raw import functions, types as raw_types
+import utils.io as io
+
+ACTIONS = ['list', 'log_out', 'terminate', 'terminate_others']
+
+
+def parse_args(argv: Optional[List[str]] = None) -> argparse.Namespace:
+    p = argparse.ArgumentParser(description='Manage the sessions of the account')
+    p.add_argument(
+        'session', type=str, help='session path (string)'
+    )
+    p.add_argument('action', choices=ACTIONS, help='what to do')
+    p.add_argument('--hash', type=int, default=0, help='authorization to terminate')
+    return p.parse_args(argv)
+
+def authorization_details(a: raw_types.Authorization) -> Dict[str, Any]:
+    return {
+        'hash': str(a.hash),
+        'current': bool(a.current),
+        'device_model': a.device_model,
+        'platform': a.platform,
+        'system_version': a.system_version,
+        'app_name': a.app_name,
+        'app_version': a.app_version,
+        'ip': a.ip,
+        'country': a.country,
+        'date_created': a.date_created,
+        'date_active': a.date_active,
+    }
+
+async def run(cl: Client, args: argparse.Namespace) -> None:
+    if args.action == 'list':
+        res = await cl.invoke(functions.account.GetAuthorizations())
+        for a in res.authorizations:
+            io.message(None, 'info', 'AUTHORIZATION', **authorization_details(a))
+        io.message(None, 'info', 'ALL_DONE', total=len(res.authorizations))
+    elif args.action == 'log_out':
+        # not Client.log_out: it stops the client and deletes the storage,
+        # the client owns both
+        await cl.invoke(functions.auth.LogOut())
+        io.message(None, 'info', 'LOGGED_OUT')
+    elif args.action == 'terminate':
+        if not args.hash:
+            io.message(None, 'error', 'AUTHORIZATION_HASH_REQUIRED', when='terminate')
+        await cl.invoke(functions.account.ResetAuthorization(hash=args.hash))
+        io.message(None, 'info', 'TERMINATED', hash=str(args.hash))
+    elif args.action == 'terminate_others':
+        await cl.invoke(functions.auth.ResetAuthorizations())
+        io.message(None, 'info', 'TERMINATED', hash='others')
+
+async def main(argv: Optional[List[str]] = None):
+    io.state().csv_flushed = True
+    args = parse_args(argv)
+    if not args.session:
+        io.message(None, 'error', 'NO_SESSION', when='main')
+
+    options: Dict[str, Any] = get_tdlib_options()
+    api_id: int = options['api_id']
+    api_hash: str = options['api_hash']
+
+    try:
+        async with io.client(args.session, api_id, api_hash) as cl:
+            await run(cl, args)
+    except errors.Unauthorized as e:
+        io.message(None, 'error', 'SESSION_REVOKED', when=args.action, m=e.ID)
+    except errors.RPCError as e:
+        if e.ID == 'FRESH_RESET_AUTHORISATION_FORBIDDEN':
+            # telegram allows it only for sessions older than 24 hours
+            io.message(None, 'error', 'FRESH_RESET_FORBIDDEN', when=args.action)
+        io.exit_on_rpc(None, e, args.action)
+    except OSError as e:
+        io.message(None, 'error', 'CONNECTION_FAILED', when=args.action, error=str(e))
+
+if __name__ == '__main__':
+    try:
+        asyncio.run(main())
+    except Exception as e:
+        io.message(None, 'error', 'UNEXPECTED_ERROR',
+                    when='main', error=str(e))
@@ -3,16 +3,73 @@ import sys
 import csv
 import argparse
 import asyncio
-from typing import Optional, List, Tuple, Any, Dict
+from typing import Optional, List, Tuple, Any, Dict, Set
 from config.config import get_tdlib_options
 from pyrogram import Client, errors, types, enums
 import regex as re
 from enum import Enum, auto
 from urllib.parse import urlparse, ParseResult
-from typing import TextIO
+from typing import TextIO, Callable, AsyncIterator, Iterator
+from contextlib import asynccontextmanager, contextmanager
+from contextvars import ContextVar
 import json
+import time
 
-CSV_FLUSHED = False
+# minimal interval between two PROGRESS messages of the same phase
+PROGRESS_INTERVAL = 0.5
+
+CHECKPOINT_INTERVAL = 5.0
+
+class CallState:
+    '''
+    state of a single script run. a script run as a process has one,
+    the worker (see worker.py) creates one per call with enter_call
+    '''
+    def __init__(self,
+                 emit: Callable[[str, Dict[str, Any]], None]|None = None,
+                 clients: Any = None) -> None:
+        self.csv_flushed: bool = False
+        
+        # flood waits longer than this (seconds) stop the script with
+        # FLOOD_WAIT_TOO_LONG, so the rest can be done by another account.
+        # 0 means wait any time. Set by --max-flood-wait
+        self.max_flood_wait: int = 0
+        
+        # rows are emitted as RECORD messages instead of written to the
+        # output, the client writes them in its format. Set by --records
+        self.records: bool = False
+        
+        self.last_progress: Dict[str, float] = {}
+        self.last_checkpoint: float|None = None
+        
+        # emit(kind, {'code', 'details'}) replaces writing envelopes to stdout/stderr
+        self.emit = emit
+        # clients is a pool of started clients shared by calls, see client()
+        self.clients = clients
+
+_state: ContextVar[CallState] = ContextVar('io_state', default=CallState())
+
+def state() -> CallState:
+    return _state.get()
+
+def enter_call(emit: Callable[[str, Dict[str, Any]], None], clients: Any) -> None:
+    '''
+    starts a new state for the current asyncio task
+    '''
+    _state.set(CallState(emit, clients))
+
+@asynccontextmanager
+async def client(session: str, api_id: int, api_hash: str) -> AsyncIterator[Client]:
+    '''
+    yields a started client for session. in the worker the client is
+    taken from the pool and kept started after the script is done
+    '''
+    pool = state().clients
+    if pool is None:
+        async with Client(session, api_id, api_hash) as app:
+            yield app
+        return
+    yield await pool.get(session, api_id, api_hash)
 
 def message(csvf: TextIO|None, msg_type: str, code: str, **details):
     '''
@@ -22,7 +79,7 @@ def message(csvf: TextIO|None, msg_type: str, code: str, **details):
     '''
     
     
-    global CSV_FLUSHED
+    st = state()
     obj: Dict[str, Any] = {}
     obj = {'code': code, 'details': details or None}
     ret: Dict[str, Dict[str, Any]] = {}
@@ -34,35 +91,166 @@ def message(csvf: TextIO|None, msg_type: str, code: str, **details):
         ret = {'warn': obj}
     elif msg_type[0] == 'i':
         ret = {'info': obj}
+    elif msg_type[0] == 'p':
+        ret = {'progress': obj}
     else:
         ret = {'log': obj}
-    out.write(json.dumps(ret) + '\n')
-    out.flush()
-    if csvf is not None and not CSV_FLUSHED:
+    if st.emit is not None:
+        kind, = ret
+        st.emit(kind, obj)
+    else:
+        out.write(json.dumps(ret) + '\n')
+        out.flush()
+    if csvf is not None and not st.csv_flushed:
         try:
             csvf.flush()
             os.fsync(csvf.fileno())
         except OSError as e:
-            sys.stdout.write(json.dumps({'warn': 
-                {'code': 'CSV_FLUSH_ERROR', 
-                'details': None}}) + '\n')
-            sys.stdout.flush()
-        CSV_FLUSHED = True
+            if st.emit is not None:
+                st.emit('warn', {'code': 'CSV_FLUSH_ERROR', 'details': None})
+            else:
+                sys.stdout.write(json.dumps({'warn': 
+                    {'code': 'CSV_FLUSH_ERROR', 
+                    'details': None}}) + '\n')
+                sys.stdout.flush()
+        st.csv_flushed = True
     if msg_type[0] == 'e':
         sys.exit(1)
 
-async def flood_wait_or_exit(csvf: TextIO, value: int, when:str) -> None:
+def progress(phase: str, current: int, total: int = 0, **details) -> None:
+    '''
+    emits PROGRESS message, at most once per PROGRESS_INTERVAL for a phase,
+    except the first and the last (current >= total) ones.
+
+    pass total as 0 if it is unknown
+    '''
+    st = state()
+    now = time.monotonic()
+    last = st.last_progress.get(phase)
+    done = total > 0 and current >= total
+    if last is not None and not done and now - last < PROGRESS_INTERVAL:
+        return
+    st.last_progress[phase] = now
+    message(None, 'progress', 'PROGRESS',
+            phase=phase, current=current, total=total, **details)
+
+def checkpoint(csvf: TextIO|None, force: bool = False, **cp_state) -> None:
+    '''
+    emits CHECKPOINT message with cp_state, the state to resume from,
+    at most once per CHECKPOINT_INTERVAL unless force is set.
+    
+    csvf is flushed before, so the state never gets ahead of the file.
+    the client saves the state next to the output and passes it back
+    with --resume-from (see load_checkpoint)
+    '''
+    st = state()
+    now = time.monotonic()
+    if not force and st.last_checkpoint is not None and now - st.last_checkpoint < CHECKPOINT_INTERVAL:
+        return
+    st.last_checkpoint = now
+    if csvf is not None and not st.csv_flushed:
+        try:
+            csvf.flush()
+            os.fsync(csvf.fileno())
+        except OSError:
+            # the state may be ahead of the file, don't save it
+            message(None, 'warn', 'CSV_FLUSH_ERROR')
+            return
+        st.csv_flushed = True
+    message(None, 'log', 'CHECKPOINT', **cp_state)
+
+def load_checkpoint(path: str|None) -> Dict[str, Any]:
+    '''
+    returns the state of the checkpoint file written by the client,
+    or an empty dict if there is no checkpoint
+    '''
+    if not path:
+        return {}
+    try:
+        with open(path, encoding='utf-8') as f:
+            data = json.load(f)
+    except FileNotFoundError:
+        return {}
+    except (OSError, ValueError) as e:
+        message(None, 'error', 'CHECKPOINT_INVALID', path=path, error=str(e))
+    state = data.get('state') if isinstance(data, dict) else None
+    return state if isinstance(state, dict) else {}
+
+async def flood_wait_or_exit(csvf: TextIO, value: int, when:str, **resume) -> None:
+    '''
+    waits value seconds, or exits with FLOOD_WAIT_TOO_LONG if value > max_flood_wait.
+    
+    resume is passed to FLOOD_WAIT_TOO_LONG details, it tells
+    where the rest of the work starts (see Resumable in the client)
+    '''
     message(csvf, 'warn', 'FLOOD_WAIT', when=when, value=value)
     
-    # if value > MAX_FLOOD_WAIT:
-    #     print(f'flood wait too long ({value} seconds), stopping', file=sys.stderr)
-    #     flush_and_sync(f)
-    #     sys.exit(1)
+    max_wait = state().max_flood_wait
+    if max_wait > 0 and value > max_wait:
+        message(csvf, 'error', 'FLOOD_WAIT_TOO_LONG',
+                when=when, value=value, max=max_wait, **resume)
     
     try:
         await asyncio.sleep(value + 1)
     except asyncio.CancelledError:
         message(None, 'error', 'TASK_CANCELLED', when='flood_wait_or_exit')
         
+def read_first_column(path: str) -> Set[str]:
+    '''
+    returns values of the first column of csv file without header,
+    used to skip rows already written in --append mode.
+
+    in --records mode the output is not csv, it returns an empty set:
+    the client skips rows already written
+    '''
+    seen: Set[str] = set()
+    if state().records:
+        return seen
+    try:
+        with open(path, newline='', encoding='utf-8') as f:
+            reader = csv.reader(f)
+            next(reader, None)
+            for row in reader:
+                if row:
+                    seen.add(row[0])
+    except FileNotFoundError:
+        pass
+    return seen
+
+def open_output(path: str, columns: List[str], append: bool) -> None:
+    '''
+    writes csv header, or keeps the file in append mode if it exists.
+    in --records mode emits COLUMNS instead
+    '''
+    if state().records:
+        message(None, 'log', 'COLUMNS', columns=columns, append=append)
+        return
+    if append and os.path.exists(path) and os.path.getsize(path) > 0:
+        return
+    with open(path, 'w', newline='', encoding='utf-8') as f:
+        writer = csv.writer(f)
+        writer.writerow(columns)
+    state().csv_flushed = True
+
+class RecordWriter:
+    '''
+    csv.writer of --records mode, a row is emitted as RECORD message.
+    values are strings as csv.writer would write them
+    '''
+    def writerow(self, row: List[Any]) -> None:
+        message(None, 'log', 'RECORD', row=['' if v is None else str(v) for v in row])
+
+@contextmanager
+def output(path: str, mode: str = 'a') -> Iterator[Tuple[TextIO|None, Any]]:
+    '''
+    yields the output file opened with mode and csv.writer for it,
+    or (None, RecordWriter) in --records mode
+    '''
+    if state().records:
+        yield None, RecordWriter()
+        return
+    with open(path, mode, newline='', encoding='utf-8') as f:
+        yield f, csv.writer(f)
+
 def exit_on_rpc(csvf: TextIO, e: errors.RPCError, when: str) -> None:
     message(csvf,'error', 'RPC_ERROR', when=when, c=e.CODE, m=e.MESSAGE, id=e.ID)
\ No newline at end of file
@@ -0,0 +1,205 @@
+'''
+long-lived worker running scripts in a single process, so pyrogram is
+imported once and clients stay connected between jobs.
+
+speaks JSON-RPC 2.0 over stdin/stdout, one message per line:
+
+    run {script, args, env}     runs main(args) of the script, returns {}.
+                                env {API_ID, API_HASH} is optional
+    close_session {session}     stops the client of the session
+    ping                        returns 'pong'
+    shutdown                    stops all clients and exits
+
+    cancel {call}               notification, cancels the run with id call
+
+envelopes of a run (see utils/io.py) are sent as notifications
+'event' {call, envelope}. if the script fails, the error response has
+data {code, details} of the last error envelope.
+'''
+import os
+import sys
+import json
+import asyncio
+import importlib
+from typing import Optional, List, Tuple, Any, Dict, Set, TextIO
+from pyrogram import Client
+import utils.io as io
+import config.config as config
+
+SCRIPTS = {'get_members', 'get_chat_statistic', 'search_messages', 'print_dialogs', 'check_session', 'sessions'}
+
+# JSON-RPC error codes
+PARSE_ERROR = -32700
+INVALID_REQUEST = -32600
+METHOD_NOT_FOUND = -32601
+INVALID_PARAMS = -32602
+SCRIPT_ERROR = -32000
+REQUEST_CANCELLED = -32800
+
+
+class ClientPool:
+    '''
+    started clients by session, shared by calls
+    '''
+    def __init__(self) -> None:
+        self.clients: Dict[str, Client] = {}
+        self.lock = asyncio.Lock()
+
+    async def get(self, session: str, api_id: int, api_hash: str) -> Client:
+        async with self.lock:
+            app = self.clients.get(session)
+            if app is None:
+                app = Client(session, api_id, api_hash)
+                await app.start()
+                self.clients[session] = app
+            return app
+
+    async def close(self, session: str) -> None:
+        async with self.lock:
+            app = self.clients.pop(session, None)
+            if app is not None and app.is_connected:
+                await app.stop()
+
+    async def close_all(self) -> None:
+        for session in list(self.clients):
+            await self.close(session)
+
+
+class Worker:
+    def __init__(self, inp: TextIO, out: TextIO) -> None:
+        self.inp = inp
+        self.out = out
+        self.clients = ClientPool()
+        self.calls: Dict[Any, asyncio.Task] = {}
+        self.cancelled: Set[Any] = set()
+        self.stopping = False
+
+    def send(self, obj: Dict[str, Any]) -> None:
+        obj['jsonrpc'] = '2.0'
+        self.out.write(json.dumps(obj) + '\n')
+        self.out.flush()
+
+    def result(self, id: Any, result: Any) -> None:
+        self.send({'id': id, 'result': result})
+
+    def error(self, id: Any, code: int, msg: str, data: Any = None) -> None:
+        err: Dict[str, Any] = {'code': code, 'message': msg}
+        if data is not None:
+            err['data'] = data
+        self.send({'id': id, 'error': err})
+
+    def notify(self, method: str, params: Dict[str, Any]) -> None:
+        self.send({'method': method, 'params': params})
+
+    async def run(self, id: Any, params: Dict[str, Any]) -> None:
+        script = params.get('script')
+        args = params.get('args') or []
+        env = params.get('env') or {}
+        if script not in SCRIPTS or not isinstance(args, list) or not isinstance(env, dict):
+            self.error(id, INVALID_PARAMS, f'unknown script {script!r}')
+            return
+
+        last_error: Optional[Dict[str, Any]] = None
+        def emit(kind: str, obj: Dict[str, Any]) -> None:
+            nonlocal last_error
+            if kind == 'error':
+                last_error = obj
+            self.notify('event', {'call': id, 'envelope': {kind: obj}})
+        # the task has its own context, the state is not shared with other calls
+        io.enter_call(emit, self.clients)
+        config.set_call_env({str(k): str(v) for k, v in env.items()})
+
+        try:
+            module = importlib.import_module(script)
+            await module.main([str(a) for a in args])
+            self.result(id, {})
+        except (asyncio.CancelledError, SystemExit) as e:
+            if id in self.cancelled:
+                self.error(id, REQUEST_CANCELLED, 'cancelled')
+            elif isinstance(e, asyncio.CancelledError):
+                self.error(id, REQUEST_CANCELLED, 'cancelled by worker')
+            else:
+                # io.message exits on error envelopes, argparse exits on bad args
+                data = last_error or {'code': 'ARGPARSE_ERROR', 'details': {'exit': str(e.code)}}
+                self.error(id, SCRIPT_ERROR, data['code'], data)
+        except Exception as e:
+            data = {'code': 'UNEXPECTED_ERROR', 'details': {'when': 'main', 'error': str(e)}}
+            self.notify('event', {'call': id, 'envelope': {'error': data}})
+            self.error(id, SCRIPT_ERROR, data['code'], data)
+        finally:
+            self.calls.pop(id, None)
+            self.cancelled.discard(id)
+
+    async def handle(self, line: bytes) -> None:
+        try:
+            req = json.loads(line)
+        except ValueError as e:
+            self.error(None, PARSE_ERROR, str(e))
+            return
+        if not isinstance(req, dict) or not isinstance(req.get('method'), str):
+            self.error(None, INVALID_REQUEST, 'invalid request')
+            return
+
+        id = req.get('id')
+        method = req['method']
+        params = req.get('params') or {}
+
+        if method == 'cancel':
+            call = params.get('call')
+            task = self.calls.get(call)
+            if task is not None:
+                self.cancelled.add(call)
+                task.cancel()
+        elif method == 'run':
+            if id in self.calls:
+                self.error(id, INVALID_REQUEST, f'call {id} is running')
+                return
+            self.calls[id] = asyncio.create_task(self.run(id, params))
+        elif method == 'close_session':
+            await self.clients.close(str(params.get('session', '')))
+            self.result(id, {})
+        elif method == 'ping':
+            self.result(id, 'pong')
+        elif method == 'shutdown':
+            await self.shutdown()
+            self.result(id, {})
+        elif id is not None:
+            self.error(id, METHOD_NOT_FOUND, f'unknown method {method!r}')
+
+    async def shutdown(self) -> None:
+        self.stopping = True
+        for task in list(self.calls.values()):
+            task.cancel()
+        if self.calls:
+            await asyncio.gather(*self.calls.values(), return_exceptions=True)
+        await self.clients.close_all()
+
+    async def serve(self) -> None:
+        loop = asyncio.get_running_loop()
+        reader = asyncio.StreamReader(limit=1 << 20)
+        await loop.connect_read_pipe(lambda: asyncio.StreamReaderProtocol(reader), self.inp)
+
+        while not self.stopping:
+            line = await reader.readline()
+            if not line:
+                # the client is gone
+                await self.shutdown()
+                return
+            if line.strip():
+                await self.handle(line)
+
+
+async def main():
+    # the protocol owns stdin and stdout: prints of scripts and pyrogram
+    # go to stderr, and pyrogram prompts (e.g. no session) get EOF
+    inp, out = sys.stdin, sys.stdout
+    sys.stdout = sys.stderr
+    sys.stdin = open(os.devnull)
+    await Worker(inp, out).serve()
+
+
+if __name__ == '__main__':
+    try:
+        asyncio.run(main())
+    except KeyboardInterrupt:
+        pass